@@ -14,6 +14,7 @@ import (
 	"github.com/golang-sql/civil"
 	"github.com/microsoft/go-mssqldb/aecmk"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type providerTest interface {
@@ -210,6 +211,98 @@ func TestAlwaysEncryptedE2E(t *testing.T) {
 	}
 }
 
+func TestAlwaysEncryptedBulkCopy(t *testing.T) {
+	params := testConnParams(t)
+	if !params.ColumnEncryption {
+		t.Skip("Test is not running with column encryption enabled")
+	}
+	for _, test := range providerTests {
+		t.Run(test.Name(), func(t *testing.T) {
+			conn, _ := open(t)
+			defer conn.Close()
+			certPath := test.ProvisionMasterKey(t)
+			defer test.DeleteMasterKey(t)
+			_, err := conn.Exec(fmt.Sprintf(createColumnMasterKey, certPath, test.Name(), certPath))
+			require.NoError(t, err, "Unable to create CMK")
+			defer func() {
+				_, err := conn.Exec(fmt.Sprintf(dropColumnMasterKey, certPath))
+				assert.NoError(t, err, "dropColumnMasterKey")
+			}()
+			r, _ := rand.Int(rand.Reader, big.NewInt(1000))
+			cekName := fmt.Sprintf("mssqlBulkCek%d", r.Int64())
+			tableName := fmt.Sprintf("mssqlAeBulk%d", r.Int64())
+			keyBytes := make([]byte, 32)
+			_, _ = rand.Read(keyBytes)
+			encryptedCek, err := test.GetProvider(t).EncryptColumnEncryptionKey(context.Background(), certPath, KeyEncryptionAlgorithm, keyBytes)
+			require.NoError(t, err, "Encrypt")
+			_, err = conn.Exec(fmt.Sprintf(createColumnEncryptionKey, cekName, certPath, encryptedCek))
+			require.NoError(t, err, "Unable to create CEK")
+			defer func() {
+				_, err := conn.Exec(fmt.Sprintf(dropColumnEncryptionKey, cekName))
+				assert.NoError(t, err, "dropColumnEncryptionKey")
+			}()
+			encrypted := func(encType string) string {
+				return fmt.Sprintf(`ENCRYPTED WITH (ENCRYPTION_TYPE = %s,
+			ALGORITHM = 'AEAD_AES_256_CBC_HMAC_SHA_256',
+			COLUMN_ENCRYPTION_KEY = [%s])`, encType, cekName)
+			}
+			_, err = conn.Exec(fmt.Sprintf(`CREATE TABLE [%s] (
+				id int %s,
+				name nvarchar(30) %s NULL,
+				amount decimal(10,2) %s,
+				flag bit %s,
+				plain nvarchar(30))`, tableName,
+				encrypted("DETERMINISTIC"), encrypted("RANDOMIZED"), encrypted("RANDOMIZED"), encrypted("DETERMINISTIC")))
+			require.NoError(t, err, "Failed to create encrypted table")
+			defer func() { _, _ = conn.Exec("DROP TABLE IF EXISTS " + tableName) }()
+
+			ctx := testContext(t)
+			c, err := conn.Conn(ctx)
+			require.NoError(t, err)
+			defer c.Close()
+			rows := [][]interface{}{
+				{1, "first", "12.34", true, "plain1"},
+				{-2, nil, "-0.5", false, "plain2"},
+			}
+			err = c.Raw(func(driverConn any) error {
+				bulk := driverConn.(*Conn).CreateBulkContext(ctx, "["+tableName+"]", []string{"id", "name", "amount", "flag", "plain"})
+				for _, row := range rows {
+					if err := bulk.AddRow(row); err != nil {
+						return err
+					}
+				}
+				rowCount, err := bulk.Done()
+				assert.Equal(t, int64(len(rows)), rowCount)
+				return err
+			})
+			require.NoError(t, err, "Bulk copy into encrypted table")
+
+			res, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT id, name, amount, flag, plain FROM [%s] ORDER BY plain", tableName))
+			require.NoError(t, err)
+			defer res.Close()
+			var got [][]interface{}
+			for res.Next() {
+				var id int
+				var name sql.NullString
+				var amount string
+				var flag bool
+				var plain string
+				require.NoError(t, res.Scan(&id, &name, &amount, &flag, &plain))
+				var n interface{}
+				if name.Valid {
+					n = name.String
+				}
+				got = append(got, []interface{}{id, n, amount, flag, plain})
+			}
+			require.NoError(t, res.Err())
+			assert.Equal(t, [][]interface{}{
+				{1, "first", "12.34", true, "plain1"},
+				{-2, nil, "-0.50", false, "plain2"},
+			}, got)
+		})
+	}
+}
+
 func testProviderErrorHandling(t *testing.T, name string, provider aecmk.ColumnEncryptionKeyProvider, sel string, insert string, insertArgs []interface{}) {
 	t.Helper()
 	testProvider := &testKeyProvider{fallback: provider}
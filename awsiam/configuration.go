@@ -0,0 +1,100 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+const defaultPort = 1433
+
+type awsIAMConfig struct {
+	mssqlConfig msdsn.Config
+	// enabled is set when the DSN requests IAM authentication
+	enabled bool
+	// region of the RDS instance or proxy, used in the token signature
+	region string
+	// profile is the shared config profile used to look up credentials
+	profile string
+	// endpoint is the host:port the token is issued for
+	endpoint string
+	// user is the database user the token is issued for
+	user string
+}
+
+// parse returns a config based on an msdsn-style connection string
+func parse(dsn string) (*awsIAMConfig, error) {
+	mssqlConfig, err := msdsn.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	config := &awsIAMConfig{
+		mssqlConfig: mssqlConfig,
+	}
+
+	err = config.validateParameters(mssqlConfig.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (p *awsIAMConfig) validateParameters(params map[string]string) error {
+	enabled, ok := params["awsiam"]
+	if !ok {
+		return nil
+	}
+	var err error
+	p.enabled, err = strconv.ParseBool(enabled)
+	if err != nil {
+		return fmt.Errorf("invalid awsiam parameter '%s': %v", enabled, err)
+	}
+	if !p.enabled {
+		return nil
+	}
+
+	p.user = p.mssqlConfig.User
+	if p.user == "" {
+		return errors.New("Must provide 'user id' parameter when using awsiam authentication")
+	}
+	if p.mssqlConfig.Host == "" {
+		return errors.New("Must provide 'server' parameter when using awsiam authentication")
+	}
+	port := p.mssqlConfig.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	p.endpoint = fmt.Sprintf("%s:%d", p.mssqlConfig.Host, port)
+
+	p.profile = params["awsprofile"]
+	if p.profile == "" {
+		p.profile = os.Getenv("AWS_PROFILE")
+	}
+	if p.profile == "" {
+		p.profile = "default"
+	}
+
+	p.region = params["region"]
+	if p.region == "" {
+		p.region = os.Getenv("AWS_REGION")
+	}
+	if p.region == "" {
+		p.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if p.region == "" {
+		if cfg, err := loadSharedConfigProfile(p.profile); err == nil {
+			p.region = cfg["region"]
+		}
+	}
+	if p.region == "" {
+		return errors.New("Must provide 'region' parameter or set AWS_REGION environment variable when using awsiam authentication")
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateParameters(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	tests := []struct {
+		name     string
+		dsn      string
+		expected awsIAMConfig
+		wantErr  string
+	}{
+		{
+			name:     "awsiam not requested",
+			dsn:      "server=someserver;user id=admin;password=pwd",
+			expected: awsIAMConfig{},
+		},
+		{
+			name:     "awsiam disabled",
+			dsn:      "server=someserver;user id=admin;awsiam=false",
+			expected: awsIAMConfig{},
+		},
+		{
+			name: "awsiam with region",
+			dsn:  "server=proxy.example.rds.amazonaws.com;user id=admin;awsiam=true;region=eu-west-1",
+			expected: awsIAMConfig{
+				enabled:  true,
+				region:   "eu-west-1",
+				profile:  "default",
+				endpoint: "proxy.example.rds.amazonaws.com:1433",
+				user:     "admin",
+			},
+		},
+		{
+			name: "url dsn with port and profile",
+			dsn:  "sqlserver://admin@proxy.example.rds.amazonaws.com:14330?awsiam=1&region=us-east-2&awsprofile=prod",
+			expected: awsIAMConfig{
+				enabled:  true,
+				region:   "us-east-2",
+				profile:  "prod",
+				endpoint: "proxy.example.rds.amazonaws.com:14330",
+				user:     "admin",
+			},
+		},
+		{
+			name:    "invalid awsiam value",
+			dsn:     "server=someserver;user id=admin;awsiam=maybe;region=us-east-1",
+			wantErr: "invalid awsiam parameter",
+		},
+		{
+			name:    "missing user",
+			dsn:     "server=someserver;awsiam=true;region=us-east-1",
+			wantErr: "user id",
+		},
+		{
+			name:    "missing region",
+			dsn:     "server=someserver;user id=admin;awsiam=true",
+			wantErr: "region",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parse(tt.dsn)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			config.mssqlConfig = tt.expected.mssqlConfig
+			assert.Equal(t, tt.expected, *config)
+		})
+	}
+}
+
+func TestRegionFromEnvironmentAndSharedConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	err := os.WriteFile(configFile, []byte("[default]\nregion = us-west-1\n\n[profile prod]\nregion = ap-southeast-2\n"), 0600)
+	assert.NoError(t, err)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	config, err := parse("server=someserver;user id=admin;awsiam=true")
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-1", config.region)
+
+	t.Setenv("AWS_PROFILE", "prod")
+	config, err = parse("server=someserver;user id=admin;awsiam=true")
+	assert.NoError(t, err)
+	assert.Equal(t, "ap-southeast-2", config.region)
+
+	t.Setenv("AWS_REGION", "sa-east-1")
+	config, err = parse("server=someserver;user id=admin;awsiam=true")
+	assert.NoError(t, err)
+	assert.Equal(t, "sa-east-1", config.region)
+}
+
+func TestNewConnector(t *testing.T) {
+	c, err := NewConnector("server=someserver;user id=admin;awsiam=true;region=us-east-1")
+	assert.NoError(t, err)
+	assert.IsType(t, &mssql.Connector{}, c)
+
+	c, err = NewConnector("server=someserver;user id=admin;password=pwd")
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+}
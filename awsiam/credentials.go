@@ -0,0 +1,332 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentialRefreshMargin is how long before their expiration temporary
+// credentials are considered expired and retrieved again.
+const credentialRefreshMargin = 5 * time.Minute
+
+// credentials are the AWS access keys used to sign authentication tokens.
+type credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	// expires is the zero time for long-term credentials
+	expires time.Time
+}
+
+func (c credentials) expired(now time.Time) bool {
+	return !c.expires.IsZero() && !now.Add(credentialRefreshMargin).Before(c.expires)
+}
+
+// credentialProvider retrieves credentials from a single source. Providers
+// return errNoCredentials when their source is not configured so the chain
+// can move on to the next one.
+type credentialProvider interface {
+	retrieve(ctx context.Context) (credentials, error)
+}
+
+var errNoCredentials = errors.New("no credentials")
+
+// credentialChain tries each provider in order and caches the first
+// credentials found until they expire.
+type credentialChain struct {
+	providers []credentialProvider
+
+	mu     sync.Mutex
+	cached credentials
+	now    func() time.Time
+}
+
+// newDefaultCredentialChain returns the standard AWS credential sources:
+// environment variables, web identity token file, then the shared
+// credentials and config files.
+func newDefaultCredentialChain(profile, region string) *credentialChain {
+	return &credentialChain{
+		providers: []credentialProvider{
+			envProvider{},
+			webIdentityProvider{region: region},
+			sharedConfigProvider{profile: profile, region: region},
+		},
+		now: time.Now,
+	}
+}
+
+func (c *credentialChain) retrieve(ctx context.Context) (credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached.accessKeyID != "" && !c.cached.expired(c.now()) {
+		return c.cached, nil
+	}
+	for _, p := range c.providers {
+		creds, err := p.retrieve(ctx)
+		if errors.Is(err, errNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return credentials{}, err
+		}
+		c.cached = creds
+		return creds, nil
+	}
+	return credentials{}, errors.New("awsiam: no AWS credentials found in environment, web identity token file or shared config files")
+}
+
+// envProvider reads static credentials from the standard environment variables.
+type envProvider struct{}
+
+func (envProvider) retrieve(ctx context.Context) (credentials, error) {
+	id := os.Getenv("AWS_ACCESS_KEY_ID")
+	if id == "" {
+		id = os.Getenv("AWS_ACCESS_KEY")
+	}
+	secret := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if secret == "" {
+		secret = os.Getenv("AWS_SECRET_KEY")
+	}
+	if id == "" && secret == "" {
+		return credentials{}, errNoCredentials
+	}
+	if id == "" || secret == "" {
+		return credentials{}, errors.New("awsiam: both AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return credentials{
+		accessKeyID:     id,
+		secretAccessKey: secret,
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, nil
+}
+
+// webIdentityProvider exchanges the OIDC token in AWS_WEB_IDENTITY_TOKEN_FILE
+// for temporary credentials of AWS_ROLE_ARN, as used by EKS service accounts.
+type webIdentityProvider struct {
+	region string
+	// tokenFile and roleARN override the environment variables when set
+	tokenFile string
+	roleARN   string
+}
+
+func (p webIdentityProvider) retrieve(ctx context.Context) (credentials, error) {
+	tokenFile := p.tokenFile
+	if tokenFile == "" {
+		tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	roleARN := p.roleARN
+	if roleARN == "" {
+		roleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+	if tokenFile == "" || roleARN == "" {
+		return credentials{}, errNoCredentials
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return credentials{}, fmt.Errorf("awsiam: unable to read web identity token file: %w", err)
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("go-mssqldb-%d", time.Now().UnixNano())
+	}
+	return assumeRoleWithWebIdentity(ctx, p.region, roleARN, sessionName, strings.TrimSpace(string(token)))
+}
+
+// stsEndpoint returns the regional STS endpoint. Tests replace it.
+var stsEndpoint = func(region string) string {
+	return "https://sts." + region + ".amazonaws.com/"
+}
+
+type stsCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials stsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+type stsErrorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+// assumeRoleWithWebIdentity calls the STS AssumeRoleWithWebIdentity action,
+// which does not require the request to be signed.
+func assumeRoleWithWebIdentity(ctx context.Context, region, roleARN, sessionName, token string) (credentials, error) {
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {token},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stsEndpoint(region), strings.NewReader(form.Encode()))
+	if err != nil {
+		return credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return credentials{}, fmt.Errorf("awsiam: AssumeRoleWithWebIdentity failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return credentials{}, fmt.Errorf("awsiam: AssumeRoleWithWebIdentity failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e stsErrorResponse
+		if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+			return credentials{}, fmt.Errorf("awsiam: AssumeRoleWithWebIdentity failed: %s: %s", e.Code, e.Message)
+		}
+		return credentials{}, fmt.Errorf("awsiam: AssumeRoleWithWebIdentity failed with status %s", resp.Status)
+	}
+	var r assumeRoleWithWebIdentityResponse
+	if err := xml.Unmarshal(body, &r); err != nil {
+		return credentials{}, fmt.Errorf("awsiam: unable to parse AssumeRoleWithWebIdentity response: %w", err)
+	}
+	if r.Credentials.AccessKeyID == "" {
+		return credentials{}, errors.New("awsiam: AssumeRoleWithWebIdentity response contains no credentials")
+	}
+	return credentials{
+		accessKeyID:     r.Credentials.AccessKeyID,
+		secretAccessKey: r.Credentials.SecretAccessKey,
+		sessionToken:    r.Credentials.SessionToken,
+		expires:         r.Credentials.Expiration,
+	}, nil
+}
+
+// sharedConfigProvider reads credentials for a profile from the shared
+// credentials file, falling back to the shared config file. A config profile
+// with role_arn and web_identity_token_file is resolved through STS.
+type sharedConfigProvider struct {
+	profile string
+	region  string
+}
+
+func (p sharedConfigProvider) retrieve(ctx context.Context) (credentials, error) {
+	creds, err := loadSharedCredentialsProfile(p.profile)
+	if err != nil {
+		return credentials{}, err
+	}
+	if c, ok := staticCredentials(creds); ok {
+		return c, nil
+	}
+	cfg, err := loadSharedConfigProfile(p.profile)
+	if err != nil {
+		return credentials{}, err
+	}
+	if c, ok := staticCredentials(cfg); ok {
+		return c, nil
+	}
+	if cfg["role_arn"] != "" && cfg["web_identity_token_file"] != "" {
+		return webIdentityProvider{region: p.region, tokenFile: cfg["web_identity_token_file"], roleARN: cfg["role_arn"]}.retrieve(ctx)
+	}
+	return credentials{}, errNoCredentials
+}
+
+func staticCredentials(section map[string]string) (credentials, bool) {
+	if section["aws_access_key_id"] == "" || section["aws_secret_access_key"] == "" {
+		return credentials{}, false
+	}
+	return credentials{
+		accessKeyID:     section["aws_access_key_id"],
+		secretAccessKey: section["aws_secret_access_key"],
+		sessionToken:    section["aws_session_token"],
+	}, true
+}
+
+func sharedFilePath(envVar, name string) string {
+	if path := os.Getenv(envVar); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// loadSharedCredentialsProfile returns the keys of profile in the shared
+// credentials file, where sections are named after the profile.
+func loadSharedCredentialsProfile(profile string) (map[string]string, error) {
+	sections, err := loadINI(sharedFilePath("AWS_SHARED_CREDENTIALS_FILE", "credentials"))
+	if err != nil {
+		return nil, err
+	}
+	return sections[profile], nil
+}
+
+// loadSharedConfigProfile returns the keys of profile in the shared config
+// file, where sections other than default are prefixed with "profile ".
+func loadSharedConfigProfile(profile string) (map[string]string, error) {
+	sections, err := loadINI(sharedFilePath("AWS_CONFIG_FILE", "config"))
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := sections["profile "+profile]; ok {
+		return s, nil
+	}
+	return sections[profile], nil
+}
+
+// loadINI parses the subset of the INI format used by the AWS shared files.
+// A missing file is not an error.
+func loadINI(path string) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	if path == "" {
+		return sections, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return sections, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			current = sections[name]
+			if current == nil {
+				current = map[string]string{}
+				sections[name] = current
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return sections, scanner.Err()
+}
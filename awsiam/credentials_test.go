@@ -0,0 +1,125 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func clearAWSEnvironment(t *testing.T) {
+	for _, v := range []string{"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_SESSION_TOKEN",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_PROFILE"} {
+		t.Setenv(v, "")
+	}
+	dir := t.TempDir()
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+}
+
+func TestCredentialChainEnvironment(t *testing.T) {
+	clearAWSEnvironment(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+	t.Setenv("AWS_SESSION_TOKEN", "envtoken")
+
+	creds, err := newDefaultCredentialChain("default", "us-east-1").retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDENV", creds.accessKeyID)
+	assert.Equal(t, "envsecret", creds.secretAccessKey)
+	assert.Equal(t, "envtoken", creds.sessionToken)
+}
+
+func TestCredentialChainSharedCredentialsFile(t *testing.T) {
+	clearAWSEnvironment(t)
+	err := os.WriteFile(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), []byte(`
+# comment
+[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = defaultsecret
+
+[prod]
+aws_access_key_id=AKIDPROD
+aws_secret_access_key=prodsecret
+aws_session_token=prodtoken
+`), 0600)
+	assert.NoError(t, err)
+
+	creds, err := newDefaultCredentialChain("default", "us-east-1").retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDDEFAULT", creds.accessKeyID)
+
+	creds, err = newDefaultCredentialChain("prod", "us-east-1").retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, credentials{accessKeyID: "AKIDPROD", secretAccessKey: "prodsecret", sessionToken: "prodtoken"}, creds)
+}
+
+func TestCredentialChainNoCredentials(t *testing.T) {
+	clearAWSEnvironment(t)
+	_, err := newDefaultCredentialChain("default", "us-east-1").retrieve(context.Background())
+	assert.ErrorContains(t, err, "no AWS credentials found")
+}
+
+func TestCredentialChainWebIdentity(t *testing.T) {
+	clearAWSEnvironment(t)
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var form map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAWEB</AccessKeyId>
+      <SecretAccessKey>websecret</SecretAccessKey>
+      <SessionToken>webtoken</SessionToken>
+      <Expiration>` + expiration.Format(time.RFC3339) + `</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer server.Close()
+	defer func(old func(string) string) { stsEndpoint = old }(stsEndpoint)
+	stsEndpoint = func(region string) string { return server.URL }
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("oidc-token\n"), 0600))
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/app")
+	t.Setenv("AWS_ROLE_SESSION_NAME", "session")
+
+	chain := newDefaultCredentialChain("default", "us-east-1")
+	creds, err := chain.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, credentials{accessKeyID: "ASIAWEB", secretAccessKey: "websecret", sessionToken: "webtoken", expires: expiration}, creds)
+	assert.Equal(t, []string{"oidc-token"}, form["WebIdentityToken"])
+	assert.Equal(t, []string{"arn:aws:iam::123456789012:role/app"}, form["RoleArn"])
+	assert.Equal(t, []string{"session"}, form["RoleSessionName"])
+
+	form = nil
+	_, err = chain.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, form, "unexpired credentials should be cached")
+}
+
+func TestWebIdentityError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>Not authorized</Message></Error></ErrorResponse>`))
+	}))
+	defer server.Close()
+	defer func(old func(string) string) { stsEndpoint = old }(stsEndpoint)
+	stsEndpoint = func(region string) string { return server.URL }
+
+	_, err := assumeRoleWithWebIdentity(context.Background(), "us-east-1", "arn", "session", "token")
+	assert.EqualError(t, err, "awsiam: AssumeRoleWithWebIdentity failed: AccessDenied: Not authorized")
+}
@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// DriverName is the name used to register the driver
+const DriverName = "awsiam"
+
+var _ driver.DriverContext = &Driver{}
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// Driver wraps the underlying MSSQL driver, but replaces the password with an
+// AWS RDS IAM authentication token when the DSN sets awsiam=true.
+type Driver struct {
+}
+
+// Open returns a new connection to the database.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Connect(context.Background())
+}
+
+// OpenConnector satisfies driver.DriverContext so that sql.Open shares a
+// single Connector, and therefore its cached authentication token, across
+// all connections of the returned sql.DB.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	return NewConnector(dsn)
+}
+
+// NewConnector creates a new connector from a DSN.
+// The returned connector may be used with sql.OpenDB.
+func NewConnector(dsn string) (*mssql.Connector, error) {
+	config, err := parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newConnectorConfig(config)
+}
+
+// newConnectorConfig creates a Connector from config.
+func newConnectorConfig(config *awsIAMConfig) (*mssql.Connector, error) {
+	if !config.enabled {
+		return mssql.NewConnectorConfig(config.mssqlConfig), nil
+	}
+	tp := newTokenProvider(config, newDefaultCredentialChain(config.profile, config.region))
+	return mssql.NewPasswordProviderConnector(config.mssqlConfig, tp.token)
+}
@@ -0,0 +1,142 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	shortDateFormat  = "20060102"
+	// emptyPayloadHash is the SHA-256 of an empty request body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// presignRequest describes a GET request to be presigned with Signature
+// Version 4 using query string authentication.
+type presignRequest struct {
+	host        string
+	path        string
+	query       map[string]string
+	service     string
+	region      string
+	expires     time.Duration
+	payloadHash string
+	signTime    time.Time
+}
+
+// presign returns the canonical query string of the request including the
+// X-Amz-* authentication parameters and the signature.
+func presign(r presignRequest, creds credentials) string {
+	t := r.signTime.UTC()
+	amzDate := t.Format(amzDateFormat)
+	shortDate := t.Format(shortDateFormat)
+	scope := shortDate + "/" + r.region + "/" + r.service + "/aws4_request"
+
+	query := make(map[string]string, len(r.query)+6)
+	for k, v := range r.query {
+		query[k] = v
+	}
+	query["X-Amz-Algorithm"] = signingAlgorithm
+	query["X-Amz-Credential"] = creds.accessKeyID + "/" + scope
+	query["X-Amz-Date"] = amzDate
+	query["X-Amz-Expires"] = strconv.FormatInt(int64(r.expires/time.Second), 10)
+	query["X-Amz-SignedHeaders"] = "host"
+	if creds.sessionToken != "" {
+		query["X-Amz-Security-Token"] = creds.sessionToken
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	path := r.path
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		uriEncode(path, false),
+		canonicalQuery,
+		"host:" + r.host + "\n",
+		"host",
+		r.payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), shortDate)
+	key = hmacSHA256(key, r.region)
+	key = hmacSHA256(key, r.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+func canonicalQueryString(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, uriEncode(k, true))
+	}
+	encoded := make(map[string]string, len(query))
+	for k, v := range query {
+		encoded[uriEncode(k, true)] = uriEncode(v, true)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(encoded[k])
+	}
+	return b.String()
+}
+
+// uriEncode percent-encodes every byte except the RFC 3986 unreserved
+// characters, as required by Signature Version 4. Slashes are kept when
+// encoding a path.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
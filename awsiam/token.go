@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenLifetime is the validity of an RDS IAM authentication token.
+	tokenLifetime = 15 * time.Minute
+	// tokenRefreshMargin is how long before expiry a new token is generated,
+	// so a token is never presented right as it expires.
+	tokenRefreshMargin = time.Minute
+	rdsService         = "rds-db"
+)
+
+// tokenProvider generates RDS IAM authentication tokens for a single
+// endpoint and user and reuses them until they are close to expiry.
+type tokenProvider struct {
+	endpoint string
+	region   string
+	user     string
+	creds    credentialProvider
+
+	mu      sync.Mutex
+	cached  string
+	expires time.Time
+	now     func() time.Time
+}
+
+func newTokenProvider(config *awsIAMConfig, creds credentialProvider) *tokenProvider {
+	return &tokenProvider{
+		endpoint: config.endpoint,
+		region:   config.region,
+		user:     config.user,
+		creds:    creds,
+		now:      time.Now,
+	}
+}
+
+// token returns an authentication token to be sent as the login password.
+func (p *tokenProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if p.cached != "" && now.Add(tokenRefreshMargin).Before(p.expires) {
+		return p.cached, nil
+	}
+	creds, err := p.creds.retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.cached = buildAuthToken(p.endpoint, p.region, p.user, creds, now)
+	p.expires = now.Add(tokenLifetime)
+	if !creds.expires.IsZero() && creds.expires.Before(p.expires) {
+		p.expires = creds.expires
+	}
+	return p.cached, nil
+}
+
+// buildAuthToken returns the presigned rds-db:connect URL, without scheme,
+// that RDS accepts in place of a password.
+func buildAuthToken(endpoint, region, user string, creds credentials, signTime time.Time) string {
+	query := presign(presignRequest{
+		host:        endpoint,
+		path:        "/",
+		query:       map[string]string{"Action": "connect", "DBUser": user},
+		service:     rdsService,
+		region:      region,
+		expires:     tokenLifetime,
+		payloadHash: emptyPayloadHash,
+		signTime:    signTime,
+	}, creds)
+	return endpoint + "/?" + query
+}
@@ -0,0 +1,66 @@
+//go:build go1.18
+// +build go1.18
+
+package awsiam
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingProvider struct {
+	creds credentials
+	err   error
+	calls int
+}
+
+func (p *countingProvider) retrieve(ctx context.Context) (credentials, error) {
+	p.calls++
+	return p.creds, p.err
+}
+
+func TestTokenProviderCachesToken(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	creds := &countingProvider{creds: credentials{accessKeyID: "AKID", secretAccessKey: "secret"}}
+	tp := newTokenProvider(&awsIAMConfig{endpoint: "host:1433", region: "us-west-2", user: "admin"}, creds)
+	tp.now = func() time.Time { return now }
+
+	first, err := tp.token(context.Background())
+	assert.NoError(t, err)
+	now = now.Add(10 * time.Minute)
+	second, err := tp.token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, first, second, "token should be reused within its lifetime")
+	assert.Equal(t, 1, creds.calls)
+
+	now = now.Add(4*time.Minute + time.Second)
+	third, err := tp.token(context.Background())
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, third, "token close to expiry should be regenerated")
+	assert.Equal(t, 2, creds.calls)
+}
+
+func TestTokenProviderHonorsCredentialExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	creds := &countingProvider{creds: credentials{accessKeyID: "AKID", secretAccessKey: "secret", sessionToken: "tok", expires: now.Add(2 * time.Minute)}}
+	tp := newTokenProvider(&awsIAMConfig{endpoint: "host:1433", region: "us-west-2", user: "admin"}, creds)
+	tp.now = func() time.Time { return now }
+
+	_, err := tp.token(context.Background())
+	assert.NoError(t, err)
+	now = now.Add(90 * time.Second)
+	_, err = tp.token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, creds.calls, "token signed with expiring credentials should not outlive them")
+}
+
+func TestTokenProviderError(t *testing.T) {
+	creds := &countingProvider{err: errors.New("no creds")}
+	tp := newTokenProvider(&awsIAMConfig{endpoint: "host:1433", region: "us-west-2", user: "admin"}, creds)
+	_, err := tp.token(context.Background())
+	assert.EqualError(t, err, "no creds")
+}
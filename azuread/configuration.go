@@ -73,6 +73,9 @@ type azureFedAuthConfig struct {
 	disableInstanceDiscovery   bool     // For most credential types
 	tokenFilePath              string   // For WorkloadIdentity
 	sendCertificateChain       bool     // For ClientCertificate
+
+	// Explicit credential chain for ActiveDirectoryDefault
+	credentialChain []credentialChainSource
 }
 
 // parse returns a config based on an msdsn-style connection string
@@ -235,6 +238,10 @@ func (p *azureFedAuthConfig) validateParameters(params map[string]string) error
 	// Parse common credential options that apply to multiple auth types
 	p.parseCommonCredentialOptions(params)
 
+	if err := p.parseCredentialChain(fedAuthWorkflow, params); err != nil {
+		return err
+	}
+
 	p.fedAuthWorkflow = fedAuthWorkflow
 	return nil
 }
@@ -463,6 +470,10 @@ func (p *azureFedAuthConfig) provideActiveDirectoryToken(ctx context.Context, se
 			cred, err = azidentity.NewOnBehalfOfCredentialWithSecret(tenant, p.clientID, p.userAssertion, p.clientSecret, options)
 		}
 	default:
+		if len(p.credentialChain) > 0 {
+			cred = p.newChainedCredential()
+			break
+		}
 		// Integrated just uses Default until azidentity adds Windows-specific authentication
 		options := &azidentity.DefaultAzureCredentialOptions{
 			AdditionallyAllowedTenants: p.additionallyAllowedTenants,
@@ -0,0 +1,234 @@
+//go:build go1.18
+// +build go1.18
+
+package azuread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Credential names accepted by the credentialchain and credentialtimeout parameters.
+const (
+	CredentialEnvironment       = "environment"
+	CredentialWorkloadIdentity  = "workloadidentity"
+	CredentialManagedIdentity   = "managedidentity"
+	CredentialAzureCLI          = "azurecli"
+	CredentialAzureDeveloperCLI = "azuredevelopercli"
+)
+
+// defaultCredentialChain mirrors the order of azidentity's DefaultAzureCredential.
+// It is used when only credentialtimeout is provided.
+var defaultCredentialChain = []string{
+	CredentialEnvironment,
+	CredentialWorkloadIdentity,
+	CredentialManagedIdentity,
+	CredentialAzureCLI,
+	CredentialAzureDeveloperCLI,
+}
+
+// credentialChainSource is one entry of an explicit ActiveDirectoryDefault credential chain.
+type credentialChainSource struct {
+	name    string
+	timeout time.Duration
+}
+
+// parseCredentialChain reads the credentialchain and credentialtimeout parameters.
+//
+// credentialchain is a comma separated list of credential names tried in order.
+// credentialtimeout is a comma separated list of durations; an entry of the form
+// name:duration applies to a single credential and a bare duration applies to
+// every credential without its own entry.
+func (p *azureFedAuthConfig) parseCredentialChain(fedAuthWorkflow string, params map[string]string) error {
+	chain, hasChain := params["credentialchain"]
+	timeouts, hasTimeouts := params["credentialtimeout"]
+	if !hasChain && !hasTimeouts {
+		return nil
+	}
+	if !strings.EqualFold(fedAuthWorkflow, ActiveDirectoryDefault) {
+		return fmt.Errorf("credentialchain and credentialtimeout parameters are only supported with %s", ActiveDirectoryDefault)
+	}
+
+	names := defaultCredentialChain
+	if hasChain {
+		names = nil
+		seen := map[string]bool{}
+		for _, name := range strings.Split(chain, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !isCredentialChainName(name) {
+				return fmt.Errorf("Invalid credential '%s' in credentialchain: expected one of %+v", name, defaultCredentialChain)
+			}
+			if seen[name] {
+				return fmt.Errorf("Credential '%s' appears more than once in credentialchain", name)
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return errors.New("credentialchain parameter must name at least one credential")
+		}
+	}
+
+	var defaultTimeout time.Duration
+	perCredential := map[string]time.Duration{}
+	if hasTimeouts {
+		for _, entry := range strings.Split(timeouts, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			name, value, named := strings.Cut(entry, ":")
+			if !named {
+				value = name
+			}
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || d <= 0 {
+				return fmt.Errorf("Invalid credentialtimeout '%s': expected a positive duration such as 5s", entry)
+			}
+			if !named {
+				defaultTimeout = d
+				continue
+			}
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !isCredentialChainName(name) {
+				return fmt.Errorf("Invalid credential '%s' in credentialtimeout: expected one of %+v", name, defaultCredentialChain)
+			}
+			perCredential[name] = d
+		}
+	}
+
+	p.credentialChain = make([]credentialChainSource, len(names))
+	for i, name := range names {
+		timeout, ok := perCredential[name]
+		if !ok {
+			timeout = defaultTimeout
+		}
+		p.credentialChain[i] = credentialChainSource{name: name, timeout: timeout}
+	}
+
+	// The managed identity and workload identity credentials accept an optional
+	// client id, as they do for their dedicated fedauth values.
+	p.resourceID = params["resource id"]
+	if userID := params["user id"]; userID != "" {
+		p.clientID, p.tenantID = splitTenantAndClientID(userID)
+	}
+	return nil
+}
+
+func isCredentialChainName(name string) bool {
+	for _, n := range defaultCredentialChain {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newChainedCredential builds the credentials of the configured chain.
+// Credentials that cannot be constructed, for example an environment
+// credential without its environment variables, are reported when no
+// credential in the chain provides a token.
+func (p *azureFedAuthConfig) newChainedCredential() azcore.TokenCredential {
+	chain := &chainedCredential{}
+	for _, source := range p.credentialChain {
+		cred, err := p.newChainCredential(source.name)
+		chain.sources = append(chain.sources, chainedSource{
+			credentialChainSource: source,
+			cred:                  cred,
+			err:                   err,
+		})
+	}
+	return chain
+}
+
+func (p *azureFedAuthConfig) newChainCredential(name string) (azcore.TokenCredential, error) {
+	switch name {
+	case CredentialEnvironment:
+		return azidentity.NewEnvironmentCredential(&azidentity.EnvironmentCredentialOptions{
+			DisableInstanceDiscovery: p.disableInstanceDiscovery,
+		})
+	case CredentialWorkloadIdentity:
+		options := &azidentity.WorkloadIdentityCredentialOptions{
+			AdditionallyAllowedTenants: p.additionallyAllowedTenants,
+			DisableInstanceDiscovery:   p.disableInstanceDiscovery,
+			ClientID:                   p.clientID,
+			TenantID:                   p.tenantID,
+			TokenFilePath:              p.tokenFilePath,
+		}
+		return azidentity.NewWorkloadIdentityCredential(options)
+	case CredentialManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if p.resourceID != "" {
+			options.ID = azidentity.ResourceID(p.resourceID)
+		} else if p.clientID != "" {
+			options.ID = azidentity.ClientID(p.clientID)
+		}
+		return azidentity.NewManagedIdentityCredential(options)
+	case CredentialAzureCLI:
+		return azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{
+			TenantID:                   p.tenantID,
+			AdditionallyAllowedTenants: p.additionallyAllowedTenants,
+		})
+	case CredentialAzureDeveloperCLI:
+		return azidentity.NewAzureDeveloperCLICredential(&azidentity.AzureDeveloperCLICredentialOptions{
+			TenantID:                   p.tenantID,
+			AdditionallyAllowedTenants: p.additionallyAllowedTenants,
+		})
+	}
+	return nil, fmt.Errorf("unknown credential '%s'", name)
+}
+
+type chainedSource struct {
+	credentialChainSource
+	cred azcore.TokenCredential
+	// err is set when the credential could not be constructed
+	err error
+}
+
+// chainedCredential tries each credential in order and returns the first token
+// obtained. Unlike azidentity.ChainedTokenCredential it moves on to the next
+// credential after any failure, including a credential exceeding its timeout.
+type chainedCredential struct {
+	sources []chainedSource
+}
+
+func (c *chainedCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	failures := make([]string, 0, len(c.sources))
+	for _, s := range c.sources {
+		if s.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", s.name, s.err))
+			continue
+		}
+		tk, err := getTokenWithTimeout(ctx, s.cred, s.timeout, opts)
+		if err == nil {
+			return tk, nil
+		}
+		if ctx.Err() != nil {
+			return azcore.AccessToken{}, ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %v", s.timeout)
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", s.name, err))
+	}
+	return azcore.AccessToken{}, errors.New("no credential in credentialchain provided a token:\n\t" + strings.Join(failures, "\n\t"))
+}
+
+func getTokenWithTimeout(ctx context.Context, cred azcore.TokenCredential, timeout time.Duration, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if timeout <= 0 {
+		return cred.GetToken(ctx, opts)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return cred.GetToken(ctx, opts)
+}
@@ -0,0 +1,186 @@
+//go:build go1.18
+// +build go1.18
+
+package azuread
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCredentialChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		expected []credentialChainSource
+		clientID string
+		wantErr  string
+	}{
+		{
+			name:     "no chain",
+			dsn:      "server=someserver;fedauth=ActiveDirectoryDefault",
+			expected: nil,
+		},
+		{
+			name: "explicit order",
+			dsn:  "server=someserver;fedauth=ActiveDirectoryDefault;credentialchain=ManagedIdentity, workloadidentity,environment",
+			expected: []credentialChainSource{
+				{name: CredentialManagedIdentity},
+				{name: CredentialWorkloadIdentity},
+				{name: CredentialEnvironment},
+			},
+		},
+		{
+			name: "timeouts with default",
+			dsn:  "server=someserver;fedauth=ActiveDirectoryDefault;credentialchain=managedidentity,environment;credentialtimeout=10s,managedidentity:2s",
+			expected: []credentialChainSource{
+				{name: CredentialManagedIdentity, timeout: 2 * time.Second},
+				{name: CredentialEnvironment, timeout: 10 * time.Second},
+			},
+		},
+		{
+			name: "timeout only uses default order",
+			dsn:  "server=someserver;fedauth=ActiveDirectoryDefault;credentialtimeout=500ms",
+			expected: []credentialChainSource{
+				{name: CredentialEnvironment, timeout: 500 * time.Millisecond},
+				{name: CredentialWorkloadIdentity, timeout: 500 * time.Millisecond},
+				{name: CredentialManagedIdentity, timeout: 500 * time.Millisecond},
+				{name: CredentialAzureCLI, timeout: 500 * time.Millisecond},
+				{name: CredentialAzureDeveloperCLI, timeout: 500 * time.Millisecond},
+			},
+		},
+		{
+			name:     "user id is the managed identity client id",
+			dsn:      "server=someserver;fedauth=ActiveDirectoryDefault;credentialchain=managedidentity;user id=client-guid",
+			expected: []credentialChainSource{{name: CredentialManagedIdentity}},
+			clientID: "client-guid",
+		},
+		{
+			name:    "unknown credential",
+			dsn:     "server=someserver;fedauth=ActiveDirectoryDefault;credentialchain=managedidentity,browser",
+			wantErr: "Invalid credential 'browser' in credentialchain",
+		},
+		{
+			name:    "duplicate credential",
+			dsn:     "server=someserver;fedauth=ActiveDirectoryDefault;credentialchain=environment,environment",
+			wantErr: "more than once",
+		},
+		{
+			name:    "empty chain",
+			dsn:     "server=someserver;fedauth=ActiveDirectoryDefault;credentialchain=,",
+			wantErr: "at least one credential",
+		},
+		{
+			name:    "invalid timeout",
+			dsn:     "server=someserver;fedauth=ActiveDirectoryDefault;credentialtimeout=managedidentity:soon",
+			wantErr: "Invalid credentialtimeout",
+		},
+		{
+			name:    "unknown credential in timeout",
+			dsn:     "server=someserver;fedauth=ActiveDirectoryDefault;credentialtimeout=browser:1s",
+			wantErr: "Invalid credential 'browser' in credentialtimeout",
+		},
+		{
+			name:    "chain with other workflow",
+			dsn:     "server=someserver;fedauth=ActiveDirectoryMSI;credentialchain=managedidentity",
+			wantErr: "only supported with ActiveDirectoryDefault",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parse(tt.dsn)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, config.credentialChain)
+			assert.Equal(t, tt.clientID, config.clientID)
+		})
+	}
+}
+
+type fakeCredential struct {
+	token string
+	err   error
+	delay time.Duration
+	calls int
+}
+
+func (f *fakeCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	f.calls++
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return azcore.AccessToken{}, ctx.Err()
+		}
+	}
+	if f.err != nil {
+		return azcore.AccessToken{}, f.err
+	}
+	return azcore.AccessToken{Token: f.token}, nil
+}
+
+func TestChainedCredentialFallsThrough(t *testing.T) {
+	slow := &fakeCredential{token: "slow", delay: time.Minute}
+	failing := &fakeCredential{err: errors.New("not configured")}
+	working := &fakeCredential{token: "good"}
+	unused := &fakeCredential{token: "unused"}
+	chain := &chainedCredential{sources: []chainedSource{
+		{credentialChainSource: credentialChainSource{name: CredentialManagedIdentity, timeout: 10 * time.Millisecond}, cred: slow},
+		{credentialChainSource: credentialChainSource{name: CredentialEnvironment}, err: errors.New("missing environment variables")},
+		{credentialChainSource: credentialChainSource{name: CredentialWorkloadIdentity}, cred: failing},
+		{credentialChainSource: credentialChainSource{name: CredentialAzureCLI}, cred: working},
+		{credentialChainSource: credentialChainSource{name: CredentialAzureDeveloperCLI}, cred: unused},
+	}}
+
+	tk, err := chain.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"https://database.windows.net//.default"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "good", tk.Token)
+	assert.Equal(t, 1, slow.calls)
+	assert.Equal(t, 1, failing.calls)
+	assert.Equal(t, 0, unused.calls)
+}
+
+func TestChainedCredentialAllFail(t *testing.T) {
+	chain := &chainedCredential{sources: []chainedSource{
+		{credentialChainSource: credentialChainSource{name: CredentialManagedIdentity, timeout: 10 * time.Millisecond}, cred: &fakeCredential{delay: time.Minute}},
+		{credentialChainSource: credentialChainSource{name: CredentialEnvironment}, cred: &fakeCredential{err: errors.New("not configured")}},
+	}}
+	_, err := chain.GetToken(context.Background(), policy.TokenRequestOptions{})
+	assert.ErrorContains(t, err, "managedidentity: timed out after 10ms")
+	assert.ErrorContains(t, err, "environment: not configured")
+}
+
+func TestChainedCredentialParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	next := &fakeCredential{token: "next"}
+	chain := &chainedCredential{sources: []chainedSource{
+		{credentialChainSource: credentialChainSource{name: CredentialManagedIdentity}, cred: &fakeCredential{delay: time.Minute}},
+		{credentialChainSource: credentialChainSource{name: CredentialEnvironment}, cred: next},
+	}}
+	_, err := chain.GetToken(ctx, policy.TokenRequestOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, next.calls)
+}
+
+func TestNewChainedCredential(t *testing.T) {
+	t.Setenv("AZURE_CLIENT_ID", "")
+	t.Setenv("AZURE_TENANT_ID", "")
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	config, err := parse("server=someserver;fedauth=ActiveDirectoryDefault;credentialchain=environment,managedidentity")
+	assert.NoError(t, err)
+	chain := config.newChainedCredential().(*chainedCredential)
+	assert.Len(t, chain.sources, 2)
+	assert.Error(t, chain.sources[0].err, "environment credential without environment variables")
+	assert.NoError(t, chain.sources[1].err)
+	assert.NotNil(t, chain.sources[1].cred)
+}
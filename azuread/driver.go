@@ -14,6 +14,8 @@ import (
 // DriverName is the name used to register the driver
 const DriverName = "azuresql"
 
+var _ driver.DriverContext = &Driver{}
+
 func init() {
 	sql.Register(DriverName, &Driver{})
 }
@@ -32,6 +34,13 @@ func (d *Driver) Open(dsn string) (driver.Conn, error) {
 	return c.Connect(context.Background())
 }
 
+// OpenConnector satisfies driver.DriverContext so that sql.Open shares a
+// single Connector, and therefore its token cache, across all connections
+// of the returned sql.DB.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	return NewConnector(dsn)
+}
+
 // NewConnector creates a new connector from a DSN.
 // The returned connector may be used with sql.OpenDB.
 func NewConnector(dsn string) (*mssql.Connector, error) {
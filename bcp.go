@@ -0,0 +1,1149 @@
+package mssql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/internal/decimal"
+)
+
+// BCPFormat is a data file format of the bcp utility.
+type BCPFormat int
+
+const (
+	// BCPNative is the native format of bcp -n, where values are stored
+	// in their binary form.
+	BCPNative BCPFormat = iota
+	// BCPCharacter is the character format of bcp -c, where values are
+	// stored as text ended by the field or row terminator.
+	BCPCharacter
+)
+
+// BCPOptions configures ExportBCP and ImportBCP.
+type BCPOptions struct {
+	// BulkOptions are the options of the bulk copy of ImportBCP.
+	BulkOptions
+	// Format is the format of the data file when FormatFile is nil.
+	Format BCPFormat
+	// FormatFile describes the fields of the data file. When nil, the
+	// default format file of Format for the columns of the result set or of
+	// the table is used, as bcp does without -f.
+	FormatFile *BCPFormatFile
+	// FieldTerminator and RowTerminator end the fields of character data
+	// files without a format file. They default to "\t" and "\r\n".
+	FieldTerminator string
+	RowTerminator   string
+}
+
+// BCPFormatFile is an XML format file of the bcp utility. Its fields
+// describe the layout of each row of a data file, and its columns the
+// table or result set columns the fields are copied to or from.
+type BCPFormatFile struct {
+	Fields  []BCPField
+	Columns []BCPColumn
+}
+
+// BCPField is a FIELD element of the RECORD of a format file.
+type BCPField struct {
+	ID string
+	// Type is the xsi:type of the field: NativeFixed, NativePrefix,
+	// CharFixed, CharPrefix, CharTerm, NCharFixed, NCharPrefix or NCharTerm.
+	// Native fields hold values in their binary form, Char fields hold text
+	// and NChar fields hold UTF-16 text.
+	Type string
+	// Length is the size of fixed fields.
+	Length int
+	// PrefixLength is the size of the length prefix of prefix fields, 1, 2,
+	// 4 or 8. A prefix of all 0xFF bytes is NULL.
+	PrefixLength int
+	MaxLength    int
+	// Terminator ends terminated fields. Empty terminated fields are NULL
+	// and a field holding a single NUL character is an empty string.
+	Terminator string
+	Collation  string
+}
+
+// BCPColumn is a COLUMN element of the ROW of a format file.
+type BCPColumn struct {
+	// Source is the ID of the field of the column.
+	Source string
+	Name   string
+	// Type is the xsi:type of the column, such as SQLINT or SQLNVARCHAR.
+	Type      string
+	Precision int
+	Scale     int
+	Nullable  bool
+}
+
+const (
+	bcpFormatNamespace = "http://schemas.microsoft.com/sqlserver/2004/bulkload/format"
+	xsiNamespace       = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// bcpFixedLength is the size of the native values of the fixed size types.
+var bcpFixedLength = map[string]int{
+	"SQLTINYINT":  1,
+	"SQLSMALLINT": 2,
+	"SQLINT":      4,
+	"SQLBIGINT":   8,
+	"SQLBIT":      1,
+	"SQLFLT4":     4,
+	"SQLFLT8":     8,
+	"SQLMONEY4":   4,
+	"SQLMONEY":    8,
+	"SQLDATETIM4": 4,
+	"SQLDATETIME": 8,
+	"SQLDECIMAL":  19,
+	"SQLNUMERIC":  19,
+	"SQLUNIQUEID": 16,
+}
+
+// bcpVarTypes are the column types of variable size values.
+var bcpVarTypes = map[string]bool{
+	"SQLDATE":           true,
+	"SQLTIME":           true,
+	"SQLDATETIME2":      true,
+	"SQLDATETIMEOFFSET": true,
+	"SQLCHAR":           true,
+	"SQLVARYCHAR":       true,
+	"SQLTEXT":           true,
+	"SQLNCHAR":          true,
+	"SQLNVARCHAR":       true,
+	"SQLNTEXT":          true,
+	"SQLBINARY":         true,
+	"SQLVARYBIN":        true,
+	"SQLIMAGE":          true,
+}
+
+// bcpFormatXML is the XML form of a format file. Attributes are read as
+// text so that missing ones can be told apart from zero.
+type bcpFormatXML struct {
+	XMLName xml.Name `xml:"BCPFORMAT"`
+	Fields  []struct {
+		ID           string `xml:"ID,attr"`
+		Type         string `xml:"type,attr"`
+		Length       string `xml:"LENGTH,attr"`
+		PrefixLength string `xml:"PREFIX_LENGTH,attr"`
+		MaxLength    string `xml:"MAX_LENGTH,attr"`
+		Terminator   string `xml:"TERMINATOR,attr"`
+		Collation    string `xml:"COLLATION,attr"`
+	} `xml:"RECORD>FIELD"`
+	Columns []struct {
+		Source    string `xml:"SOURCE,attr"`
+		Name      string `xml:"NAME,attr"`
+		Type      string `xml:"type,attr"`
+		Precision string `xml:"PRECISION,attr"`
+		Scale     string `xml:"SCALE,attr"`
+		Nullable  string `xml:"NULLABLE,attr"`
+	} `xml:"ROW>COLUMN"`
+}
+
+// ParseBCPFormatFile reads an XML format file of the bcp utility.
+func ParseBCPFormatFile(r io.Reader) (*BCPFormatFile, error) {
+	var x bcpFormatXML
+	if err := xml.NewDecoder(r).Decode(&x); err != nil {
+		return nil, fmt.Errorf("mssql: invalid format file: %v", err)
+	}
+	var f BCPFormatFile
+	atoi := func(s string, def int) (int, error) {
+		if s == "" {
+			return def, nil
+		}
+		return strconv.Atoi(s)
+	}
+	var err error
+	for _, xf := range x.Fields {
+		field := BCPField{ID: xf.ID, Type: xf.Type, Collation: xf.Collation}
+		field.Terminator, err = unescapeBCPTerminator(xf.Terminator)
+		if err == nil {
+			field.Length, err = atoi(xf.Length, 0)
+		}
+		if err == nil {
+			field.PrefixLength, err = atoi(xf.PrefixLength, 0)
+		}
+		if err == nil {
+			field.MaxLength, err = atoi(xf.MaxLength, 0)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mssql: invalid format file field %s: %v", xf.ID, err)
+		}
+		f.Fields = append(f.Fields, field)
+	}
+	for _, xc := range x.Columns {
+		col := BCPColumn{Source: xc.Source, Name: xc.Name, Type: xc.Type, Nullable: xc.Nullable != "NO"}
+		col.Precision, err = atoi(xc.Precision, 0)
+		if err == nil {
+			col.Scale, err = atoi(xc.Scale, bcpDefaultScale(xc.Type))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mssql: invalid format file column %s: %v", xc.Name, err)
+		}
+		f.Columns = append(f.Columns, col)
+	}
+	if _, err = f.fields(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// bcpDefaultScale is the scale of the columns of a format file without a
+// SCALE attribute.
+func bcpDefaultScale(typ string) int {
+	switch typ {
+	case "SQLTIME", "SQLDATETIME2", "SQLDATETIMEOFFSET":
+		return 7
+	}
+	return 0
+}
+
+// WriteTo writes the format file as XML.
+func (f *BCPFormatFile) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	attr := func(name, value string) {
+		buf.WriteString(" " + name + `="`)
+		xml.EscapeText(&buf, []byte(value))
+		buf.WriteByte('"')
+	}
+	intAttr := func(name string, value int) {
+		if value != 0 {
+			attr(name, strconv.Itoa(value))
+		}
+	}
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<BCPFORMAT xmlns="` + bcpFormatNamespace + `" xmlns:xsi="` + xsiNamespace + `">` + "\n")
+	buf.WriteString(" <RECORD>\n")
+	for _, field := range f.Fields {
+		buf.WriteString("  <FIELD")
+		attr("ID", field.ID)
+		attr("xsi:type", field.Type)
+		intAttr("LENGTH", field.Length)
+		intAttr("PREFIX_LENGTH", field.PrefixLength)
+		intAttr("MAX_LENGTH", field.MaxLength)
+		if field.Terminator != "" {
+			attr("TERMINATOR", escapeBCPTerminator(field.Terminator))
+		}
+		if field.Collation != "" {
+			attr("COLLATION", field.Collation)
+		}
+		buf.WriteString("/>\n")
+	}
+	buf.WriteString(" </RECORD>\n <ROW>\n")
+	for _, col := range f.Columns {
+		buf.WriteString("  <COLUMN")
+		attr("SOURCE", col.Source)
+		attr("NAME", col.Name)
+		attr("xsi:type", col.Type)
+		intAttr("PRECISION", col.Precision)
+		switch col.Type {
+		case "SQLDECIMAL", "SQLNUMERIC", "SQLTIME", "SQLDATETIME2", "SQLDATETIMEOFFSET":
+			attr("SCALE", strconv.Itoa(col.Scale))
+		}
+		if col.Nullable {
+			attr("NULLABLE", "YES")
+		} else {
+			attr("NULLABLE", "NO")
+		}
+		buf.WriteString("/>\n")
+	}
+	buf.WriteString(" </ROW>\n</BCPFORMAT>\n")
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+var bcpTerminatorEscapes = strings.NewReplacer("\\", `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+func escapeBCPTerminator(s string) string {
+	return bcpTerminatorEscapes.Replace(s)
+}
+
+// unescapeBCPTerminator decodes the \t, \n, \r, \0 and \\ escapes of the
+// terminators of format files.
+func unescapeBCPTerminator(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", fmt.Errorf("invalid terminator %q", s)
+		}
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			return "", fmt.Errorf("invalid terminator %q", s)
+		}
+	}
+	return b.String(), nil
+}
+
+// bcpField is a field of a data file with its column.
+type bcpField struct {
+	*BCPField
+	// data is Native, Char or NChar and layout is Fixed, Prefix or Term.
+	data   string
+	layout string
+	term   []byte
+	// column is the index of the column of the field, or -1 when the field
+	// is skipped.
+	column int
+}
+
+// fields checks the format file and returns its fields in data file order.
+func (f *BCPFormatFile) fields() ([]bcpField, error) {
+	fields := make([]bcpField, len(f.Fields))
+	ids := make(map[string]int, len(f.Fields))
+	for i := range f.Fields {
+		field := &f.Fields[i]
+		bf := bcpField{BCPField: field, column: -1}
+		for _, data := range []string{"NChar", "Native", "Char"} {
+			if layout, ok := strings.CutPrefix(field.Type, data); ok {
+				bf.data, bf.layout = data, layout
+				break
+			}
+		}
+		switch {
+		case bf.layout == "Fixed" && field.Length <= 0:
+			return nil, fmt.Errorf("mssql: format file field %s has no LENGTH", field.ID)
+		case bf.layout == "Prefix":
+			switch field.PrefixLength {
+			case 1, 2, 4, 8:
+			default:
+				return nil, fmt.Errorf("mssql: format file field %s has an invalid PREFIX_LENGTH %d", field.ID, field.PrefixLength)
+			}
+		case bf.layout == "Term" && bf.data != "Native":
+			if field.Terminator == "" {
+				return nil, fmt.Errorf("mssql: format file field %s has no TERMINATOR", field.ID)
+			}
+		case bf.layout == "Fixed":
+		default:
+			return nil, fmt.Errorf("mssql: format file field %s has an unknown type %q", field.ID, field.Type)
+		}
+		if bf.data == "NChar" {
+			bf.term = str2ucs2(field.Terminator)
+		} else {
+			bf.term = []byte(field.Terminator)
+		}
+		if _, ok := ids[field.ID]; ok {
+			return nil, fmt.Errorf("mssql: format file field %s is defined twice", field.ID)
+		}
+		ids[field.ID] = i
+		fields[i] = bf
+	}
+	for i, col := range f.Columns {
+		j, ok := ids[col.Source]
+		if !ok {
+			return nil, fmt.Errorf("mssql: format file column %s has no field %s", col.Name, col.Source)
+		}
+		if fields[j].column >= 0 {
+			return nil, fmt.Errorf("mssql: format file field %s is used by two columns", col.Source)
+		}
+		if bcpFixedLength[col.Type] == 0 && !bcpVarTypes[col.Type] {
+			return nil, fmt.Errorf("mssql: format file column %s has an unsupported type %q", col.Name, col.Type)
+		}
+		if col.Scale < 0 || col.Scale > 7 && bcpDefaultScale(col.Type) == 7 {
+			return nil, fmt.Errorf("mssql: format file column %s has an invalid SCALE %d", col.Name, col.Scale)
+		}
+		fields[j].column = i
+	}
+	return fields, nil
+}
+
+// newBCPFormatFile returns the format file bcp uses without -f for cols.
+func newBCPFormatFile(cols []columnStruct, opts BCPOptions) (*BCPFormatFile, error) {
+	fieldTerm, rowTerm := opts.FieldTerminator, opts.RowTerminator
+	if fieldTerm == "" {
+		fieldTerm = "\t"
+	}
+	if rowTerm == "" {
+		rowTerm = "\r\n"
+	}
+	f := &BCPFormatFile{}
+	for i, c := range cols {
+		typ, err := bcpColumnType(c.ti)
+		if err != nil {
+			return nil, fmt.Errorf("mssql: column %s: %v", c.ColName, err)
+		}
+		id := strconv.Itoa(i + 1)
+		col := BCPColumn{Source: id, Name: c.ColName, Type: typ, Nullable: c.Flags&colFlagNullable != 0}
+		switch typ {
+		case "SQLDECIMAL", "SQLNUMERIC":
+			col.Precision, col.Scale = int(c.ti.Prec), int(c.ti.Scale)
+		case "SQLTIME", "SQLDATETIME2", "SQLDATETIMEOFFSET":
+			col.Scale = int(c.ti.Scale)
+		}
+
+		field := BCPField{ID: id}
+		isMax := c.ti.Size > 8000 || c.ti.Size == 0
+		switch {
+		case opts.Format == BCPCharacter:
+			field.Type = "CharTerm"
+			field.Terminator = fieldTerm
+			if i == len(cols)-1 {
+				field.Terminator = rowTerm
+			}
+			if bcpVarTypes[typ] && !isMax {
+				field.MaxLength = c.ti.Size
+			}
+		case bcpFixedLength[typ] > 0 && !col.Nullable:
+			field.Type = "NativeFixed"
+			field.Length = bcpFixedLength[typ]
+		case bcpFixedLength[typ] > 0, typ == "SQLDATE", typ == "SQLTIME", typ == "SQLDATETIME2", typ == "SQLDATETIMEOFFSET":
+			field.Type = "NativePrefix"
+			field.PrefixLength = 1
+		default:
+			switch typ {
+			case "SQLCHAR", "SQLVARYCHAR", "SQLTEXT":
+				field.Type = "CharPrefix"
+			case "SQLNCHAR", "SQLNVARCHAR", "SQLNTEXT":
+				field.Type = "NCharPrefix"
+			default:
+				field.Type = "NativePrefix"
+			}
+			switch {
+			case typ == "SQLTEXT" || typ == "SQLNTEXT" || typ == "SQLIMAGE":
+				field.PrefixLength = 4
+			case isMax:
+				field.PrefixLength = 8
+			default:
+				field.PrefixLength = 2
+				field.MaxLength = c.ti.Size
+			}
+		}
+		f.Fields = append(f.Fields, field)
+		f.Columns = append(f.Columns, col)
+	}
+	return f, nil
+}
+
+// bcpColumnType returns the format file type of a column.
+func bcpColumnType(ti typeInfo) (string, error) {
+	switch ti.TypeId {
+	case typeInt1:
+		return "SQLTINYINT", nil
+	case typeInt2:
+		return "SQLSMALLINT", nil
+	case typeInt4:
+		return "SQLINT", nil
+	case typeInt8:
+		return "SQLBIGINT", nil
+	case typeIntN:
+		switch ti.Size {
+		case 1:
+			return "SQLTINYINT", nil
+		case 2:
+			return "SQLSMALLINT", nil
+		case 4:
+			return "SQLINT", nil
+		case 8:
+			return "SQLBIGINT", nil
+		}
+	case typeBit, typeBitN:
+		return "SQLBIT", nil
+	case typeFlt4:
+		return "SQLFLT4", nil
+	case typeFlt8:
+		return "SQLFLT8", nil
+	case typeFltN:
+		if ti.Size == 4 {
+			return "SQLFLT4", nil
+		}
+		return "SQLFLT8", nil
+	case typeMoney4:
+		return "SQLMONEY4", nil
+	case typeMoney:
+		return "SQLMONEY", nil
+	case typeMoneyN:
+		if ti.Size == 4 {
+			return "SQLMONEY4", nil
+		}
+		return "SQLMONEY", nil
+	case typeDateTim4:
+		return "SQLDATETIM4", nil
+	case typeDateTime:
+		return "SQLDATETIME", nil
+	case typeDateTimeN:
+		if ti.Size == 4 {
+			return "SQLDATETIM4", nil
+		}
+		return "SQLDATETIME", nil
+	case typeDecimal, typeDecimalN:
+		return "SQLDECIMAL", nil
+	case typeNumeric, typeNumericN:
+		return "SQLNUMERIC", nil
+	case typeDateN:
+		return "SQLDATE", nil
+	case typeTimeN:
+		return "SQLTIME", nil
+	case typeDateTime2N:
+		return "SQLDATETIME2", nil
+	case typeDateTimeOffsetN:
+		return "SQLDATETIMEOFFSET", nil
+	case typeGuid:
+		return "SQLUNIQUEID", nil
+	case typeChar, typeBigChar:
+		return "SQLCHAR", nil
+	case typeVarChar, typeBigVarChar:
+		return "SQLVARYCHAR", nil
+	case typeText:
+		return "SQLTEXT", nil
+	case typeNChar:
+		return "SQLNCHAR", nil
+	case typeNVarChar:
+		return "SQLNVARCHAR", nil
+	case typeNText:
+		return "SQLNTEXT", nil
+	case typeBinary, typeBigBinary:
+		return "SQLBINARY", nil
+	case typeVarBinary, typeBigVarBin:
+		return "SQLVARYBIN", nil
+	case typeImage:
+		return "SQLIMAGE", nil
+	}
+	return "", fmt.Errorf("type %#x is not supported by bcp files", ti.TypeId)
+}
+
+// ExportBCP runs query and writes its result set to w as a bcp data file,
+// like bcp queryout. The file is written with opts.FormatFile, whose
+// columns are matched to the columns of the result set by position, or
+// with the default format file of opts.Format, which is returned so that
+// it can be saved next to the data file.
+//
+// Character data is written as UTF-8. Binary values of character fields
+// are written as hexadecimal.
+func (c *Conn) ExportBCP(ctx context.Context, w io.Writer, query string, opts BCPOptions, args ...interface{}) (rowCount int64, format *BCPFormatFile, err error) {
+	stmt, err := c.prepareContext(ctx, query)
+	if err != nil {
+		return 0, nil, err
+	}
+	namedArgs := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		namedArgs[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+		if named, ok := arg.(sql.NamedArg); ok {
+			namedArgs[i].Name, namedArgs[i].Value = named.Name, named.Value
+		}
+	}
+	drows, err := stmt.QueryContext(ctx, namedArgs)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer drows.Close()
+	rows := drows.(*Rows)
+
+	format = opts.FormatFile
+	if format == nil {
+		if format, err = newBCPFormatFile(rows.cols, opts); err != nil {
+			return 0, nil, err
+		}
+	}
+	fields, err := format.fields()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(format.Columns) != len(rows.cols) {
+		return 0, nil, fmt.Errorf("mssql: the format file has %d columns but the result set has %d", len(format.Columns), len(rows.cols))
+	}
+	bw := &bcpWriter{w: bufio.NewWriter(w), fields: fields, columns: format.Columns, loc: getTimezone(c)}
+	values := make([]driver.Value, len(rows.cols))
+	for {
+		if err = rows.Next(values); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return rowCount, format, err
+		}
+		for i, col := range rows.cols {
+			// Restore the byte order of the data file.
+			if v, ok := values[i].([]byte); ok && col.ti.TypeId == typeGuid {
+				values[i] = decodeGuid(v, c.sess.encoding)
+			}
+		}
+		if err = bw.writeRow(values); err != nil {
+			return rowCount, format, fmt.Errorf("mssql: row %d: %v", rowCount+1, err)
+		}
+		rowCount++
+	}
+	return rowCount, format, bw.w.Flush()
+}
+
+// ImportBCP bulk copies the rows of a bcp data file to table, like bcp in.
+// The file is read with opts.FormatFile, whose columns name the destination
+// columns, or with the default format file of opts.Format for the columns of
+// the table. Computed columns are skipped by the default format file.
+//
+// ImportBCP returns the number of rows copied. When a row cannot be read the
+// copy stops, and the rows sent before it are kept unless the copy runs in
+// a transaction that is rolled back.
+func (c *Conn) ImportBCP(ctx context.Context, table string, r io.Reader, opts BCPOptions) (int64, error) {
+	b := c.CreateBulkContext(ctx, table, nil)
+	b.Options = opts.BulkOptions
+	format := opts.FormatFile
+	if format == nil {
+		if err := b.getMetadata(ctx); err != nil {
+			return 0, err
+		}
+		f, err := newBCPFormatFile(b.metadata, opts)
+		if err != nil {
+			return 0, err
+		}
+		columns := f.Columns[:0]
+		for i, col := range f.Columns {
+			if b.metadata[i].Flags&colFlagComputed == 0 {
+				columns = append(columns, col)
+			}
+		}
+		f.Columns = columns
+		format = f
+	}
+	fields, err := format.fields()
+	if err != nil {
+		return 0, err
+	}
+	for _, col := range format.Columns {
+		b.columnsName = append(b.columnsName, col.Name)
+	}
+	if err = b.sendBulkCommand(ctx); err != nil {
+		return 0, err
+	}
+
+	br := &bcpReader{r: bufio.NewReader(r), fields: fields}
+	loc := getTimezone(c)
+	data := make([][]byte, len(fields))
+	row := make([]interface{}, len(format.Columns))
+	for n := 1; ; n++ {
+		if err = br.readRow(data); err != nil {
+			if err == io.EOF {
+				err = nil
+			} else {
+				err = fmt.Errorf("mssql: bcp row %d: %v", n, err)
+			}
+			break
+		}
+		for i, f := range fields {
+			if f.column < 0 {
+				continue
+			}
+			col := &format.Columns[f.column]
+			if row[f.column], err = bcpImportValue(f, col, &b.bulkColumns[f.column], data[i], loc); err != nil {
+				err = fmt.Errorf("mssql: bcp row %d column %s: %v", n, col.Name, err)
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+		var rowData []byte
+		if rowData, err = b.makeRowData(row); err != nil {
+			break
+		}
+		if err = b.writeRow(ctx, rowData); err != nil {
+			break
+		}
+	}
+	rowCount, doneErr := b.DoneContext(ctx)
+	if err == nil {
+		err = doneErr
+	}
+	return rowCount, err
+}
+
+// bcpWriter writes the rows of a data file.
+type bcpWriter struct {
+	w       *bufio.Writer
+	fields  []bcpField
+	columns []BCPColumn
+	loc     *time.Location
+}
+
+func (bw *bcpWriter) writeRow(values []driver.Value) error {
+	for _, f := range bw.fields {
+		if f.column < 0 {
+			return fmt.Errorf("format file field %s has no column", f.ID)
+		}
+		col := &bw.columns[f.column]
+		if err := bw.writeField(f, col, values[f.column]); err != nil {
+			return fmt.Errorf("column %s: %v", col.Name, err)
+		}
+	}
+	return nil
+}
+
+func (bw *bcpWriter) writeField(f bcpField, col *BCPColumn, v driver.Value) error {
+	var data []byte
+	if v != nil {
+		switch f.data {
+		case "Native":
+			var err error
+			if data, err = bcpNativeBytes(v, col, bw.loc); err != nil {
+				return err
+			}
+		default:
+			s, err := bcpText(v, col)
+			if err != nil {
+				return err
+			}
+			if s == "" && f.layout == "Term" {
+				s = "\x00"
+			}
+			if f.data == "NChar" {
+				data = str2ucs2(s)
+			} else {
+				data = []byte(s)
+			}
+		}
+	}
+	switch f.layout {
+	case "Fixed":
+		if v == nil {
+			return errors.New("NULL in a fixed length field")
+		}
+		if len(data) > f.Length || f.data == "Native" && len(data) != f.Length {
+			return fmt.Errorf("value of %d bytes in a field of %d bytes", len(data), f.Length)
+		}
+		bw.w.Write(data)
+		for i := len(data); i < f.Length; i++ {
+			bw.w.WriteByte(' ')
+		}
+	case "Prefix":
+		var prefix [8]byte
+		if v == nil {
+			binary.LittleEndian.PutUint64(prefix[:], math.MaxUint64)
+		} else {
+			binary.LittleEndian.PutUint64(prefix[:], uint64(len(data)))
+			if f.PrefixLength < 8 && len(data) >= 1<<(8*f.PrefixLength)-1 {
+				return fmt.Errorf("value of %d bytes in a field with a %d bytes prefix", len(data), f.PrefixLength)
+			}
+		}
+		bw.w.Write(prefix[:f.PrefixLength])
+		bw.w.Write(data)
+	case "Term":
+		if bytes.Contains(data, f.term) {
+			return errors.New("value contains the terminator")
+		}
+		bw.w.Write(data)
+	}
+	_, err := bw.w.Write(f.term)
+	return err
+}
+
+// bcpReader reads the rows of a data file.
+type bcpReader struct {
+	r      *bufio.Reader
+	fields []bcpField
+}
+
+// readRow reads the fields of a row, nil for NULL. It returns io.EOF at the
+// end of the file.
+func (br *bcpReader) readRow(data [][]byte) error {
+	for i, f := range br.fields {
+		var err error
+		data[i], err = br.readField(f)
+		if err == io.EOF && i > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (br *bcpReader) readField(f bcpField) ([]byte, error) {
+	var data []byte
+	switch f.layout {
+	case "Fixed":
+		data = make([]byte, f.Length)
+		if err := br.readFull(data); err != nil {
+			return nil, err
+		}
+	case "Prefix":
+		var prefix [8]byte
+		if err := br.readFull(prefix[:f.PrefixLength]); err != nil {
+			return nil, err
+		}
+		n := binary.LittleEndian.Uint64(prefix[:])
+		if n == math.MaxUint64>>(64-8*f.PrefixLength) {
+			return nil, br.readTerm(f)
+		}
+		if n > math.MaxInt32 {
+			return nil, fmt.Errorf("field %s is too long: %d bytes", f.ID, n)
+		}
+		data = make([]byte, n)
+		if err := br.readFull(data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	case "Term":
+		var err error
+		if data, err = br.readTerminated(f.term, f.data == "NChar"); err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, nil
+		}
+		return data, nil
+	}
+	return data, br.readTerm(f)
+}
+
+// readTerm reads the terminator of a fixed or prefix field.
+func (br *bcpReader) readTerm(f bcpField) error {
+	if len(f.term) == 0 {
+		return nil
+	}
+	term := make([]byte, len(f.term))
+	if err := br.readFull(term); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if !bytes.Equal(term, f.term) {
+		return fmt.Errorf("field %s is not followed by its terminator", f.ID)
+	}
+	return nil
+}
+
+// readFull reads len(buf) bytes, returning io.EOF only when none could be
+// read.
+func (br *bcpReader) readFull(buf []byte) error {
+	_, err := io.ReadFull(br.r, buf)
+	return err
+}
+
+// readTerminated reads the data of a field up to its terminator. UTF-16
+// terminators only match at even offsets.
+func (br *bcpReader) readTerminated(term []byte, utf16 bool) ([]byte, error) {
+	var data []byte
+	last := term[len(term)-1]
+	for {
+		chunk, err := br.r.ReadSlice(last)
+		data = append(data, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(data) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if n := len(data) - len(term); n >= 0 && bytes.Equal(data[n:], term) && (!utf16 || n%2 == 0) {
+			return data[:n], nil
+		}
+	}
+}
+
+// bcpImportValue converts the data of a field to a value Bulk.makeParam
+// accepts for the destination column dest.
+func bcpImportValue(f bcpField, col *BCPColumn, dest *columnStruct, data []byte, loc *time.Location) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var s string
+	switch f.data {
+	case "Native":
+		return bcpNativeValue(data, col, loc)
+	case "NChar":
+		var err error
+		if s, err = ucs22str(data); err != nil {
+			return nil, err
+		}
+	default:
+		s = string(data)
+	}
+	if s == "\x00" && f.layout == "Term" {
+		s = ""
+	}
+	return bulkTextValue(s, dest, BinaryHex, loc)
+}
+
+// bcpNativeValue decodes the native data of a column.
+func bcpNativeValue(data []byte, col *BCPColumn, loc *time.Location) (interface{}, error) {
+	if n := bcpFixedLength[col.Type]; n > 0 && len(data) != n {
+		return nil, fmt.Errorf("invalid length %d for %s", len(data), col.Type)
+	}
+	switch col.Type {
+	case "SQLTINYINT":
+		return int64(data[0]), nil
+	case "SQLSMALLINT":
+		return int64(int16(binary.LittleEndian.Uint16(data))), nil
+	case "SQLINT":
+		return int64(int32(binary.LittleEndian.Uint32(data))), nil
+	case "SQLBIGINT":
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case "SQLBIT":
+		return data[0] != 0, nil
+	case "SQLFLT4":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), nil
+	case "SQLFLT8":
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case "SQLMONEY4":
+		return string(decodeMoney4(data)), nil
+	case "SQLMONEY":
+		return string(decodeMoney(data)), nil
+	case "SQLDECIMAL", "SQLNUMERIC":
+		// precision, scale, sign and a 16 bytes little endian integer
+		return string(decodeDecimal(data[0], data[1], data[2:])), nil
+	case "SQLDATETIM4":
+		return decodeDateTim4(data, loc), nil
+	case "SQLDATETIME":
+		return decodeDateTime(data, loc), nil
+	case "SQLDATE":
+		if len(data) != 3 {
+			return nil, fmt.Errorf("invalid length %d for %s", len(data), col.Type)
+		}
+		return decodeDate(data, loc), nil
+	case "SQLTIME":
+		if len(data) != bcpTimeLength(col.Scale) {
+			return nil, fmt.Errorf("invalid length %d for %s", len(data), col.Type)
+		}
+		return decodeTime(uint8(col.Scale), data, loc), nil
+	case "SQLDATETIME2":
+		if len(data) != bcpTimeLength(col.Scale)+3 {
+			return nil, fmt.Errorf("invalid length %d for %s", len(data), col.Type)
+		}
+		return decodeDateTime2(uint8(col.Scale), data, loc), nil
+	case "SQLDATETIMEOFFSET":
+		if len(data) != bcpTimeLength(col.Scale)+5 {
+			return nil, fmt.Errorf("invalid length %d for %s", len(data), col.Type)
+		}
+		return decodeDateTimeOffset(uint8(col.Scale), data), nil
+	case "SQLCHAR", "SQLVARYCHAR", "SQLTEXT":
+		return string(data), nil
+	case "SQLNCHAR", "SQLNVARCHAR", "SQLNTEXT":
+		return ucs22str(data)
+	}
+	// uniqueidentifier in the byte order of the wire, and binary data
+	return data, nil
+}
+
+// bcpTimeLength is the size of the time part of a native value.
+func bcpTimeLength(scale int) int {
+	switch {
+	case scale <= 2:
+		return 3
+	case scale <= 4:
+		return 4
+	}
+	return 5
+}
+
+// bcpNativeBytes encodes a value of a column in its native form.
+func bcpNativeBytes(v driver.Value, col *BCPColumn, loc *time.Location) ([]byte, error) {
+	switch col.Type {
+	case "SQLTINYINT", "SQLSMALLINT", "SQLINT", "SQLBIGINT":
+		var n int64
+		switch v := v.(type) {
+		case int64:
+			n = v
+		case bool:
+			if v {
+				n = 1
+			}
+		default:
+			return nil, fmt.Errorf("invalid value %T for %s", v, col.Type)
+		}
+		size := bcpFixedLength[col.Type]
+		buf := make([]byte, size)
+		return buf, putBulkInt(buf, columnStruct{ti: typeInfo{Size: size}}, n)
+	case "SQLBIT":
+		switch v := v.(type) {
+		case bool:
+			if v {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		case int64:
+			if v != 0 {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		}
+	case "SQLFLT4", "SQLFLT8":
+		var f float64
+		switch v := v.(type) {
+		case float64:
+			f = v
+		case float32:
+			f = float64(v)
+		case int64:
+			f = float64(v)
+		default:
+			return nil, fmt.Errorf("invalid value %T for %s", v, col.Type)
+		}
+		if col.Type == "SQLFLT4" {
+			return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(f))), nil
+		}
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)), nil
+	case "SQLMONEY4", "SQLMONEY", "SQLDECIMAL", "SQLNUMERIC":
+		s, err := bcpText(v, col)
+		if err != nil {
+			return nil, err
+		}
+		if col.Type == "SQLDECIMAL" || col.Type == "SQLNUMERIC" {
+			return bcpDecimal(s, col.Precision, col.Scale)
+		}
+		return bcpMoney(s, bcpFixedLength[col.Type])
+	case "SQLDATETIM4", "SQLDATETIME", "SQLDATE", "SQLTIME", "SQLDATETIME2", "SQLDATETIMEOFFSET":
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("invalid value %T for %s", v, col.Type)
+		}
+		switch col.Type {
+		case "SQLDATETIM4":
+			return encodeDateTim4(t, loc), nil
+		case "SQLDATETIME":
+			return encodeDateTime(t), nil
+		case "SQLDATE":
+			return encodeDate(t), nil
+		case "SQLTIME":
+			return encodeTime(t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), col.Scale), nil
+		case "SQLDATETIME2":
+			return encodeDateTime2(t, col.Scale), nil
+		}
+		return encodeDateTimeOffset(t, col.Scale), nil
+	case "SQLCHAR", "SQLVARYCHAR", "SQLTEXT", "SQLNCHAR", "SQLNVARCHAR", "SQLNTEXT":
+		s, err := bcpText(v, col)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(col.Type, "SQLN") {
+			return str2ucs2(s), nil
+		}
+		return []byte(s), nil
+	case "SQLUNIQUEID":
+		if b, ok := v.([]byte); ok && len(b) == 16 {
+			return b, nil
+		}
+	default:
+		if b, ok := v.([]byte); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid value %T for %s", v, col.Type)
+}
+
+// bcpDecimal encodes a decimal as precision, scale, sign and a 16 bytes
+// little endian integer.
+func bcpDecimal(s string, prec, scale int) ([]byte, error) {
+	dec, err := decimal.StringToDecimalScale(s, uint8(scale))
+	if err != nil {
+		return nil, err
+	}
+	ub := dec.UnscaledBytes()
+	if len(ub) > 16 {
+		return nil, fmt.Errorf("decimal out of range: %s", s)
+	}
+	buf := make([]byte, 19)
+	buf[0], buf[1] = byte(prec), byte(scale)
+	if dec.IsPositive() {
+		buf[2] = 1
+	}
+	for i, j := 3, len(ub)-1; j >= 0; i, j = i+1, j-1 {
+		buf[i] = ub[j]
+	}
+	return buf, nil
+}
+
+// bcpMoney encodes money in the layout of the wire.
+func bcpMoney(s string, size int) ([]byte, error) {
+	money, err := decimal.StringToDecimalScale(s, 4)
+	if err != nil {
+		return nil, err
+	}
+	integer := uint64(money.GetInteger(1))<<32 | uint64(money.GetInteger(0))
+	if !money.IsPositive() {
+		integer = ^integer + 1
+	}
+	buf := make([]byte, size)
+	if size == 4 {
+		binary.LittleEndian.PutUint32(buf, uint32(integer))
+	} else {
+		binary.LittleEndian.PutUint32(buf, uint32(integer>>32))
+		binary.LittleEndian.PutUint32(buf[4:], uint32(integer))
+	}
+	return buf, nil
+}
+
+// bcpText formats a value of a column as the text of a character field.
+func bcpText(v driver.Value, col *BCPColumn) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case []byte:
+		switch col.Type {
+		case "SQLUNIQUEID":
+			var u UniqueIdentifier
+			if err := u.Scan(v); err != nil {
+				return "", err
+			}
+			return u.String(), nil
+		case "SQLBINARY", "SQLVARYBIN", "SQLIMAGE":
+			return strings.ToUpper(hex.EncodeToString(v)), nil
+		}
+		return string(v), nil
+	case time.Time:
+		return v.Format(bcpTimeLayout(col)), nil
+	}
+	return "", fmt.Errorf("invalid value %T for %s", v, col.Type)
+}
+
+// bcpTimeLayout is the layout of the text of a date and time column.
+func bcpTimeLayout(col *BCPColumn) string {
+	var frac string
+	if col.Scale > 0 {
+		frac = "." + strings.Repeat("0", col.Scale)
+	}
+	switch col.Type {
+	case "SQLDATE":
+		return sqlDateFormat
+	case "SQLTIME":
+		return "15:04:05" + frac
+	case "SQLDATETIM4":
+		return "2006-01-02 15:04:05"
+	case "SQLDATETIME":
+		return "2006-01-02 15:04:05.000"
+	case "SQLDATETIMEOFFSET":
+		return "2006-01-02 15:04:05" + frac + " -07:00"
+	}
+	return "2006-01-02 15:04:05" + frac
+}
@@ -0,0 +1,251 @@
+package mssql
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBCPFormatFile = `<?xml version="1.0"?>
+<BCPFORMAT xmlns="http://schemas.microsoft.com/sqlserver/2004/bulkload/format" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+ <RECORD>
+  <FIELD ID="1" xsi:type="NativeFixed" LENGTH="4"/>
+  <FIELD ID="2" xsi:type="CharTerm" TERMINATOR="\t" MAX_LENGTH="20" COLLATION="SQL_Latin1_General_CP1_CI_AS"/>
+  <FIELD ID="3" xsi:type="CharTerm" TERMINATOR="|"/>
+  <FIELD ID="4" xsi:type="NCharPrefix" PREFIX_LENGTH="2" MAX_LENGTH="40"/>
+  <FIELD ID="5" xsi:type="CharTerm" TERMINATOR="\r\n"/>
+ </RECORD>
+ <ROW>
+  <COLUMN SOURCE="1" NAME="id" xsi:type="SQLINT" NULLABLE="NO"/>
+  <COLUMN SOURCE="2" NAME="name" xsi:type="SQLVARYCHAR"/>
+  <COLUMN SOURCE="4" NAME="note" xsi:type="SQLNVARCHAR" NULLABLE="YES"/>
+  <COLUMN SOURCE="5" NAME="created" xsi:type="SQLDATETIME2"/>
+ </ROW>
+</BCPFORMAT>`
+
+func TestParseBCPFormatFile(t *testing.T) {
+	f, err := ParseBCPFormatFile(strings.NewReader(testBCPFormatFile))
+	require.NoError(t, err)
+	require.Len(t, f.Fields, 5)
+	assert.Equal(t, BCPField{ID: "1", Type: "NativeFixed", Length: 4}, f.Fields[0])
+	assert.Equal(t, BCPField{ID: "2", Type: "CharTerm", Terminator: "\t", MaxLength: 20, Collation: "SQL_Latin1_General_CP1_CI_AS"}, f.Fields[1])
+	assert.Equal(t, "\r\n", f.Fields[4].Terminator)
+	assert.Equal(t, []BCPColumn{
+		{Source: "1", Name: "id", Type: "SQLINT"},
+		{Source: "2", Name: "name", Type: "SQLVARYCHAR", Nullable: true},
+		{Source: "4", Name: "note", Type: "SQLNVARCHAR", Nullable: true},
+		{Source: "5", Name: "created", Type: "SQLDATETIME2", Scale: 7, Nullable: true},
+	}, f.Columns)
+
+	fields, err := f.fields()
+	require.NoError(t, err)
+	assert.Equal(t, -1, fields[2].column, "field 3 is skipped")
+	assert.Empty(t, fields[3].term)
+
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	require.NoError(t, err)
+	f2, err := ParseBCPFormatFile(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, f, f2)
+
+	for _, bad := range []string{
+		`<BCPFORMAT><RECORD><FIELD ID="1" xsi:type="NativeTerm" TERMINATOR=","/></RECORD></BCPFORMAT>`,
+		`<BCPFORMAT><RECORD><FIELD ID="1" xsi:type="CharPrefix" PREFIX_LENGTH="3"/></RECORD></BCPFORMAT>`,
+		`<BCPFORMAT><RECORD><FIELD ID="1" xsi:type="CharFixed"/></RECORD></BCPFORMAT>`,
+		`<BCPFORMAT><RECORD><FIELD ID="1" xsi:type="CharTerm" TERMINATOR="\x"/></RECORD></BCPFORMAT>`,
+		`<BCPFORMAT><RECORD><FIELD ID="1" xsi:type="CharTerm" TERMINATOR=","/></RECORD>` +
+			`<ROW><COLUMN SOURCE="2" NAME="a" xsi:type="SQLINT"/></ROW></BCPFORMAT>`,
+		`<BCPFORMAT><RECORD><FIELD ID="1" xsi:type="CharTerm" TERMINATOR=","/></RECORD>` +
+			`<ROW><COLUMN SOURCE="1" NAME="a" xsi:type="SQLXYZ"/></ROW></BCPFORMAT>`,
+	} {
+		_, err := ParseBCPFormatFile(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+var testBCPColumns = []columnStruct{
+	{ColName: "id", ti: typeInfo{TypeId: typeInt4, Size: 4}},
+	{ColName: "name", Flags: colFlagNullable, ti: typeInfo{TypeId: typeNVarChar, Size: 40}},
+	{ColName: "price", Flags: colFlagNullable, ti: typeInfo{TypeId: typeDecimalN, Size: 9, Prec: 10, Scale: 2}},
+	{ColName: "created", Flags: colFlagNullable, ti: typeInfo{TypeId: typeDateTime2N, Scale: 7}},
+	{ColName: "uid", Flags: colFlagNullable, ti: typeInfo{TypeId: typeGuid, Size: 16}},
+	{ColName: "data", Flags: colFlagNullable, ti: typeInfo{TypeId: typeBigVarBin, Size: 10}},
+	{ColName: "note", Flags: colFlagNullable, ti: typeInfo{TypeId: typeBigVarChar, Size: 0xffff}},
+	{ColName: "amount", Flags: colFlagNullable, ti: typeInfo{TypeId: typeMoneyN, Size: 8}},
+	{ColName: "flag", Flags: colFlagNullable, ti: typeInfo{TypeId: typeBitN, Size: 1}},
+	{ColName: "ratio", Flags: colFlagNullable, ti: typeInfo{TypeId: typeFltN, Size: 8}},
+}
+
+func TestBCPDefaultFormatFile(t *testing.T) {
+	f, err := newBCPFormatFile(testBCPColumns[:3], BCPOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []BCPField{
+		{ID: "1", Type: "NativeFixed", Length: 4},
+		{ID: "2", Type: "NCharPrefix", PrefixLength: 2, MaxLength: 40},
+		{ID: "3", Type: "NativePrefix", PrefixLength: 1},
+	}, f.Fields)
+	assert.Equal(t, BCPColumn{Source: "3", Name: "price", Type: "SQLDECIMAL", Precision: 10, Scale: 2, Nullable: true}, f.Columns[2])
+
+	f, err = newBCPFormatFile(testBCPColumns[:2], BCPOptions{Format: BCPCharacter, RowTerminator: "\n"})
+	require.NoError(t, err)
+	assert.Equal(t, []BCPField{
+		{ID: "1", Type: "CharTerm", Terminator: "\t"},
+		{ID: "2", Type: "CharTerm", Terminator: "\n", MaxLength: 40},
+	}, f.Fields)
+
+	_, err = newBCPFormatFile([]columnStruct{{ColName: "x", ti: typeInfo{TypeId: typeXml}}}, BCPOptions{})
+	assert.Error(t, err)
+}
+
+func TestBCPRoundTrip(t *testing.T) {
+	created := time.Date(2024, 2, 29, 13, 14, 15, 123456700, time.UTC)
+	guid := []byte{0xFF, 0x19, 0x96, 0x6F, 0x86, 0x8B, 0x11, 0xD0, 0xB4, 0x2D, 0x00, 0xC0, 0x4F, 0xC9, 0x64, 0xFF}
+	rows := [][]driver.Value{
+		{int64(1), "Smith, J", []byte("12.50"), created, guid, []byte{0xca, 0xfe}, "", []byte("-1.2500"), true, 0.5},
+		{int64(-2), nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+	want := [][]interface{}{
+		{int64(1), "Smith, J", "12.50", created, guid, []byte{0xca, 0xfe}, "", "-1.2500", true, 0.5},
+		{int64(-2), nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+
+	for _, format := range []BCPFormat{BCPNative, BCPCharacter} {
+		f, err := newBCPFormatFile(testBCPColumns, BCPOptions{Format: format})
+		require.NoError(t, err)
+		fields, err := f.fields()
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		bw := &bcpWriter{w: bufio.NewWriter(&buf), fields: fields, columns: f.Columns, loc: time.UTC}
+		for _, row := range rows {
+			require.NoError(t, bw.writeRow(row))
+		}
+		require.NoError(t, bw.w.Flush())
+		if format == BCPNative {
+			assert.Equal(t, []byte{0x01, 0, 0, 0, 0x10, 0, 'S', 0}, buf.Bytes()[:8])
+		} else {
+			assert.True(t, strings.HasPrefix(buf.String(), "1\tSmith, J\t12.50\t2024-02-29 13:14:15.1234567\t6F9619FF-8B86-D011-B42D-00C04FC964FF\tCAFE\t\x00\t"), buf.String())
+		}
+
+		br := &bcpReader{r: bufio.NewReader(&buf), fields: fields}
+		data := make([][]byte, len(fields))
+		for _, wantRow := range want {
+			require.NoError(t, br.readRow(data))
+			for i, field := range fields {
+				got, err := bcpImportValue(field, &f.Columns[i], &testBCPColumns[i], data[i], time.UTC)
+				require.NoError(t, err, testBCPColumns[i].ColName)
+				if w, ok := wantRow[i].(time.Time); ok {
+					assert.True(t, w.Equal(got.(time.Time)), "%v: got %v", format, got)
+					continue
+				}
+				assert.Equal(t, wantRow[i], got, "%v: %s", format, testBCPColumns[i].ColName)
+			}
+		}
+		assert.Equal(t, io.EOF, br.readRow(data))
+	}
+}
+
+func TestBCPReadErrors(t *testing.T) {
+	f, err := newBCPFormatFile(testBCPColumns[:2], BCPOptions{})
+	require.NoError(t, err)
+	fields, err := f.fields()
+	require.NoError(t, err)
+	data := make([][]byte, len(fields))
+
+	br := &bcpReader{r: bufio.NewReader(bytes.NewReader([]byte{1, 0, 0, 0, 4, 0, 'a'})), fields: fields}
+	assert.Equal(t, io.ErrUnexpectedEOF, br.readRow(data))
+
+	f, err = newBCPFormatFile(testBCPColumns[:2], BCPOptions{Format: BCPCharacter})
+	require.NoError(t, err)
+	fields, err = f.fields()
+	require.NoError(t, err)
+	br = &bcpReader{r: bufio.NewReader(strings.NewReader("1\tx")), fields: fields}
+	assert.Equal(t, io.ErrUnexpectedEOF, br.readRow(data))
+
+	_, err = bcpNativeValue([]byte{1, 2}, &BCPColumn{Type: "SQLINT"}, time.UTC)
+	assert.Error(t, err)
+}
+
+func TestBCP(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	const columns = `(
+		id int not null,
+		name nvarchar(20),
+		code varchar(10),
+		price decimal(10, 2),
+		amount money,
+		created datetime2,
+		updated datetime,
+		uid uniqueidentifier,
+		data varbinary(max),
+		flag bit,
+		ratio real)`
+	_, err = conn.ExecContext(ctx, "create table #bcp_source "+columns+"; create table #bcp_dest "+columns)
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, `insert into #bcp_source values
+		(1, N'Smith, J', 'ab', 12.50, -3.5, '2024-02-29 13:14:15.1234567', '2024-02-29 13:14:15.997',
+			'6F9619FF-8B86-D011-B42D-00C04FC964FF', 0xCAFE, 1, 0.25),
+		(2, N'', '', null, null, null, null, null, 0x, 0, null),
+		(3, null, null, null, null, null, null, null, null, null, null)`)
+	require.NoError(t, err)
+
+	const query = "select id, name, code, price, amount, created, updated, uid, data, flag, ratio from #bcp_source where id > @p1 order by id"
+	for _, format := range []BCPFormat{BCPNative, BCPCharacter} {
+		_, err = conn.ExecContext(ctx, "truncate table #bcp_dest")
+		require.NoError(t, err)
+		err = conn.Raw(func(driverConn any) error {
+			c := driverConn.(*Conn)
+			var file bytes.Buffer
+			n, formatFile, err := c.ExportBCP(ctx, &file, query, BCPOptions{Format: format}, 0)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), n)
+
+			var xmlFile bytes.Buffer
+			_, err = formatFile.WriteTo(&xmlFile)
+			require.NoError(t, err)
+			formatFile, err = ParseBCPFormatFile(&xmlFile)
+			require.NoError(t, err)
+
+			data := file.Bytes()
+			n, err = c.ImportBCP(ctx, "#bcp_dest", bytes.NewReader(data), BCPOptions{FormatFile: formatFile})
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), n)
+			return nil
+		})
+		require.NoError(t, err)
+
+		var diff int
+		err = conn.QueryRowContext(ctx, `select count(*) from (
+			select * from #bcp_source except select * from #bcp_dest) d`).Scan(&diff)
+		require.NoError(t, err)
+		assert.Equal(t, 0, diff, "format %v", format)
+	}
+
+	err = conn.Raw(func(driverConn any) error {
+		_, err := driverConn.(*Conn).ImportBCP(ctx, "#bcp_dest", strings.NewReader("x\t\t\t\t\t\t\t\t\t\t\r\n"), BCPOptions{Format: BCPCharacter})
+		assert.ErrorContains(t, err, "column id")
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,187 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// maxDecimalPrecision is the largest precision of decimal and numeric.
+const maxDecimalPrecision = 38
+
+// BigRat holds a decimal, numeric or money value in a big.Rat, so it can be
+// scanned and sent without rounding through float64. A nil Rat is NULL.
+//
+// As a parameter it is sent as decimal with the precision and scale needed to
+// represent it exactly, which fails for values like 1/3 that have no finite
+// decimal expansion.
+type BigRat struct {
+	*big.Rat
+}
+
+// Scan implements the sql.Scanner interface.
+func (r *BigRat) Scan(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		r.Rat = nil
+	case []byte:
+		return r.setString(string(v))
+	case string:
+		return r.setString(v)
+	case int64:
+		r.Rat = new(big.Rat).SetInt64(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("mssql: cannot scan %v into BigRat", v)
+		}
+		r.Rat = new(big.Rat).SetFloat64(v)
+	default:
+		return fmt.Errorf("mssql: cannot scan %T into BigRat", v)
+	}
+	return nil
+}
+
+func (r *BigRat) setString(s string) error {
+	x, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return fmt.Errorf("mssql: cannot scan %q into BigRat", s)
+	}
+	r.Rat = x
+	return nil
+}
+
+// Value implements the driver.Valuer interface. The value is returned as an
+// exact decimal string.
+func (r BigRat) Value() (driver.Value, error) {
+	if r.Rat == nil {
+		return nil, nil
+	}
+	return ratDecimalString(r.Rat)
+}
+
+// BigInt holds an integral decimal or numeric value, such as a
+// decimal(38, 0) column, in a big.Int. A nil Int is NULL. It is unrelated to
+// the bigint type, which scans into an int64.
+type BigInt struct {
+	*big.Int
+}
+
+// Scan implements the sql.Scanner interface. Scanning a value with a
+// non-zero fractional part fails.
+func (i *BigInt) Scan(v interface{}) error {
+	if v == nil {
+		i.Int = nil
+		return nil
+	}
+	var r BigRat
+	if err := r.Scan(v); err != nil {
+		return fmt.Errorf("mssql: cannot scan %T into BigInt", v)
+	}
+	if !r.IsInt() {
+		return fmt.Errorf("mssql: cannot scan %s into BigInt without losing its fractional part", r.FloatString(maxDecimalPrecision))
+	}
+	i.Int = new(big.Int).Set(r.Num())
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (i BigInt) Value() (driver.Value, error) {
+	if i.Int == nil {
+		return nil, nil
+	}
+	return i.String(), nil
+}
+
+// decimalTexter is implemented by arbitrary precision decimal types such as
+// apd.Decimal, whose Text('f') returns the value without an exponent. These
+// are sent as decimal instead of through their driver.Valuer.
+type decimalTexter interface {
+	Text(format byte) string
+}
+
+// ratDecimalString returns x as a decimal string with as many fractional
+// digits as are needed to represent it exactly.
+func ratDecimalString(x *big.Rat) (string, error) {
+	d := new(big.Int).Set(x.Denom())
+	var twos, fives int
+	for d.Bit(0) == 0 {
+		d.Rsh(d, 1)
+		twos++
+	}
+	five := big.NewInt(5)
+	var q, m big.Int
+	for {
+		q.QuoRem(d, five, &m)
+		if m.Sign() != 0 {
+			break
+		}
+		d.Set(&q)
+		fives++
+	}
+	if !d.IsInt64() || d.Int64() != 1 {
+		return "", fmt.Errorf("mssql: %s has no exact decimal representation", x.String())
+	}
+	return x.FloatString(max(twos, fives)), nil
+}
+
+// makeDecimalParam returns a decimal parameter holding the decimal string s
+// exactly. Its precision and scale are the smallest that fit s.
+func makeDecimalParam(s string) (res param, err error) {
+	digits := strings.TrimPrefix(s, "-")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return res, fmt.Errorf("mssql: invalid decimal value %q", s)
+	}
+	scale := len(frac)
+	prec := max(len(strings.TrimLeft(whole, "0"))+scale, scale, 1)
+	if prec > maxDecimalPrecision {
+		return res, fmt.Errorf("mssql: decimal value %s needs precision %d, more than %d", s, prec, maxDecimalPrecision)
+	}
+	ti := typeInfo{TypeId: typeDecimalN, Prec: uint8(prec), Scale: uint8(scale)}
+	res, err = (&Bulk{}).makeParam(s, columnStruct{ti: ti})
+	res.ti.Prec, res.ti.Scale = ti.Prec, ti.Scale
+	return res, err
+}
+
+// makeNullDecimalParam returns a NULL decimal parameter.
+func makeNullDecimalParam() (res param) {
+	res.ti = typeInfo{TypeId: typeDecimalN, Size: 17, Prec: maxDecimalPrecision}
+	return res
+}
+
+// makeBigNumParam returns the decimal parameter for a big.Rat, big.Int,
+// BigRat, BigInt or decimalTexter value.
+func makeBigNumParam(val interface{}) (param, error) {
+	var s string
+	switch val := val.(type) {
+	case BigRat:
+		return makeBigNumParam(val.Rat)
+	case BigInt:
+		return makeBigNumParam(val.Int)
+	case *big.Rat:
+		if val == nil {
+			return makeNullDecimalParam(), nil
+		}
+		var err error
+		if s, err = ratDecimalString(val); err != nil {
+			return param{}, err
+		}
+	case *big.Int:
+		if val == nil {
+			return makeNullDecimalParam(), nil
+		}
+		s = val.String()
+	case decimalTexter:
+		if v := reflect.ValueOf(val); v.Kind() == reflect.Ptr && v.IsNil() {
+			return makeNullDecimalParam(), nil
+		}
+		s = val.Text('f')
+	default:
+		return param{}, errors.New("mssql: not a decimal value")
+	}
+	return makeDecimalParam(s)
+}
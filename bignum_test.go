@@ -0,0 +1,221 @@
+package mssql
+
+import (
+	"bytes"
+	"database/sql"
+	"math/big"
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDecimal stands in for arbitrary precision decimal types like
+// apd.Decimal.
+type fakeDecimal struct {
+	text string
+}
+
+func (d *fakeDecimal) Text(format byte) string {
+	return d.text
+}
+
+func TestRatDecimalString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0", "0"},
+		{"5", "5"},
+		{"-1/8", "-0.125"},
+		{"1/20", "0.05"},
+		{"12345678901234567890123456789/100", "123456789012345678901234567.89"},
+	}
+	for _, tt := range tests {
+		x, _ := new(big.Rat).SetString(tt.in)
+		got, err := ratDecimalString(x)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got)
+	}
+
+	_, err := ratDecimalString(big.NewRat(1, 3))
+	assert.Error(t, err)
+}
+
+func TestMakeBigNumParam(t *testing.T) {
+	huge, _ := new(big.Int).SetString("12345678901234567890123456789012345678", 10)
+	tests := []struct {
+		name  string
+		val   interface{}
+		prec  uint8
+		scale uint8
+		buf   []byte
+	}{
+		{"rat", big.NewRat(-5, 4), 3, 2, []byte{0, 125, 0, 0, 0}},
+		{"small rat", big.NewRat(1, 1000), 3, 3, []byte{1, 1, 0, 0, 0}},
+		{"int", big.NewInt(300), 3, 0, []byte{1, 0x2c, 1, 0, 0}},
+		{"wrapped rat", BigRat{big.NewRat(1, 2)}, 1, 1, []byte{1, 5, 0, 0, 0}},
+		{"wrapped int", BigInt{big.NewInt(7)}, 1, 0, []byte{1, 7, 0, 0, 0}},
+		{"text", &fakeDecimal{"1234567890.50"}, 12, 2, []byte{1, 0x3a, 0x1a, 0x99, 0xbe, 0x1c, 0, 0, 0}},
+		{"38 digits", huge, 38, 0, append([]byte{1}, reverse(huge.Bytes(), 16)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := makeBigNumParam(tt.val)
+			require.NoError(t, err)
+			assert.Equal(t, uint8(typeDecimalN), p.ti.TypeId)
+			assert.Equal(t, tt.prec, p.ti.Prec)
+			assert.Equal(t, tt.scale, p.ti.Scale)
+			assert.Equal(t, len(tt.buf), p.ti.Size)
+			assert.Equal(t, tt.buf, p.buffer)
+		})
+	}
+
+	for _, val := range []interface{}{(*big.Rat)(nil), BigInt{}, (*fakeDecimal)(nil)} {
+		p, err := makeBigNumParam(val)
+		require.NoError(t, err)
+		assert.Nil(t, p.buffer, "%T should be NULL", val)
+		assert.Equal(t, uint8(typeDecimalN), p.ti.TypeId)
+	}
+
+	tooBig := new(big.Int).Mul(huge, big.NewInt(10))
+	for _, val := range []interface{}{big.NewRat(2, 3), tooBig, &fakeDecimal{"NaN"}, &fakeDecimal{"1e5"}} {
+		_, err := makeBigNumParam(val)
+		assert.Error(t, err, "%v", val)
+	}
+}
+
+func reverse(b []byte, size int) []byte {
+	r := make([]byte, size)
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
+
+func TestBigNumStmtParam(t *testing.T) {
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}}
+	for _, val := range []interface{}{big.NewRat(1, 4), BigRat{big.NewRat(1, 4)}, BigRat{}, &fakeDecimal{"0.25"}} {
+		cval, err := convertInputParameter(val)
+		require.NoError(t, err)
+		p, err := s.makeParam(cval)
+		require.NoError(t, err, "%T", val)
+		assert.Equal(t, uint8(typeDecimalN), p.ti.TypeId, "%T", val)
+	}
+}
+
+func TestBigRatScan(t *testing.T) {
+	var r BigRat
+	require.NoError(t, r.Scan([]byte("-12345678901234567890.123456789012345678")))
+	want, _ := new(big.Rat).SetString("-12345678901234567890123456789012345678/1000000000000000000")
+	assert.Equal(t, 0, want.Cmp(r.Rat))
+
+	require.NoError(t, r.Scan(int64(3)))
+	assert.Equal(t, "3", r.RatString())
+	require.NoError(t, r.Scan(0.5))
+	assert.Equal(t, "1/2", r.RatString())
+	require.NoError(t, r.Scan(nil))
+	assert.Nil(t, r.Rat)
+	assert.Error(t, r.Scan([]byte("abc")))
+	assert.Error(t, r.Scan(true))
+
+	v, err := BigRat{big.NewRat(-3, 8)}.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "-0.375", v)
+	v, err = BigRat{}.Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	_, err = BigRat{big.NewRat(1, 3)}.Value()
+	assert.Error(t, err)
+}
+
+func TestBigIntScan(t *testing.T) {
+	var i BigInt
+	require.NoError(t, i.Scan([]byte("99999999999999999999999999999999999999")))
+	assert.Equal(t, "99999999999999999999999999999999999999", i.String())
+	require.NoError(t, i.Scan([]byte("12.000")))
+	assert.Equal(t, int64(12), i.Int64())
+	assert.Error(t, i.Scan([]byte("12.5")))
+	require.NoError(t, i.Scan(nil))
+	assert.Nil(t, i.Int)
+
+	v, err := BigInt{big.NewInt(-42)}.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "-42", v)
+}
+
+func TestBulkBigNum(t *testing.T) {
+	b := &Bulk{}
+	col := columnStruct{ti: typeInfo{TypeId: typeDecimalN, Prec: 10, Scale: 4, Size: 9}}
+	p, err := b.makeParam(big.NewRat(5, 4), col)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 0xd4, 0x30, 0, 0, 0, 0, 0, 0}, p.buffer)
+
+	p, err = b.makeParam(BigInt{big.NewInt(2)}, col)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 0x20, 0x4e, 0, 0, 0, 0, 0, 0}, p.buffer)
+
+	_, err = b.makeParam(big.NewRat(1, 32), col)
+	assert.Error(t, err, "a scale of 5 does not fit the column")
+
+	p, err = b.makeParam((*big.Int)(nil), col)
+	require.NoError(t, err)
+	assert.Nil(t, p.buffer)
+}
+
+func TestBigNumQuery(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	x, _ := new(big.Rat).SetString("-1234567890123456789012345678.0123456789")
+	var got BigRat
+	var typ string
+	err := conn.QueryRow("select @p1, cast(SQL_VARIANT_PROPERTY(@p1, 'Precision') as varchar(10)) + ',' + cast(SQL_VARIANT_PROPERTY(@p1, 'Scale') as varchar(10))", x).Scan(&got, &typ)
+	require.NoError(t, err)
+	assert.Equal(t, 0, x.Cmp(got.Rat), got.FloatString(10))
+	assert.Equal(t, "38,10", typ)
+
+	var money BigRat
+	err = conn.QueryRow("select cast('922337203685477.5807' as money)").Scan(&money)
+	require.NoError(t, err)
+	assert.Equal(t, "922337203685477.5807", money.FloatString(4))
+
+	var i BigInt
+	err = conn.QueryRow("select cast('99999999999999999999999999999999999999' as decimal(38, 0)) + @p1", BigInt{big.NewInt(-9)}).Scan(&i)
+	require.NoError(t, err)
+	assert.Equal(t, "99999999999999999999999999999999999990", i.String())
+
+	out := BigRat{big.NewRat(5, 4)}
+	_, err = conn.Exec("set @p1 = @p1 * 2", sql.Out{Dest: &out})
+	require.NoError(t, err)
+	assert.Equal(t, "5/2", out.RatString())
+}
+
+func TestTVPBigNum(t *testing.T) {
+	type row struct {
+		Amount BigRat
+		Total  *big.Rat
+	}
+	tvp := TVP{TypeName: "dbo.ledger", Value: []row{
+		{BigRat{big.NewRat(3, 2)}, big.NewRat(1, 8)},
+		{BigRat{}, nil},
+	}}
+	columns, indexes, err := tvp.columnTypes()
+	require.NoError(t, err)
+	require.Len(t, columns, 2)
+	for i, scale := range []uint8{1, 3} {
+		assert.Equal(t, uint8(typeDecimalN), columns[i].ti.TypeId)
+		assert.Equal(t, uint8(38), columns[i].ti.Prec)
+		assert.Equal(t, scale, columns[i].ti.Scale)
+	}
+
+	b, err := tvp.encode("dbo", "ledger", columns, indexes, msdsn.EncodeParameters{})
+	require.NoError(t, err)
+	firstRow := append([]byte{_TVP_ROW_TOKEN, 17, 1, 15}, make([]byte, 15)...)
+	firstRow = append(firstRow, 17, 1, 125)
+	firstRow = append(firstRow, make([]byte, 15)...)
+	assert.True(t, bytes.Contains(b, firstRow), "first row should be rescaled to the column scales")
+	assert.True(t, bytes.HasSuffix(b, []byte{_TVP_ROW_TOKEN, 0, 0, _TVP_END_TOKEN}), "second row should be NULL")
+}
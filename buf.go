@@ -153,6 +153,13 @@ func (w *tdsBuffer) FinishPacket() error {
 	return w.flush()
 }
 
+// AbortPacket ends the message being written with the ignore flag set, so
+// the server discards it.
+func (w *tdsBuffer) AbortPacket() error {
+	w.wbuf[1] |= 1 | 2 // Mark this as the last packet of a message to ignore.
+	return w.flush()
+}
+
 var headerSize = binary.Size(header{})
 
 func (r *tdsBuffer) readNextPacket() error {
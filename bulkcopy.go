@@ -7,11 +7,13 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/golang-sql/civil"
 	"github.com/microsoft/go-mssqldb/internal/decimal"
 	"github.com/microsoft/go-mssqldb/msdsn"
 	shopspring "github.com/shopspring/decimal"
@@ -19,30 +21,97 @@ import (
 
 type Bulk struct {
 	// ctx is used only for AddRow and Done methods.
-	// This could be removed if AddRow and Done accepted
-	// a ctx field as well, which is available with the
-	// database/sql call.
+	// AddRowContext and DoneContext take their own.
 	ctx context.Context
 
 	cn          *Conn
 	metadata    []columnStruct
 	bulkColumns []columnStruct
+	// encrypted holds the encryption of the bulk columns protected by
+	// Always Encrypted, and cekEntries the keys of their CEK table.
+	encrypted   []*bulkEncryptedColumn
+	cekEntries  []*cekTableEntry
 	columnsName []string
 	tablename   string
 	numRows     int
 
 	headerSent bool
-	Options    BulkOptions
-	Debug      bool
+	// identityInsert is set while IDENTITY_INSERT is on for the table.
+	identityInsert bool
+	// query is the INSERT BULK statement sent at the start of each batch.
+	query string
+	// batchOpen is set while rows of a batch are being sent.
+	batchOpen  bool
+	batches    int
+	batchRows  int
+	batchBytes int
+	rowsCopied int64
+	// batchErr is the failure of a batch, which ends the bulk copy.
+	batchErr error
+	Options  BulkOptions
+	Debug    bool
 }
 type BulkOptions struct {
-	CheckConstraints  bool
-	FireTriggers      bool
+	CheckConstraints bool
+	FireTriggers     bool
+	// KeepNulls keeps the NULL values of the rows. Otherwise NULL values
+	// take the default values of their destination columns, where they
+	// have one.
 	KeepNulls         bool
 	KilobytesPerBatch int
 	RowsPerBatch      int
 	Order             []string
 	Tablock           bool
+	// KeepIdentity copies the values of identity columns instead of letting
+	// the server generate them, by turning IDENTITY_INSERT on for the
+	// table during the copy.
+	KeepIdentity bool
+	// ColumnMappings maps source columns to destination columns with other
+	// names. Source columns without a mapping are copied to the destination
+	// columns of the same name. Two source columns cannot be copied to the
+	// same destination column.
+	ColumnMappings []BulkColumnMapping
+	// CommitBatches makes the driver end the bulk copy and start a new one
+	// every RowsPerBatch rows or KilobytesPerBatch kilobytes, so each batch
+	// is committed on its own unless the copy runs in a transaction. A batch
+	// failure is returned as a *BulkBatchError.
+	CommitBatches bool
+	// NotifyAfter is the number of rows after which Notify is called, again
+	// and again, with the number of rows sent so far. Notify is not kept in
+	// the statements of CopyIn.
+	NotifyAfter int
+	Notify      func(rowsSent int64) `json:"-"`
+}
+
+// BulkBatchError is the failure of a batch of a bulk copy with
+// CommitBatches set.
+type BulkBatchError struct {
+	// Batch is the number of the failed batch, starting at 1.
+	Batch int
+	// FirstRow is the number of the first row of the batch, starting at 1.
+	FirstRow int64
+	// RowsCopied is the number of rows committed by the previous batches.
+	RowsCopied int64
+	Err        error
+}
+
+func (e *BulkBatchError) Error() string {
+	return fmt.Sprintf("mssql: bulk copy batch %d starting at row %d failed after %d rows were copied: %v",
+		e.Batch, e.FirstRow, e.RowsCopied, e.Err)
+}
+
+func (e *BulkBatchError) Unwrap() error {
+	return e.Err
+}
+
+// BulkColumnMapping maps a source column of a bulk copy, one of the columns
+// passed to CreateBulk, to a destination column of the table. Each side is
+// given by name or, when the name is empty, by its position starting at 1.
+type BulkColumnMapping struct {
+	Source             string
+	SourceOrdinal      int
+	Destination        string
+	DestinationOrdinal int
 }
 
 type DataValue interface{}
@@ -66,33 +135,38 @@ func (c *Conn) CreateBulkContext(ctx context.Context, table string, columns []st
 }
 
 func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
-	//get table columns info
-	err = b.getMetadata(ctx)
-	if err != nil {
-		return err
+	//get table columns info, unless the caller already did
+	if b.metadata == nil {
+		if err = b.getMetadata(ctx); err != nil {
+			return err
+		}
 	}
 
 	//match the columns
-	for _, colname := range b.columnsName {
-		var bulkCol *columnStruct
-
-		for _, m := range b.metadata {
-			if m.ColName == colname {
-				bulkCol = &m
-				break
-			}
+	sources := make(map[string]string, len(b.columnsName))
+	for i, colname := range b.columnsName {
+		bulkCol, err := b.destinationColumn(i, colname)
+		if err != nil {
+			return err
 		}
-		if bulkCol != nil {
-
-			if bulkCol.ti.TypeId == typeUdt {
-				//send udt as binary
-				bulkCol.ti.TypeId = typeBigVarBin
-			}
-			b.bulkColumns = append(b.bulkColumns, *bulkCol)
-			b.dlogf(ctx, "Adding column %s %s %#x", colname, bulkCol.ColName, bulkCol.ti.TypeId)
-		} else {
-			return fmt.Errorf("column %s does not exist in destination table %s", colname, b.tablename)
+		if source, ok := sources[bulkCol.ColName]; ok {
+			return fmt.Errorf("columns %s and %s are both copied to column %s of destination table %s", source, colname, bulkCol.ColName, b.tablename)
+		}
+		sources[bulkCol.ColName] = colname
+		if bulkCol.ti.TypeId == typeUdt {
+			//send udt as binary
+			bulkCol.ti.TypeId = typeBigVarBin
+		}
+		if bulkCol.ti.TypeId == typeXml {
+			// send xml untyped, the server validates it against the
+			// schema collection of the column
+			bulkCol.ti.XmlInfo = xmlInfo{}
 		}
+		b.bulkColumns = append(b.bulkColumns, bulkCol)
+		b.dlogf(ctx, "Adding column %s %s %#x", colname, bulkCol.ColName, bulkCol.ti.TypeId)
+	}
+	if err = b.prepareEncryption(ctx); err != nil {
+		return err
 	}
 
 	//create the bulk command
@@ -136,36 +210,214 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 		with_part = fmt.Sprintf("WITH (%s)", strings.Join(with_opts, ","))
 	}
 
-	query := fmt.Sprintf("INSERT BULK %s (%s) %s", b.tablename, col_defs.String(), with_part)
+	b.query = fmt.Sprintf("INSERT BULK %s (%s) %s", b.tablename, col_defs.String(), with_part)
+
+	if b.Options.KeepIdentity {
+		if err = b.setIdentityInsert(ctx, true); err != nil {
+			return err
+		}
+	}
+
+	if err = b.startBatch(ctx); err != nil {
+		if b.identityInsert {
+			b.setIdentityInsert(ctx, false)
+		}
+		return err
+	}
 
-	stmt, err := b.cn.PrepareContext(ctx, query)
+	b.headerSent = true
+	return nil
+}
+
+// startBatch sends the bulk command and the columns metadata of a batch.
+func (b *Bulk) startBatch(ctx context.Context) error {
+	stmt, err := b.cn.PrepareContext(ctx, b.query)
 	if err != nil {
 		return fmt.Errorf("Prepare failed: %s", err.Error())
 	}
-	b.dlogf(ctx, "%s", query)
+	b.dlogf(ctx, "%s", b.query)
 
 	_, err = stmt.(*Stmt).ExecContext(ctx, nil)
 	if err != nil {
 		return err
 	}
+	return b.beginBatchRows()
+}
 
-	b.headerSent = true
-
+// beginBatchRows starts the message holding the rows of a batch.
+func (b *Bulk) beginBatchRows() error {
 	var buf = b.cn.sess.buf
 	buf.BeginPacket(packBulkLoadBCP, false)
 
 	// Send the columns metadata.
 	columnMetadata := b.createColMetadata()
-	_, err = buf.Write(columnMetadata)
+	if _, err := buf.Write(columnMetadata); err != nil {
+		return err
+	}
+	b.batchOpen = true
+	b.batchRows = 0
+	b.batchBytes = 0
+	return nil
+}
 
-	return
+// endBatch ends the rows of a batch and reads the number of rows the server
+// copied.
+func (b *Bulk) endBatch(ctx context.Context) error {
+	var buf = b.cn.sess.buf
+	buf.WriteByte(byte(tokenDone))
+
+	binary.Write(buf, binary.LittleEndian, uint16(doneFinal))
+	binary.Write(buf, binary.LittleEndian, uint16(0)) //     curcmd
+
+	if b.cn.sess.loginAck.TDSVersion >= verTDS72 {
+		binary.Write(buf, binary.LittleEndian, uint64(0)) //rowcount 0
+	} else {
+		binary.Write(buf, binary.LittleEndian, uint32(0)) //rowcount 0
+	}
+
+	buf.FinishPacket()
+	b.batchOpen = false
+	b.batches++
+
+	reader := startReading(b.cn.sess, ctx, outputs{})
+	err := reader.iterateResponse()
+	if err != nil {
+		err = b.cn.checkBadConn(ctx, err, false)
+		if b.Options.CommitBatches {
+			err = &BulkBatchError{
+				Batch:      b.batches,
+				FirstRow:   int64(b.numRows-b.batchRows) + 1,
+				RowsCopied: b.rowsCopied,
+				Err:        err,
+			}
+		}
+		b.batchErr = err
+		return err
+	}
+	b.rowsCopied += reader.rowCount
+	return nil
+}
+
+// abortBatch ends the rows of the current batch with the ignore flag, so
+// the server discards them, and sends an attention to cancel the bulk
+// command. It then reads the cancel acknowledgement, leaving the connection
+// ready for other requests.
+func (b *Bulk) abortBatch(ctx context.Context) error {
+	b.batchOpen = false
+	sess := b.cn.sess
+	b.dlogf(ctx, "Cancelling bulk copy after %d rows", b.numRows)
+	if err := sess.buf.AbortPacket(); err != nil {
+		return b.cn.checkBadConn(ctx, err, false)
+	}
+	if err := sendAttention(sess.buf); err != nil {
+		return b.cn.checkBadConn(ctx, err, false)
+	}
+
+	// The acknowledgement follows the response to the bulk command, if the
+	// server sends one.
+	ctx = context.WithoutCancel(ctx)
+	for i := 0; i < 2; i++ {
+		tokChan := make(chan tokenStruct, 5)
+		go processSingleResponse(ctx, sess, tokChan, outputs{})
+		if readCancelConfirmation(tokChan) {
+			return nil
+		}
+	}
+	return b.cn.checkBadConn(ctx, ServerError{Error{Message: "did not get cancellation confirmation from the server"}}, false)
+}
+
+// writeRow sends the data of a row, starting and ending batches as needed,
+// and notifies the progress of the copy.
+func (b *Bulk) writeRow(ctx context.Context, data []byte) error {
+	if b.batchErr != nil {
+		return b.batchErr
+	}
+	if err := ctx.Err(); err != nil {
+		b.batchErr = err
+		if b.batchOpen {
+			if abortErr := b.abortBatch(ctx); abortErr != nil {
+				b.batchErr = abortErr
+			}
+		}
+		return b.batchErr
+	}
+	if !b.batchOpen {
+		if err := b.startBatch(ctx); err != nil {
+			b.batchErr = err
+			return err
+		}
+	}
+	if _, err := b.cn.sess.buf.Write(data); err != nil {
+		return err
+	}
+	b.numRows++
+	b.batchRows++
+	b.batchBytes += len(data)
+
+	if b.Options.NotifyAfter > 0 && b.Options.Notify != nil && b.numRows%b.Options.NotifyAfter == 0 {
+		b.Options.Notify(int64(b.numRows))
+	}
+	if b.Options.CommitBatches &&
+		((b.Options.RowsPerBatch > 0 && b.batchRows >= b.Options.RowsPerBatch) ||
+			(b.Options.KilobytesPerBatch > 0 && b.batchBytes >= b.Options.KilobytesPerBatch*1024)) {
+		return b.endBatch(ctx)
+	}
+	return nil
+}
+
+// destinationColumn returns the destination column of the source column at
+// index i, mapped by Options.ColumnMappings or matched by name.
+func (b *Bulk) destinationColumn(i int, colname string) (columnStruct, error) {
+	dest, ordinal := colname, 0
+	for _, m := range b.Options.ColumnMappings {
+		if (m.Source != "" && m.Source == colname) || (m.Source == "" && m.SourceOrdinal == i+1) {
+			dest, ordinal = m.Destination, m.DestinationOrdinal
+			break
+		}
+	}
+	if dest == "" {
+		if ordinal < 1 || ordinal > len(b.metadata) {
+			return columnStruct{}, fmt.Errorf("column %s is mapped to column %d which does not exist in destination table %s", colname, ordinal, b.tablename)
+		}
+		return b.metadata[ordinal-1], nil
+	}
+	for _, m := range b.metadata {
+		if m.ColName == dest {
+			return m, nil
+		}
+	}
+	return columnStruct{}, fmt.Errorf("column %s does not exist in destination table %s", dest, b.tablename)
+}
+
+// setIdentityInsert turns IDENTITY_INSERT on or off for the table.
+func (b *Bulk) setIdentityInsert(ctx context.Context, on bool) error {
+	state := "OFF"
+	if on {
+		state = "ON"
+	}
+	stmt, err := b.cn.prepareContext(ctx, fmt.Sprintf("SET IDENTITY_INSERT %s %s", b.tablename, state))
+	if err != nil {
+		return err
+	}
+	if _, err = stmt.ExecContext(ctx, nil); err != nil {
+		return err
+	}
+	b.identityInsert = on
+	return nil
 }
 
 // AddRow immediately writes the row to the destination table.
 // The arguments are the row values in the order they were specified.
 func (b *Bulk) AddRow(row []interface{}) (err error) {
+	return b.AddRowContext(b.ctx, row)
+}
+
+// AddRowContext is AddRow with a context. When ctx is done the rows of the
+// current batch are discarded, the bulk command is cancelled and the
+// context error is returned, by this call and by DoneContext.
+func (b *Bulk) AddRowContext(ctx context.Context, row []interface{}) (err error) {
 	if !b.headerSent {
-		err = b.sendBulkCommand(b.ctx)
+		err = b.sendBulkCommand(ctx)
 		if err != nil {
 			return
 		}
@@ -181,13 +433,7 @@ func (b *Bulk) AddRow(row []interface{}) (err error) {
 		return
 	}
 
-	_, err = b.cn.sess.buf.Write(bytes)
-	if err != nil {
-		return
-	}
-
-	b.numRows = b.numRows + 1
-	return
+	return b.writeRow(ctx, bytes)
 }
 
 func (b *Bulk) makeRowData(row []interface{}) ([]byte, error) {
@@ -204,14 +450,8 @@ func (b *Bulk) makeRowData(row []interface{}) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("bulkcopy: %s", err.Error())
 		}
-
-		if col.ti.Writer == nil {
-			return nil, fmt.Errorf("no writer for column: %s, TypeId: %#x",
-				col.ColName, col.ti.TypeId)
-		}
-		err = col.ti.Writer(buf, param.ti, param.buffer, b.cn.sess.encoding)
-		if err != nil {
-			return nil, fmt.Errorf("bulkcopy: %s", err.Error())
+		if err = b.writeValue(buf, i, param); err != nil {
+			return nil, err
 		}
 	}
 
@@ -221,31 +461,37 @@ func (b *Bulk) makeRowData(row []interface{}) ([]byte, error) {
 }
 
 func (b *Bulk) Done() (rowcount int64, err error) {
+	return b.DoneContext(b.ctx)
+}
+
+// DoneContext is Done with a context. When ctx is done before the rows are
+// sent they are discarded and the context error is returned; when it is done
+// while waiting for the server, an attention cancels the bulk command.
+func (b *Bulk) DoneContext(ctx context.Context) (rowcount int64, err error) {
 	if !b.headerSent {
 		//no rows had been sent
 		return 0, nil
 	}
-	var buf = b.cn.sess.buf
-	buf.WriteByte(byte(tokenDone))
-
-	binary.Write(buf, binary.LittleEndian, uint16(doneFinal))
-	binary.Write(buf, binary.LittleEndian, uint16(0)) //     curcmd
-
-	if b.cn.sess.loginAck.TDSVersion >= verTDS72 {
-		binary.Write(buf, binary.LittleEndian, uint64(0)) //rowcount 0
-	} else {
-		binary.Write(buf, binary.LittleEndian, uint32(0)) //rowcount 0
+	err = b.batchErr
+	if b.batchOpen {
+		if err = ctx.Err(); err != nil {
+			if abortErr := b.abortBatch(ctx); abortErr != nil {
+				err = abortErr
+			}
+		} else {
+			err = b.endBatch(ctx)
+		}
+	}
+	if b.identityInsert {
+		if resetErr := b.setIdentityInsert(context.WithoutCancel(ctx), false); err == nil {
+			err = resetErr
+		}
 	}
-
-	buf.FinishPacket()
-
-	reader := startReading(b.cn.sess, b.ctx, outputs{})
-	err = reader.iterateResponse()
 	if err != nil {
-		return 0, b.cn.checkBadConn(b.ctx, err, false)
+		return b.rowsCopied, err
 	}
 
-	return reader.rowCount, nil
+	return b.rowsCopied, nil
 }
 
 func (b *Bulk) createColMetadata() []byte {
@@ -253,9 +499,8 @@ func (b *Bulk) createColMetadata() []byte {
 	buf.WriteByte(byte(tokenColMetadata))                              // token
 	binary.Write(buf, binary.LittleEndian, uint16(len(b.bulkColumns))) // column count
 
-	// TODO: Write a valid CEK table if any parameters have cekTableEntry values
 	if b.cn.sess.alwaysEncrypted {
-		binary.Write(buf, binary.LittleEndian, uint16(0))
+		b.writeCekTable(buf)
 	}
 	for i, col := range b.bulkColumns {
 
@@ -266,7 +511,12 @@ func (b *Bulk) createColMetadata() []byte {
 		}
 		binary.Write(buf, binary.LittleEndian, uint16(col.Flags))
 
-		writeTypeInfo(buf, &b.bulkColumns[i].ti, false, b.cn.sess.encoding)
+		enc := b.encryptedColumn(i)
+		if enc != nil {
+			writeTypeInfo(buf, &enc.ti, false, b.cn.sess.encoding)
+		} else {
+			writeTypeInfo(buf, &b.bulkColumns[i].ti, false, b.cn.sess.encoding)
+		}
 
 		if col.ti.TypeId == typeNText ||
 			col.ti.TypeId == typeText ||
@@ -276,6 +526,9 @@ func (b *Bulk) createColMetadata() []byte {
 			binary.Write(buf, binary.LittleEndian, uint16(len(tablename_ucs2)/2))
 			buf.Write(tablename_ucs2)
 		}
+		if enc != nil {
+			b.writeCryptoMetadata(buf, i, enc)
+		}
 		colname_ucs2 := str2ucs2(col.ColName)
 		buf.WriteByte(uint8(len(colname_ucs2) / 2))
 		buf.Write(colname_ucs2)
@@ -347,11 +600,44 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 	res.ti.TypeId = col.ti.TypeId
 	loc := getTimezone(b.cn)
 
+	if col.ti.TypeId == typeVariant {
+		v, ok := val.(Variant)
+		if !ok {
+			v = Variant{Value: val}
+		}
+		res.buffer, err = makeVariant(b.cn, v)
+		return
+	}
+
 	switch valuer := val.(type) {
+	case VarChar, VarCharMax, NVarCharMax, NChar, DateTime1, DateTimeOffset,
+		civil.Date, civil.DateTime, civil.Time, int8, int16, uint8:
+		// The wrapper types of parameters are converted as for TypedParam.
+		v, e := typedParamValue(b.cn, valuer)
+		if e != nil {
+			return res, e
+		}
+		return b.makeParam(v, col)
+	case TypedParam:
+		return b.makeParam(valuer.Value, col)
 	case Money[shopspring.Decimal]:
 		return b.makeParam(valuer.Decimal, col)
 	case Money[shopspring.NullDecimal]:
 		return b.makeParam(valuer.Decimal, col)
+	case *big.Rat:
+		if valuer == nil {
+			return b.makeParam(nil, col)
+		}
+		s, e := ratDecimalString(valuer)
+		if e != nil {
+			return res, e
+		}
+		return b.makeParam(s, col)
+	case *big.Int:
+		if valuer == nil {
+			return b.makeParam(nil, col)
+		}
+		return b.makeParam(valuer.String(), col)
 	case driver.Valuer:
 		var e error
 		val, e = driver.DefaultParameterConverter.ConvertValue(valuer)
@@ -661,15 +947,32 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 			buf[i] = ub[j]
 		}
 		res.buffer = buf
-	case typeBigVarBin, typeBigBinary:
+	case typeBigVarBin, typeBigBinary, typeVarBinary, typeBinary, typeImage:
 		switch val := val.(type) {
 		case []byte:
-			res.ti.Size = len(val)
 			res.buffer = val
+		case string:
+			if col.ti.UdtInfo.TypeName != "" {
+				err = fmt.Errorf("mssql: %s column needs its serialized value as []byte, not a string", col.ti.UdtInfo.TypeName)
+				return
+			}
+			res.buffer = []byte(val)
 		default:
 			err = fmt.Errorf("mssql: invalid type for Binary column: %T %s", val, val)
 			return
 		}
+		res.ti.Size = len(res.buffer)
+	case typeXml:
+		switch val := val.(type) {
+		case string:
+			res.buffer = str2ucs2(val)
+		case []byte:
+			res.buffer = str2ucs2(string(val))
+		default:
+			err = fmt.Errorf("mssql: invalid type for xml column: %T %s", val, val)
+			return
+		}
+		res.ti.Size = len(res.buffer)
 	case typeGuid:
 		switch val := val.(type) {
 		case []byte:
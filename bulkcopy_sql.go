@@ -88,6 +88,32 @@ func (ci *copyin) Exec(v []driver.Value) (r driver.Result, err error) {
 	return driver.RowsAffected(0), nil
 }
 
+// ExecContext adds a row, or ends the bulk copy when there are no values,
+// cancelling it when ctx is done.
+func (ci *copyin) ExecContext(ctx context.Context, nv []driver.NamedValue) (r driver.Result, err error) {
+	if ci.closed {
+		return nil, errors.New("copyin query is closed")
+	}
+
+	if len(nv) == 0 {
+		rowCount, err := ci.bulkcopy.DoneContext(ctx)
+		ci.closed = true
+		return driver.RowsAffected(rowCount), err
+	}
+
+	t := make([]interface{}, len(nv))
+	for i, val := range nv {
+		t[i] = val.Value
+	}
+
+	err = ci.bulkcopy.AddRowContext(ctx, t)
+	if err != nil {
+		return
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
 func (ci *copyin) Close() (err error) {
 	return nil
 }
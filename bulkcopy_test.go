@@ -4,17 +4,23 @@
 package mssql
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"math"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-sql/civil"
+	"github.com/microsoft/go-mssqldb/msdsn"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBulkcopyWithInvalidNullableType(t *testing.T) {
@@ -143,6 +149,12 @@ func testBulkcopy(t *testing.T, guidConversion bool) {
 		{"test_nchar", "abcdefg   ", nil},
 		{"test_text", "abcdefg", nil},
 		{"test_ntext", "abcdefg", nil},
+		{"test_text_nil", nil, nil},
+		{"test_image", []byte("abcdefg"), nil},
+		{"text_xml", "<a>ab©</a>", nil},
+		{"test_variant", int64(42), nil},
+		{"test_nvarchar_4000", NVarCharMax("abc"), "abc"},
+		{"test_varchar_8000", VarChar("abc"), "abc"},
 		{"test_float", 1234.56, nil},
 		{"test_floatn", 1234.56, nil},
 		{"test_real", 1234.56, nil},
@@ -408,6 +420,9 @@ func setupTable(ctx context.Context, t *testing.T, conn *sql.Conn, tableName str
 	[test_nchar] [nchar](10) NULL,
 	[test_text] [text] NULL,
 	[test_ntext] [ntext] NULL,
+	[test_text_nil] [text] NULL,
+	[test_image] [image] NULL,
+	[test_variant] [sql_variant] NULL,
 	[test_float] [float] NOT NULL,
 	[test_floatn] [float] NULL,
 	[test_real] [real] NULL,
@@ -526,3 +541,218 @@ func TestBulkcopyFailure(t *testing.T) {
 	_, err = stmt.ExecContext(ctx)
 	assert.NoError(t, err)
 }
+
+func TestBulkcopyColumnMappings(t *testing.T) {
+	b := &Bulk{
+		tablename: "t",
+		metadata:  []columnStruct{{ColName: "id"}, {ColName: "name"}, {ColName: "price"}},
+		Options: BulkOptions{ColumnMappings: []BulkColumnMapping{
+			{Source: "title", Destination: "name"},
+			{SourceOrdinal: 3, DestinationOrdinal: 3},
+		}},
+	}
+	for i, want := range []string{"id", "name", "price"} {
+		col, err := b.destinationColumn(i, []string{"id", "title", "cost"}[i])
+		assert.NoError(t, err)
+		assert.Equal(t, want, col.ColName)
+	}
+
+	b.Options.ColumnMappings = []BulkColumnMapping{{Source: "a", DestinationOrdinal: 4}}
+	_, err := b.destinationColumn(0, "a")
+	assert.ErrorContains(t, err, "mapped to column 4")
+	_, err = b.destinationColumn(1, "b")
+	assert.ErrorContains(t, err, "column b does not exist in destination table t")
+
+	b.columnsName = []string{"id", "title", "name"}
+	b.Options.ColumnMappings = []BulkColumnMapping{{Source: "title", Destination: "name"}}
+	err = b.sendBulkCommand(context.Background())
+	assert.EqualError(t, err, "columns title and name are both copied to column name of destination table t")
+}
+
+func TestBulkcopyKeepIdentity(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := testContext(t)
+	conn, err := pool.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE #keepidentity (id INT IDENTITY(1,1) NOT NULL, name NVARCHAR(20))")
+	require.NoError(t, err)
+
+	options := BulkOptions{
+		KeepIdentity:   true,
+		ColumnMappings: []BulkColumnMapping{{Source: "feed_id", Destination: "id"}, {SourceOrdinal: 2, DestinationOrdinal: 2}},
+	}
+	stmt, err := conn.PrepareContext(ctx, CopyIn("#keepidentity", options, "feed_id", "feed_name"))
+	require.NoError(t, err)
+	_, err = stmt.ExecContext(ctx, 42, "a")
+	require.NoError(t, err)
+	_, err = stmt.ExecContext(ctx, 7, "b")
+	require.NoError(t, err)
+	_, err = stmt.ExecContext(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stmt.Close())
+
+	var ids, names string
+	err = conn.QueryRowContext(ctx, "SELECT STRING_AGG(CAST(id AS NVARCHAR(10)), ',') WITHIN GROUP (ORDER BY id), STRING_AGG(name, ',') WITHIN GROUP (ORDER BY id) FROM #keepidentity").Scan(&ids, &names)
+	require.NoError(t, err)
+	assert.Equal(t, "7,42", ids)
+	assert.Equal(t, "b,a", names)
+
+	// IDENTITY_INSERT is turned off once the copy is done.
+	_, err = conn.ExecContext(ctx, "INSERT INTO #keepidentity (name) VALUES ('c')")
+	assert.NoError(t, err)
+}
+
+func TestBulkcopyCopyInNotify(t *testing.T) {
+	stmt := CopyIn("t", BulkOptions{CommitBatches: true, RowsPerBatch: 10, NotifyAfter: 5, Notify: func(int64) {}}, "a")
+	assert.Contains(t, stmt, `"CommitBatches":true`)
+	assert.NotContains(t, stmt, "Notify\":{")
+
+	err := &BulkBatchError{Batch: 2, FirstRow: 11, RowsCopied: 10, Err: errors.New("boom")}
+	assert.Equal(t, "mssql: bulk copy batch 2 starting at row 11 failed after 10 rows were copied: boom", err.Error())
+}
+
+func TestBulkcopyCommitBatches(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := testContext(t)
+	conn, err := pool.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE #batches (id INT NOT NULL PRIMARY KEY)")
+	require.NoError(t, err)
+
+	var notified []int64
+	err = conn.Raw(func(driverConn any) error {
+		b := driverConn.(*Conn).CreateBulkContext(ctx, "#batches", []string{"id"})
+		b.Options = BulkOptions{
+			CommitBatches: true,
+			RowsPerBatch:  2,
+			NotifyAfter:   2,
+			Notify:        func(rows int64) { notified = append(notified, rows) },
+		}
+		for _, id := range []int{1, 2, 3, 3, 4} {
+			if err := b.AddRow([]interface{}{id}); err != nil {
+				break
+			}
+		}
+		rows, err := b.Done()
+		var batchErr *BulkBatchError
+		require.True(t, errors.As(err, &batchErr), "%v", err)
+		assert.Equal(t, 2, batchErr.Batch)
+		assert.Equal(t, int64(3), batchErr.FirstRow)
+		assert.Equal(t, int64(2), batchErr.RowsCopied)
+		assert.Equal(t, int64(2), rows)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 4}, notified)
+
+	var count int
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM #batches").Scan(&count))
+	assert.Equal(t, 2, count, "the first batch is committed")
+}
+
+// bulkTransport records the packets written to it and replies with a
+// canned response.
+type bulkTransport struct {
+	written bytes.Buffer
+	reply   *bytes.Reader
+}
+
+func (t *bulkTransport) Read(p []byte) (int, error)  { return t.reply.Read(p) }
+func (t *bulkTransport) Write(p []byte) (int, error) { return t.written.Write(p) }
+func (t *bulkTransport) Close() error                { return nil }
+
+func TestBulkcopyCancelSendsAttention(t *testing.T) {
+	done := []byte{byte(tokenDone), doneAttn, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	reply := append([]byte{byte(packReply), 1, 0, byte(8 + len(done)), 0, 0, 1, 0}, done...)
+	transport := &bulkTransport{reply: bytes.NewReader(reply)}
+	conn := &Conn{connectionGood: true, sess: &tdsSession{
+		buf:      newTdsBuffer(defaultPacketSize, transport),
+		loginAck: loginAckStruct{TDSVersion: verTDS74},
+	}}
+	b := conn.CreateBulk("t", []string{"id"})
+	b.headerSent = true
+	b.bulkColumns = []columnStruct{{ColName: "id", ti: typeInfo{TypeId: typeIntN, Size: 4, Writer: writeByteLenType}}}
+	require.NoError(t, b.beginBatchRows())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := b.AddRowContext(ctx, []interface{}{1})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = b.DoneContext(context.Background())
+	assert.ErrorIs(t, err, context.Canceled, "the copy stays cancelled")
+	assert.True(t, conn.connectionGood)
+
+	packets := transport.written.Bytes()
+	require.Greater(t, len(packets), 8)
+	assert.Equal(t, byte(packBulkLoadBCP), packets[0])
+	assert.Equal(t, byte(3), packets[1], "the bulk data is ignored")
+	size := int(binary.BigEndian.Uint16(packets[2:]))
+	assert.Equal(t, []byte{byte(packAttention), 1, 0, 8}, packets[size:size+4])
+}
+
+func TestBulkcopyMakeParamTypes(t *testing.T) {
+	b := &Bulk{cn: &Conn{}}
+	date := civil.Date{Year: 2024, Month: 2, Day: 29}
+	geog := columnStruct{ti: typeInfo{TypeId: typeBigVarBin, Size: 0xffff, UdtInfo: udtInfo{TypeName: "geography"}}}
+	for _, test := range []struct {
+		value interface{}
+		col   columnStruct
+		want  []byte
+	}{
+		{"<a>é</a>", columnStruct{ti: typeInfo{TypeId: typeXml}}, str2ucs2("<a>é</a>")},
+		{[]byte("<a/>"), columnStruct{ti: typeInfo{TypeId: typeXml}}, str2ucs2("<a/>")},
+		{"ab", columnStruct{ti: typeInfo{TypeId: typeImage, Size: 0x7fffffff}}, []byte("ab")},
+		{[]byte{1, 2}, columnStruct{ti: typeInfo{TypeId: typeImage, Size: 0x7fffffff}}, []byte{1, 2}},
+		{"ab", columnStruct{ti: typeInfo{TypeId: typeBigVarBin, Size: 10}}, []byte("ab")},
+		{[]byte{0xe6, 0x10}, geog, []byte{0xe6, 0x10}},
+		{VarChar("abc"), columnStruct{ti: typeInfo{TypeId: typeText, Size: 0x7fffffff}}, []byte("abc")},
+		{NVarCharMax("abc"), columnStruct{ti: typeInfo{TypeId: typeNText, Size: 0x7fffffff}}, str2ucs2("abc")},
+		{NChar("ab"), columnStruct{ti: typeInfo{TypeId: typeNChar, Size: 4}}, str2ucs2("ab")},
+		{TypedParam{Value: "ab", Type: "varchar(10)"}, columnStruct{ti: typeInfo{TypeId: typeNVarChar, Size: 20}}, str2ucs2("ab")},
+		{int16(-2), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 2}}, []byte{0xfe, 0xff}},
+		{uint8(7), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 1}}, []byte{7}},
+		// Unlike TypedParam, bulk copy truncates floats sent to integer columns.
+		{2.7, columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 4}}, []byte{2, 0, 0, 0}},
+		{date, columnStruct{ti: typeInfo{TypeId: typeDateN}}, encodeDate(date.In(time.UTC))},
+		{DateTime1(date.In(time.UTC)), columnStruct{ti: typeInfo{TypeId: typeDateTimeN, Size: 8}}, encodeDateTime(date.In(time.UTC))},
+		{nil, columnStruct{ti: typeInfo{TypeId: typeXml}}, nil},
+	} {
+		p, err := b.makeParam(test.value, test.col)
+		require.NoError(t, err, "%T", test.value)
+		assert.Equal(t, test.want, p.buffer, "%T", test.value)
+		assert.Equal(t, len(test.want), p.ti.Size, "%T", test.value)
+	}
+
+	_, err := b.makeParam("POINT(1 2)", geog)
+	assert.ErrorContains(t, err, "geography")
+	_, err = b.makeParam(1, columnStruct{ti: typeInfo{TypeId: typeXml}})
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeLongLenType(&buf, typeInfo{TypeId: typeText}, nil, msdsn.EncodeParameters{}))
+	assert.Equal(t, []byte{0}, buf.Bytes(), "NULL text has an empty textptr")
+	buf.Reset()
+	ti := typeInfo{TypeId: typeXml}
+	require.NoError(t, writeTypeInfo(&buf, &ti, false, msdsn.EncodeParameters{}))
+	assert.Equal(t, []byte{typeXml, 0}, buf.Bytes())
+	buf.Reset()
+	ti = typeInfo{TypeId: typeImage, Size: 0x7fffffff}
+	require.NoError(t, writeTypeInfo(&buf, &ti, false, msdsn.EncodeParameters{}))
+	assert.Equal(t, []byte{typeImage, 0xff, 0xff, 0xff, 0x7f}, buf.Bytes(), "image has no collation")
+}
@@ -0,0 +1,187 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/microsoft/go-mssqldb/aecmk"
+	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/algorithms"
+	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/encryption"
+	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/keys"
+)
+
+// aeadAlgorithmVersion is the version byte starting the ciphertexts of
+// AEAD_AES_256_CBC_HMAC_SHA256.
+const aeadAlgorithmVersion = 1
+
+// bulkEncryptedColumn encrypts the values of a column protected by Always
+// Encrypted. The bulk column keeps the type of the plaintext, so values are
+// converted as for any other column, and the ciphertext is sent with the
+// varbinary type of the column.
+type bulkEncryptedColumn struct {
+	ti typeInfo
+	// ordinal is the index of the key in the CEK table of the COLMETADATA.
+	ordinal uint16
+	meta    *cryptoMetadata
+	alg     algorithms.AeadAes256CbcHmac256Algorithm
+}
+
+// prepareEncryption sets up the encryption of the bulk columns the server
+// reported as encrypted. Their column encryption keys are decrypted with the
+// key providers of the connection.
+func (b *Bulk) prepareEncryption(ctx context.Context) error {
+	ceks := make(map[*cekTableEntry][]byte)
+	for i := range b.bulkColumns {
+		col := &b.bulkColumns[i]
+		meta := col.cryptoMeta
+		if meta == nil {
+			continue
+		}
+		if meta.algorithmId != cipherAlgAeadAes256CbcHmacSha256 {
+			return fmt.Errorf("mssql: column %s is encrypted with unsupported algorithm %d", col.ColName, meta.algorithmId)
+		}
+		ordinal := -1
+		for j, entry := range b.cekEntries {
+			if entry == meta.entry {
+				ordinal = j
+				break
+			}
+		}
+		if ordinal < 0 {
+			cek, err := b.decryptCek(ctx, meta.entry)
+			if err != nil {
+				return err
+			}
+			ceks[meta.entry] = cek
+			ordinal = len(b.cekEntries)
+			b.cekEntries = append(b.cekEntries, meta.entry)
+		}
+		if b.encrypted == nil {
+			b.encrypted = make([]*bulkEncryptedColumn, len(b.bulkColumns))
+		}
+		k := keys.NewAeadAes256CbcHmac256(ceks[meta.entry])
+		b.encrypted[i] = &bulkEncryptedColumn{
+			ti:      col.ti,
+			ordinal: uint16(ordinal),
+			meta:    meta,
+			alg:     algorithms.NewAeadAes256CbcHmac256Algorithm(k, encryption.From(meta.encType), aeadAlgorithmVersion),
+		}
+		col.ti = meta.typeInfo
+		b.dlogf(ctx, "Encrypting column %s, key %d, encryption type %d", col.ColName, meta.entry.keyId, meta.encType)
+	}
+	return nil
+}
+
+// decryptCek decrypts a column encryption key with the first of its values
+// whose key store has a provider.
+func (b *Bulk) decryptCek(ctx context.Context, entry *cekTableEntry) ([]byte, error) {
+	if entry == nil || len(entry.cekValues) == 0 {
+		return nil, aecmk.NewError(aecmk.Encryption, "No column encryption key was returned for the bulk copy", nil)
+	}
+	for _, v := range entry.cekValues {
+		kp, ok := b.cn.sess.aeSettings.keyProviders[v.keyStoreName]
+		if !ok {
+			continue
+		}
+		return kp.GetDecryptedKey(ctx, v.keyPath, v.encryptedKey)
+	}
+	return nil, aecmk.NewError(aecmk.Encryption, fmt.Sprintf("Unable to find provider %s to decrypt CEK", entry.cekValues[0].keyStoreName), nil)
+}
+
+// encryptedColumn returns the encryption of the bulk column i, or nil when
+// it is not encrypted.
+func (b *Bulk) encryptedColumn(i int) *bulkEncryptedColumn {
+	if b.encrypted == nil {
+		return nil
+	}
+	return b.encrypted[i]
+}
+
+// writeCekTable writes the CEK table of the COLMETADATA, with the keys of
+// the encrypted columns.
+func (b *Bulk) writeCekTable(w *bytes.Buffer) {
+	binary.Write(w, binary.LittleEndian, uint16(len(b.cekEntries)))
+	for _, entry := range b.cekEntries {
+		binary.Write(w, binary.LittleEndian, int32(entry.databaseID))
+		binary.Write(w, binary.LittleEndian, int32(entry.keyId))
+		binary.Write(w, binary.LittleEndian, int32(entry.keyVersion))
+		w.Write(entry.mdVersion)
+		w.WriteByte(byte(len(entry.cekValues)))
+		for _, v := range entry.cekValues {
+			binary.Write(w, binary.LittleEndian, uint16(len(v.encryptedKey)))
+			w.Write(v.encryptedKey)
+			writeBVarChar(w, v.keyStoreName)
+			writeUsVarChar(w, v.keyPath)
+			writeBVarChar(w, v.algorithmName)
+		}
+	}
+}
+
+// writeCryptoMetadata writes the CryptoMetaData of the encrypted bulk column
+// i, whose plaintext type is the type of the column.
+func (b *Bulk) writeCryptoMetadata(w *bytes.Buffer, i int, enc *bulkEncryptedColumn) {
+	binary.Write(w, binary.LittleEndian, enc.ordinal)
+	binary.Write(w, binary.LittleEndian, b.bulkColumns[i].ti.UserType)
+	writeTypeInfo(w, &b.bulkColumns[i].ti, false, b.cn.sess.encoding)
+	w.WriteByte(enc.meta.algorithmId)
+	w.WriteByte(enc.meta.encType)
+	w.WriteByte(enc.meta.normRuleVer)
+}
+
+// writeValue writes the value of the bulk column i of a row. The values of
+// encrypted columns are encrypted and written as varbinary, NULL staying
+// NULL.
+func (b *Bulk) writeValue(w io.Writer, i int, p param) error {
+	col := &b.bulkColumns[i]
+	writer := col.ti.Writer
+	if enc := b.encryptedColumn(i); enc != nil {
+		writer = enc.ti.Writer
+		if p.buffer != nil {
+			ciphertext, err := enc.alg.Encrypt(normalizeEncryptedValue(col.ti, p.buffer))
+			if err != nil {
+				return aecmk.NewError(aecmk.Encryption, fmt.Sprintf("Unable to encrypt the value of column %s", col.ColName), err)
+			}
+			p = param{ti: typeInfo{TypeId: enc.ti.TypeId, Size: len(ciphertext)}, buffer: ciphertext}
+		}
+	}
+	if writer == nil {
+		return fmt.Errorf("no writer for column: %s, TypeId: %#x", col.ColName, col.ti.TypeId)
+	}
+	if err := writer(w, p.ti, p.buffer, b.cn.sess.encoding); err != nil {
+		return fmt.Errorf("bulkcopy: %s", err.Error())
+	}
+	return nil
+}
+
+// normalizeEncryptedValue returns the plaintext encrypted for a value of a
+// column of type ti. Normalization rule version 1 stores integers and bits
+// on 8 bytes and decimals with 16 bytes of magnitude.
+func normalizeEncryptedValue(ti typeInfo, buf []byte) []byte {
+	switch ti.TypeId {
+	case typeInt1, typeInt2, typeInt4, typeInt8, typeIntN, typeBit, typeBitN:
+		var v int64
+		switch len(buf) {
+		case 1:
+			v = int64(buf[0])
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(buf)))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(buf)))
+		default:
+			return buf
+		}
+		n := make([]byte, 8)
+		binary.LittleEndian.PutUint64(n, uint64(v))
+		return n
+	case typeDecimal, typeDecimalN, typeNumeric, typeNumericN:
+		if len(buf) < 17 {
+			n := make([]byte, 17)
+			copy(n, buf)
+			return n
+		}
+	}
+	return buf
+}
@@ -0,0 +1,161 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/aecmk"
+	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/algorithms"
+	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/encryption"
+	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encryptedBulk returns a bulk copy of an int column encrypted with cek and
+// a plain nvarchar column, as reported by the server.
+func encryptedBulk(t *testing.T, cek []byte) *Bulk {
+	t.Helper()
+	var lifetime time.Duration
+	provider := &testKeyProvider{
+		decrypt: func(ctx context.Context, masterKeyPath string, encryptionAlgorithm string, encryptedCek []byte) ([]byte, error) {
+			assert.Equal(t, "cmkpath", masterKeyPath)
+			assert.Equal(t, []byte{9, 9, 9}, encryptedCek)
+			return cek, nil
+		},
+		lifetime: &lifetime,
+	}
+	entry := &cekTableEntry{
+		databaseID: 5,
+		keyId:      7,
+		keyVersion: 1,
+		mdVersion:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		valueCount: 1,
+		cekValues: []encryptionKeyInfo{{
+			encryptedKey:  []byte{9, 9, 9},
+			keyPath:       "cmkpath",
+			keyStoreName:  "TEST_STORE",
+			algorithmName: KeyEncryptionAlgorithm,
+		}},
+	}
+	conn := &Conn{sess: &tdsSession{
+		alwaysEncrypted: true,
+		loginAck:        loginAckStruct{TDSVersion: verTDS74},
+		aeSettings: &alwaysEncryptedSettings{keyProviders: aecmk.ColumnEncryptionKeyProviderMap{
+			"TEST_STORE": aecmk.NewCekProvider(provider),
+		}},
+	}}
+	b := conn.CreateBulk("t", []string{"id", "name"})
+	b.bulkColumns = []columnStruct{
+		{
+			ColName: "id",
+			Flags:   colFlagEncrypted | colFlagNullable,
+			ti:      typeInfo{TypeId: typeBigVarBin, Size: 65},
+			cryptoMeta: &cryptoMetadata{
+				entry:       entry,
+				algorithmId: cipherAlgAeadAes256CbcHmacSha256,
+				encType:     byte(ColumnEncryptionDeterministic),
+				normRuleVer: 1,
+				typeInfo:    typeInfo{TypeId: typeIntN, Size: 4},
+			},
+		},
+		{ColName: "name", ti: typeInfo{TypeId: typeNVarChar, Size: 20}},
+	}
+	require.NoError(t, b.prepareEncryption(context.Background()))
+	return b
+}
+
+func TestBulkEncryptedColMetadata(t *testing.T) {
+	b := encryptedBulk(t, make([]byte, 32))
+	assert.Equal(t, typeIntN, int(b.bulkColumns[0].ti.TypeId), "the bulk column has the plaintext type")
+	assert.Nil(t, b.encryptedColumn(1))
+
+	data := b.createColMetadata()
+	require.Equal(t, byte(tokenColMetadata), data[0])
+	r := &tdsBuffer{rbuf: data[1:], rsize: len(data) - 1, transport: RWCBuffer{buffer: bytes.NewReader(nil)}}
+	cols := parseColMetadata72(r, b.cn.sess)
+	require.Len(t, cols, 2)
+	assert.Equal(t, len(data)-1, r.rpos, "the whole metadata is read")
+
+	id := cols[0]
+	assert.Equal(t, "id", id.ColName)
+	assert.True(t, id.isEncrypted())
+	assert.Equal(t, byte(typeBigVarBin), id.ti.TypeId)
+	require.NotNil(t, id.cryptoMeta)
+	assert.Equal(t, byte(typeIntN), id.cryptoMeta.typeInfo.TypeId)
+	assert.Equal(t, 4, id.cryptoMeta.typeInfo.Size)
+	assert.Equal(t, byte(ColumnEncryptionDeterministic), id.cryptoMeta.encType)
+	assert.Equal(t, byte(1), id.cryptoMeta.normRuleVer)
+	require.NotNil(t, id.cryptoMeta.entry)
+	assert.Equal(t, 7, id.cryptoMeta.entry.keyId)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, id.cryptoMeta.entry.mdVersion)
+	require.Len(t, id.cryptoMeta.entry.cekValues, 1)
+	assert.Equal(t, "TEST_STORE", id.cryptoMeta.entry.cekValues[0].keyStoreName)
+	assert.Equal(t, "cmkpath", id.cryptoMeta.entry.cekValues[0].keyPath)
+
+	assert.Equal(t, "name", cols[1].ColName)
+	assert.Nil(t, cols[1].cryptoMeta)
+}
+
+func TestBulkEncryptedRowData(t *testing.T) {
+	cek := make([]byte, 32)
+	for i := range cek {
+		cek[i] = byte(i)
+	}
+	b := encryptedBulk(t, cek)
+	b.createColMetadata()
+
+	data, err := b.makeRowData([]interface{}{-5, "x"})
+	require.NoError(t, err)
+	require.Equal(t, byte(tokenRow), data[0])
+	n := int(binary.LittleEndian.Uint16(data[1:]))
+	ciphertext := data[3 : 3+n]
+	assert.Equal(t, []byte{2, 0, 'x', 0}, data[3+n:], "the plain column is not encrypted")
+
+	alg := algorithms.NewAeadAes256CbcHmac256Algorithm(keys.NewAeadAes256CbcHmac256(cek), encryption.From(byte(ColumnEncryptionDeterministic)), aeadAlgorithmVersion)
+	plaintext, err := alg.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xfb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, plaintext, "ints are encrypted on 8 bytes")
+
+	data, err = b.makeRowData([]interface{}{nil, "x"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(tokenRow), 0xff, 0xff, 2, 0, 'x', 0}, data, "NULL is not encrypted")
+}
+
+func TestBulkEncryptionErrors(t *testing.T) {
+	b := encryptedBulk(t, make([]byte, 32))
+	b.cn.sess.aeSettings.keyProviders = aecmk.ColumnEncryptionKeyProviderMap{}
+	b.cekEntries, b.encrypted = nil, nil
+	b.bulkColumns[0].ti = typeInfo{TypeId: typeBigVarBin, Size: 65}
+	err := b.prepareEncryption(context.Background())
+	assert.ErrorContains(t, err, "Unable to find provider TEST_STORE")
+
+	b.bulkColumns[0].cryptoMeta.algorithmId = cipherAlgCustom
+	err = b.prepareEncryption(context.Background())
+	assert.ErrorContains(t, err, "column id is encrypted with unsupported algorithm 0")
+}
+
+func TestNormalizeEncryptedValue(t *testing.T) {
+	tests := []struct {
+		name string
+		ti   typeInfo
+		buf  []byte
+		want []byte
+	}{
+		{"tinyint", typeInfo{TypeId: typeIntN, Size: 1}, []byte{0xff}, []byte{0xff, 0, 0, 0, 0, 0, 0, 0}},
+		{"smallint", typeInfo{TypeId: typeIntN, Size: 2}, []byte{0xfe, 0xff}, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"int", typeInfo{TypeId: typeInt4, Size: 4}, []byte{1, 2, 3, 4}, []byte{1, 2, 3, 4, 0, 0, 0, 0}},
+		{"bigint", typeInfo{TypeId: typeIntN, Size: 8}, []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"bit", typeInfo{TypeId: typeBitN, Size: 1}, []byte{1}, []byte{1, 0, 0, 0, 0, 0, 0, 0}},
+		{"decimal", typeInfo{TypeId: typeDecimalN, Size: 5}, []byte{1, 10, 0, 0, 0}, append([]byte{1, 10}, make([]byte, 15)...)},
+		{"nvarchar", typeInfo{TypeId: typeNVarChar, Size: 20}, []byte{'a', 0}, []byte{'a', 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeEncryptedValue(tt.ti, tt.buf))
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"reflect"
+	"strings"
+)
+
+const (
+	mssqlTag = "mssql"
+	dbTag    = "db"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// BulkInsert bulk copies rows to table. T is a struct, or a pointer to a
+// struct, whose exported fields are copied to the columns named by their
+// mssql or db tag, or by the field name when they have none. Fields tagged
+// "-" are skipped, as with TVP. The encoders of the fields are chosen once,
+// so rows are streamed without building a []interface{} for each of them.
+//
+// Unlike AddRow, which sends the low bytes of integers out of the range of
+// their column, BulkInsert rejects them.
+//
+// BulkInsert returns the number of rows copied. When a row cannot be
+// encoded the copy stops, and the rows sent before it are kept unless the
+// copy runs in a transaction that is rolled back.
+func BulkInsert[T any](ctx context.Context, conn *Conn, table string, rows iter.Seq[T], opts BulkOptions) (int64, error) {
+	fields, err := bulkStructFields(reflect.TypeFor[T]())
+	if err != nil {
+		return 0, err
+	}
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.column
+	}
+
+	b := conn.CreateBulkContext(ctx, table, columns)
+	b.Options = opts
+	if err = b.sendBulkCommand(ctx); err != nil {
+		return 0, err
+	}
+	enc := b.newStructEncoder(fields)
+	for row := range rows {
+		if err = enc.addRow(reflect.ValueOf(&row).Elem()); err != nil {
+			break
+		}
+	}
+	rowCount, doneErr := b.Done()
+	if err == nil {
+		err = doneErr
+	}
+	return rowCount, err
+}
+
+// bulkField is a struct field copied to a column.
+type bulkField struct {
+	index  int
+	column string
+	typ    reflect.Type
+}
+
+// bulkStructFields returns the fields of t copied by BulkInsert.
+func bulkStructFields(t reflect.Type) ([]bulkField, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("mssql: BulkInsert rows must be structs, not %v", t)
+	}
+	var fields []bulkField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		mssqlTagValue, isMssqlTag := field.Tag.Lookup(mssqlTag)
+		dbTagValue, isDbTag := field.Tag.Lookup(dbTag)
+		if IsSkipField(mssqlTagValue, isMssqlTag, dbTagValue, isDbTag) {
+			continue
+		}
+		name := mssqlTagValue
+		if !isMssqlTag {
+			name = dbTagValue
+		}
+		name, _, _ = strings.Cut(name, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, bulkField{index: i, column: name, typ: field.Type})
+	}
+	if len(fields) == 0 {
+		return nil, ErrorSkip
+	}
+	return fields, nil
+}
+
+// bulkFieldEncoder encodes the value of a field for its column.
+type bulkFieldEncoder func(v reflect.Value) (param, error)
+
+type bulkStructEncoder struct {
+	b        *Bulk
+	fields   []bulkField
+	encoders []bulkFieldEncoder
+	row      bytes.Buffer
+}
+
+func (b *Bulk) newStructEncoder(fields []bulkField) *bulkStructEncoder {
+	enc := &bulkStructEncoder{b: b, fields: fields, encoders: make([]bulkFieldEncoder, len(fields))}
+	for i, f := range fields {
+		enc.encoders[i] = b.fieldEncoder(f.typ, b.bulkColumns[i])
+	}
+	return enc
+}
+
+// addRow writes the row of a struct value, reusing the row buffer.
+func (enc *bulkStructEncoder) addRow(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errors.New("mssql: BulkInsert row is nil")
+		}
+		v = v.Elem()
+	}
+	enc.row.Reset()
+	enc.row.WriteByte(byte(tokenRow))
+	for i, f := range enc.fields {
+		col := &enc.b.bulkColumns[i]
+		p, err := enc.encoders[i](v.Field(f.index))
+		if err != nil {
+			return fmt.Errorf("bulkcopy: row %d column %s: %v", enc.b.numRows, col.ColName, err)
+		}
+		if err = enc.b.writeValue(&enc.row, i, p); err != nil {
+			return err
+		}
+	}
+	return enc.b.writeRow(enc.b.ctx, enc.row.Bytes())
+}
+
+// fieldEncoder returns the encoder of the fields of type t for col. Integer,
+// float and bool fields of matching columns are encoded directly in a
+// buffer reused for every row; other fields are encoded by Bulk.makeParam.
+func (b *Bulk) fieldEncoder(t reflect.Type, col columnStruct) bulkFieldEncoder {
+	if t.Implements(valuerType) {
+		return func(v reflect.Value) (param, error) {
+			return b.makeParam(v.Interface(), col)
+		}
+	}
+	ti := typeInfo{TypeId: col.ti.TypeId, Size: col.ti.Size}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := b.fieldEncoder(t.Elem(), col)
+		return func(v reflect.Value) (param, error) {
+			if v.IsNil() {
+				return b.makeParam(nil, col)
+			}
+			return elem(v.Elem())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		enc := b.intEncoder(col)
+		return func(v reflect.Value) (param, error) {
+			return enc(v.Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		enc := b.intEncoder(col)
+		return func(v reflect.Value) (param, error) {
+			u := v.Uint()
+			if u > math.MaxInt64 {
+				return param{}, fmt.Errorf("value %d out of range", u)
+			}
+			return enc(int64(u))
+		}
+	case reflect.Float32, reflect.Float64:
+		switch col.ti.TypeId {
+		case typeFlt4, typeFlt8, typeFltN:
+			buf := make([]byte, col.ti.Size)
+			return func(v reflect.Value) (param, error) {
+				if col.ti.Size == 4 {
+					binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(v.Float())))
+				} else {
+					binary.LittleEndian.PutUint64(buf, math.Float64bits(v.Float()))
+				}
+				return param{ti: ti, buffer: buf}, nil
+			}
+		}
+		return func(v reflect.Value) (param, error) {
+			return b.makeParam(v.Float(), col)
+		}
+	case reflect.Bool:
+		switch col.ti.TypeId {
+		case typeBit, typeBitN:
+			buf := make([]byte, 1)
+			return func(v reflect.Value) (param, error) {
+				buf[0] = 0
+				if v.Bool() {
+					buf[0] = 1
+				}
+				return param{ti: typeInfo{TypeId: typeBitN, Size: 1}, buffer: buf}, nil
+			}
+		}
+		return func(v reflect.Value) (param, error) {
+			return b.makeParam(v.Bool(), col)
+		}
+	case reflect.String:
+		return func(v reflect.Value) (param, error) {
+			return b.makeParam(v.String(), col)
+		}
+	}
+	return func(v reflect.Value) (param, error) {
+		return b.makeParam(v.Interface(), col)
+	}
+}
+
+// intEncoder returns the encoder of integer values for col.
+func (b *Bulk) intEncoder(col columnStruct) func(int64) (param, error) {
+	switch col.ti.TypeId {
+	case typeInt1, typeInt2, typeInt4, typeInt8, typeIntN:
+		ti := typeInfo{TypeId: col.ti.TypeId, Size: col.ti.Size}
+		buf := make([]byte, col.ti.Size)
+		return func(v int64) (param, error) {
+			return param{ti: ti, buffer: buf}, putBulkInt(buf, col, v)
+		}
+	}
+	return func(v int64) (param, error) {
+		return b.makeParam(v, col)
+	}
+}
+
+// putBulkInt writes an integer value of an integer column, checking that it
+// fits the column. Bulk.makeParam, used by AddRow, does not check the range.
+func putBulkInt(buf []byte, col columnStruct, v int64) error {
+	switch col.ti.Size {
+	case 1:
+		if v < 0 || v > math.MaxUint8 {
+			return fmt.Errorf("value %d out of range for tinyint", v)
+		}
+		buf[0] = byte(v)
+	case 2:
+		if v < math.MinInt16 || v > math.MaxInt16 {
+			return fmt.Errorf("value %d out of range for smallint", v)
+		}
+		binary.LittleEndian.PutUint16(buf, uint16(v))
+	case 4:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return fmt.Errorf("value %d out of range for int", v)
+		}
+		binary.LittleEndian.PutUint32(buf, uint32(v))
+	case 8:
+		binary.LittleEndian.PutUint64(buf, uint64(v))
+	default:
+		return fmt.Errorf("mssql: invalid size of column %d", col.ti.Size)
+	}
+	return nil
+}
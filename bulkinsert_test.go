@@ -0,0 +1,140 @@
+package mssql
+
+import (
+	"database/sql"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkInsertRow struct {
+	ID       int64  `mssql:"id"`
+	Name     string `db:"name,omitempty"`
+	Price    *float64
+	Active   bool           `mssql:"active" db:"-"`
+	Created  time.Time      `db:"created"`
+	Count    uint8          `db:"count"`
+	Note     sql.NullString `db:"note"`
+	Skipped  string         `db:"-"`
+	internal string
+}
+
+func TestBulkStructFields(t *testing.T) {
+	fields, err := bulkStructFields(reflect.TypeOf(&bulkInsertRow{}))
+	require.NoError(t, err)
+	var columns []string
+	for _, f := range fields {
+		columns = append(columns, f.column)
+	}
+	assert.Equal(t, []string{"id", "name", "Price", "active", "created", "count", "note"}, columns)
+	assert.Equal(t, 5, fields[5].index)
+
+	_, err = bulkStructFields(reflect.TypeOf(1))
+	assert.Error(t, err)
+	_, err = bulkStructFields(reflect.TypeOf(struct {
+		A int `mssql:"-"`
+	}{}))
+	assert.Equal(t, ErrorSkip, err)
+}
+
+func TestBulkFieldEncoder(t *testing.T) {
+	b := &Bulk{cn: &Conn{}}
+	price := 1.5
+	for _, test := range []struct {
+		value interface{}
+		col   columnStruct
+		want  interface{}
+	}{
+		{int64(-3), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 4}}, -3},
+		{int16(7), columnStruct{ti: typeInfo{TypeId: typeInt2, Size: 2}}, 7},
+		{uint8(255), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 1}}, 255},
+		{uint32(9), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 8}}, 9},
+		{12, columnStruct{ti: typeInfo{TypeId: typeDecimalN, Prec: 10, Scale: 2}}, 12},
+		{float32(2.5), columnStruct{ti: typeInfo{TypeId: typeFltN, Size: 4}}, 2.5},
+		{2.5, columnStruct{ti: typeInfo{TypeId: typeFltN, Size: 8}}, 2.5},
+		{&price, columnStruct{ti: typeInfo{TypeId: typeFltN, Size: 8}}, price},
+		{(*float64)(nil), columnStruct{ti: typeInfo{TypeId: typeFltN, Size: 8}}, nil},
+		{true, columnStruct{ti: typeInfo{TypeId: typeBitN, Size: 1}}, true},
+		{"abc", columnStruct{ti: typeInfo{TypeId: typeNVarChar, Size: 100}}, "abc"},
+		{sql.NullString{String: "x", Valid: true}, columnStruct{ti: typeInfo{TypeId: typeNVarChar, Size: 100}}, "x"},
+	} {
+		got, err := b.fieldEncoder(reflect.TypeOf(test.value), test.col)(reflect.ValueOf(test.value))
+		require.NoError(t, err, "%T", test.value)
+		want, err := b.makeParam(test.want, test.col)
+		require.NoError(t, err, "%T", test.value)
+		assert.Equal(t, want.ti.TypeId, got.ti.TypeId, "%T", test.value)
+		assert.Equal(t, want.ti.Size, got.ti.Size, "%T", test.value)
+		assert.Equal(t, want.buffer, got.buffer, "%T", test.value)
+	}
+
+	for _, test := range []struct {
+		value interface{}
+		col   columnStruct
+	}{
+		{256, columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 1}}},
+		{-1, columnStruct{ti: typeInfo{TypeId: typeInt1, Size: 1}}},
+		{int64(1 << 40), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 4}}},
+		{uint64(1 << 63), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 8}}},
+	} {
+		_, err := b.fieldEncoder(reflect.TypeOf(test.value), test.col)(reflect.ValueOf(test.value))
+		assert.Error(t, err, "%T %v", test.value, test.value)
+	}
+
+	// AddRow keeps writing the low bytes of integers out of range.
+	p, err := b.makeParam(256, columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0}, p.buffer)
+}
+
+func TestBulkInsert(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `create table #bulkinsert (
+		id bigint not null,
+		name nvarchar(20),
+		Price float,
+		active bit,
+		created datetime2,
+		count tinyint,
+		note nvarchar(20))`)
+	require.NoError(t, err)
+
+	price := 9.5
+	created := time.Date(2024, 2, 29, 13, 14, 15, 0, time.UTC)
+	rows := []bulkInsertRow{
+		{ID: 1, Name: "a", Price: &price, Active: true, Created: created, Count: 3, Note: sql.NullString{String: "n", Valid: true}},
+		{ID: 2, Name: "b", Created: created},
+	}
+	err = conn.Raw(func(driverConn any) error {
+		n, err := BulkInsert(ctx, driverConn.(*Conn), "#bulkinsert", slices.Values(rows), BulkOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		return nil
+	})
+	require.NoError(t, err)
+
+	var count int
+	var total float64
+	var notes int
+	err = conn.QueryRowContext(ctx, "select count(*), sum(isnull(Price, 0)), count(note) from #bulkinsert where created = @p1", created).Scan(&count, &total, &notes)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, price, total)
+	assert.Equal(t, 1, notes)
+}
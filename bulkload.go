@@ -0,0 +1,403 @@
+package mssql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BinaryEncoding is the text encoding of binary values loaded by
+// BulkLoadCSV and BulkLoadNDJSON.
+type BinaryEncoding int
+
+const (
+	// BinaryHex reads binary values as hexadecimal, with an optional 0x
+	// prefix.
+	BinaryHex BinaryEncoding = iota
+	// BinaryBase64 reads binary values as standard base64.
+	BinaryBase64
+)
+
+// BulkLoadOptions configures BulkLoadCSV and BulkLoadNDJSON.
+type BulkLoadOptions struct {
+	BulkOptions
+	// Columns names the destination columns of the fields of each record.
+	// When empty they are read from the header record of a CSV file, or
+	// from the keys of the first object of an NDJSON file.
+	Columns []string
+	// Comma is the field delimiter of CSV files. It defaults to ','.
+	Comma rune
+	// BinaryEncoding is the encoding of the values of binary and varbinary
+	// columns. It defaults to BinaryHex.
+	BinaryEncoding BinaryEncoding
+	// MaxErrors is the number of rejected rows after which the load is
+	// aborted. Zero aborts the load on the first rejected row and a negative
+	// value never aborts it.
+	MaxErrors int
+}
+
+// BulkLoadError is a row rejected by BulkLoadCSV or BulkLoadNDJSON.
+type BulkLoadError struct {
+	// Line is the line of the row in the input, starting at 1.
+	Line int
+	// Column is the destination column of the rejected value, or empty when
+	// the whole row is rejected.
+	Column string
+	Err    error
+}
+
+func (e *BulkLoadError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("mssql: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("mssql: line %d: column %s: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *BulkLoadError) Unwrap() error {
+	return e.Err
+}
+
+// BulkLoadResult is the outcome of BulkLoadCSV and BulkLoadNDJSON.
+type BulkLoadResult struct {
+	// RowsCopied is the number of rows inserted in the destination table.
+	RowsCopied int64
+	// Rejected holds the rows that could not be converted to the types of
+	// the destination columns.
+	Rejected []*BulkLoadError
+}
+
+// bulkLoader converts the text records of a file and sends them with a Bulk.
+type bulkLoader struct {
+	bulk   *Bulk
+	opts   BulkLoadOptions
+	loc    *time.Location
+	result BulkLoadResult
+}
+
+func (c *Conn) newBulkLoader(ctx context.Context, table string, columns []string, opts BulkLoadOptions) (*bulkLoader, error) {
+	b := c.CreateBulkContext(ctx, table, columns)
+	b.Options = opts.BulkOptions
+	if err := b.sendBulkCommand(ctx); err != nil {
+		return nil, err
+	}
+	return &bulkLoader{bulk: b, opts: opts, loc: getTimezone(c)}, nil
+}
+
+// reject records a rejected row and reports whether the load must be
+// aborted.
+func (l *bulkLoader) reject(err *BulkLoadError) bool {
+	l.result.Rejected = append(l.result.Rejected, err)
+	return l.opts.MaxErrors >= 0 && len(l.result.Rejected) > l.opts.MaxErrors
+}
+
+// addRow converts the fields of a record and sends them, returning the
+// rejection of the row when a value cannot be converted.
+func (l *bulkLoader) addRow(line int, fields []*string) (*BulkLoadError, error) {
+	row := make([]interface{}, len(fields))
+	for i, f := range fields {
+		if f == nil {
+			continue
+		}
+		v, err := bulkTextValue(*f, &l.bulk.bulkColumns[i], l.opts.BinaryEncoding, l.loc)
+		if err != nil {
+			return &BulkLoadError{Line: line, Column: l.bulk.bulkColumns[i].ColName, Err: err}, nil
+		}
+		row[i] = v
+	}
+	data, err := l.bulk.makeRowData(row)
+	if err != nil {
+		return &BulkLoadError{Line: line, Err: err}, nil
+	}
+	return nil, l.bulk.writeRow(l.bulk.ctx, data)
+}
+
+// done ends the bulk copy. The rows sent before an error are kept.
+func (l *bulkLoader) done(err error) (BulkLoadResult, error) {
+	rows, doneErr := l.bulk.Done()
+	l.result.RowsCopied = rows
+	if err == nil {
+		err = doneErr
+	}
+	return l.result, err
+}
+
+// BulkLoadCSV copies the records of a CSV file to table. The values are
+// converted from text using the types of the destination columns, and empty
+// fields are loaded as NULL. Rows that cannot be converted are reported in
+// the Rejected field of the result; when there are more of them than
+// opts.MaxErrors the load stops and the last one is returned as a
+// *BulkLoadError. Rows copied before an error are not removed unless the
+// load runs in a transaction that is rolled back.
+func (c *Conn) BulkLoadCSV(ctx context.Context, table string, r io.Reader, opts BulkLoadOptions) (BulkLoadResult, error) {
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.ReuseRecord = true
+
+	columns := opts.Columns
+	if len(columns) == 0 {
+		header, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("mssql: the CSV file has no header")
+			}
+			return BulkLoadResult{}, err
+		}
+		columns = make([]string, len(header))
+		for i, name := range header {
+			columns[i] = strings.TrimSpace(name)
+		}
+		columns[0] = strings.TrimPrefix(columns[0], "\ufeff")
+	}
+	cr.FieldsPerRecord = len(columns)
+
+	l, err := c.newBulkLoader(ctx, table, columns, opts)
+	if err != nil {
+		return BulkLoadResult{}, err
+	}
+	fields := make([]*string, len(columns))
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return l.done(nil)
+		}
+		var rejected *BulkLoadError
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return l.done(err)
+			}
+			rejected = &BulkLoadError{Line: perr.StartLine, Err: perr.Err}
+		} else {
+			line, _ := cr.FieldPos(0)
+			for i := range record {
+				fields[i] = nil
+				if record[i] != "" {
+					fields[i] = &record[i]
+				}
+			}
+			if rejected, err = l.addRow(line, fields); err != nil {
+				return l.done(err)
+			}
+		}
+		if rejected != nil && l.reject(rejected) {
+			return l.done(rejected)
+		}
+	}
+}
+
+// BulkLoadNDJSON copies the objects of a newline delimited JSON file to
+// table, one object per line. Object keys name the destination columns;
+// missing keys and null values are loaded as NULL. Strings are converted as
+// the fields of BulkLoadCSV, and other values are converted from their JSON
+// text. Blank lines are skipped. Rejected rows are handled as with
+// BulkLoadCSV.
+func (c *Conn) BulkLoadNDJSON(ctx context.Context, table string, r io.Reader, opts BulkLoadOptions) (BulkLoadResult, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+
+	// Read up to the first object to find the columns.
+	var line int
+	var first []byte
+	for first == nil && sc.Scan() {
+		line++
+		if b := bytes.TrimSpace(sc.Bytes()); len(b) > 0 {
+			first = append([]byte(nil), b...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return BulkLoadResult{}, err
+	}
+	if first == nil && len(opts.Columns) == 0 {
+		return BulkLoadResult{}, errors.New("mssql: the NDJSON file has no objects")
+	}
+	columns := opts.Columns
+	if len(columns) == 0 {
+		var err error
+		if columns, err = jsonObjectKeys(first); err != nil {
+			return BulkLoadResult{}, &BulkLoadError{Line: line, Err: err}
+		}
+	}
+	index := make(map[string]int, len(columns))
+	for i, name := range columns {
+		index[name] = i
+	}
+
+	l, err := c.newBulkLoader(ctx, table, columns, opts)
+	if err != nil {
+		return BulkLoadResult{}, err
+	}
+	fields := make([]*string, len(columns))
+	data := first
+	for data != nil {
+		rejected, err := l.addObject(line, data, index, fields)
+		if err != nil {
+			return l.done(err)
+		}
+		if rejected != nil && l.reject(rejected) {
+			return l.done(rejected)
+		}
+
+		data = nil
+		for data == nil && sc.Scan() {
+			line++
+			if b := bytes.TrimSpace(sc.Bytes()); len(b) > 0 {
+				data = b
+			}
+		}
+	}
+	return l.done(sc.Err())
+}
+
+func (l *bulkLoader) addObject(line int, data []byte, index map[string]int, fields []*string) (*BulkLoadError, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return &BulkLoadError{Line: line, Err: err}, nil
+	}
+	for i := range fields {
+		fields[i] = nil
+	}
+	for key, raw := range obj {
+		i, ok := index[key]
+		if !ok {
+			return &BulkLoadError{Line: line, Err: fmt.Errorf("unknown column %s", key)}, nil
+		}
+		text := string(raw)
+		if text == "null" {
+			continue
+		}
+		if raw[0] == '"' {
+			if err := json.Unmarshal(raw, &text); err != nil {
+				return &BulkLoadError{Line: line, Column: key, Err: err}, nil
+			}
+		}
+		fields[i] = &text
+	}
+	return l.addRow(line, fields)
+}
+
+// jsonObjectKeys returns the keys of a JSON object in the order they appear.
+func jsonObjectKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the first object has no keys")
+	}
+	return keys, nil
+}
+
+// Layouts of the date and time values loaded from text. Values without a
+// time zone are in the session time zone.
+var bulkTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	sqlDateFormat,
+}
+
+func parseBulkTime(s string, loc *time.Location) (t time.Time, err error) {
+	for _, layout := range bulkTimeLayouts {
+		if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("invalid date %q", s)
+}
+
+// bulkTextValue converts text to a value Bulk.makeParam accepts for col.
+func bulkTextValue(s string, col *columnStruct, enc BinaryEncoding, loc *time.Location) (interface{}, error) {
+	switch col.ti.TypeId {
+	case typeInt1:
+		return parseBulkInt(s, 8, true)
+	case typeInt2, typeInt4, typeInt8:
+		return parseBulkInt(s, col.ti.Size*8, false)
+	case typeIntN:
+		return parseBulkInt(s, col.ti.Size*8, col.ti.Size == 1)
+	case typeFlt4, typeFlt8, typeFltN:
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %v", s, err.(*strconv.NumError).Err)
+		}
+		return v, nil
+	case typeBit, typeBitN:
+		v, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bit %q", s)
+		}
+		return v, nil
+	case typeDateTime2N, typeDateTimeOffsetN, typeDateN, typeDateTime, typeDateTimeN, typeDateTim4:
+		return parseBulkTime(strings.TrimSpace(s), loc)
+	case typeMoney, typeMoney4, typeMoneyN, typeDecimal, typeDecimalN, typeNumeric, typeNumericN, typeTimeN:
+		// Bulk.makeParam parses these strings.
+		return strings.TrimSpace(s), nil
+	case typeGuid:
+		var u UniqueIdentifier
+		if err := u.Scan(strings.Trim(strings.TrimSpace(s), "{}")); err != nil {
+			return nil, fmt.Errorf("invalid uniqueidentifier %q", s)
+		}
+		return u.Value()
+	case typeBigVarBin, typeBigBinary:
+		return decodeBulkBinary(s, enc)
+	}
+	return s, nil
+}
+
+func parseBulkInt(s string, bits int, unsigned bool) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	if unsigned {
+		v, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q: %v", s, err.(*strconv.NumError).Err)
+		}
+		return int64(v), nil
+	}
+	v, err := strconv.ParseInt(s, 10, bits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer %q: %v", s, err.(*strconv.NumError).Err)
+	}
+	return v, nil
+}
+
+func decodeBulkBinary(s string, enc BinaryEncoding) ([]byte, error) {
+	switch enc {
+	case BinaryBase64:
+		return base64.StdEncoding.DecodeString(s)
+	case BinaryHex:
+		if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+			s = s[2:]
+		}
+		return hex.DecodeString(s)
+	}
+	return nil, fmt.Errorf("mssql: unknown binary encoding %d", enc)
+}
@@ -0,0 +1,148 @@
+package mssql
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkTextValue(t *testing.T) {
+	loc := time.FixedZone("test", 3600)
+	for _, test := range []struct {
+		s    string
+		ti   typeInfo
+		enc  BinaryEncoding
+		want interface{}
+	}{
+		{"255", typeInfo{TypeId: typeIntN, Size: 1}, BinaryHex, int64(255)},
+		{" -32768 ", typeInfo{TypeId: typeInt2, Size: 2}, BinaryHex, int64(-32768)},
+		{"9223372036854775807", typeInfo{TypeId: typeIntN, Size: 8}, BinaryHex, int64(9223372036854775807)},
+		{"1.5e3", typeInfo{TypeId: typeFltN, Size: 8}, BinaryHex, 1500.0},
+		{"TRUE", typeInfo{TypeId: typeBitN, Size: 1}, BinaryHex, true},
+		{"0", typeInfo{TypeId: typeBitN, Size: 1}, BinaryHex, false},
+		{"12.345", typeInfo{TypeId: typeDecimalN, Prec: 10, Scale: 3}, BinaryHex, "12.345"},
+		{"2024-02-29", typeInfo{TypeId: typeDateN}, BinaryHex, time.Date(2024, 2, 29, 0, 0, 0, 0, loc)},
+		{"2024-02-29 13:14:15.5", typeInfo{TypeId: typeDateTime2N, Scale: 7}, BinaryHex, time.Date(2024, 2, 29, 13, 14, 15, 500000000, loc)},
+		{"2024-02-29T13:14:15Z", typeInfo{TypeId: typeDateTimeOffsetN, Scale: 7}, BinaryHex, time.Date(2024, 2, 29, 13, 14, 15, 0, time.UTC)},
+		{"{6F9619FF-8B86-D011-B42D-00C04FC964FF}", typeInfo{TypeId: typeGuid, Size: 16}, BinaryHex,
+			[]byte{0xFF, 0x19, 0x96, 0x6F, 0x86, 0x8B, 0x11, 0xD0, 0xB4, 0x2D, 0x00, 0xC0, 0x4F, 0xC9, 0x64, 0xFF}},
+		{"0xCAFE", typeInfo{TypeId: typeBigVarBin, Size: 10}, BinaryHex, []byte{0xca, 0xfe}},
+		{"yv4=", typeInfo{TypeId: typeBigBinary, Size: 2}, BinaryBase64, []byte{0xca, 0xfe}},
+		{" text ", typeInfo{TypeId: typeNVarChar, Size: 20}, BinaryHex, " text "},
+	} {
+		got, err := bulkTextValue(test.s, &columnStruct{ti: test.ti}, test.enc, loc)
+		require.NoError(t, err, test.s)
+		if want, ok := test.want.(time.Time); ok {
+			assert.True(t, want.Equal(got.(time.Time)), "%s: got %v", test.s, got)
+			continue
+		}
+		assert.Equal(t, test.want, got, test.s)
+	}
+
+	for _, test := range []struct {
+		s  string
+		ti typeInfo
+	}{
+		{"256", typeInfo{TypeId: typeIntN, Size: 1}},
+		{"-1", typeInfo{TypeId: typeInt1, Size: 1}},
+		{"40000", typeInfo{TypeId: typeIntN, Size: 2}},
+		{"1.5", typeInfo{TypeId: typeIntN, Size: 4}},
+		{"yes", typeInfo{TypeId: typeBitN, Size: 1}},
+		{"29/02/2024", typeInfo{TypeId: typeDateN}},
+		{"not-a-guid", typeInfo{TypeId: typeGuid, Size: 16}},
+		{"xyz", typeInfo{TypeId: typeBigVarBin, Size: 10}},
+	} {
+		_, err := bulkTextValue(test.s, &columnStruct{ti: test.ti}, BinaryHex, loc)
+		assert.Error(t, err, test.s)
+	}
+}
+
+func TestJSONObjectKeys(t *testing.T) {
+	keys, err := jsonObjectKeys([]byte(`{"b": 1, "a": {"c": [1, 2]}, "d": null}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "d"}, keys)
+
+	_, err = jsonObjectKeys([]byte(`[1]`))
+	assert.Error(t, err)
+	_, err = jsonObjectKeys([]byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestBulkLoad(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `create table #bulkload (
+		id int not null,
+		name nvarchar(20),
+		price decimal(10, 2),
+		created datetime2,
+		uid uniqueidentifier,
+		data varbinary(10))`)
+	require.NoError(t, err)
+
+	csvFile := "\ufeffid,name,price,created,uid,data\n" +
+		"1,\"Smith, J\",12.50,2024-02-29 13:14:15,6F9619FF-8B86-D011-B42D-00C04FC964FF,0xCAFE\n" +
+		"x,bad,1,,,\n" +
+		"2,,,,,\n" +
+		"3,short\n"
+	ndjson := `{"id": 4, "name": "d", "price": 1.25, "data": "CAFE"}` + "\n\n" +
+		`{"id": 5, "price": "abc"}` + "\n" +
+		`{"id": 6, "unknown": 1}` + "\n"
+
+	err = conn.Raw(func(driverConn any) error {
+		c := driverConn.(*Conn)
+		res, err := c.BulkLoadCSV(ctx, "#bulkload", strings.NewReader(csvFile), BulkLoadOptions{MaxErrors: -1})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), res.RowsCopied)
+		require.Len(t, res.Rejected, 2)
+		assert.Equal(t, 3, res.Rejected[0].Line)
+		assert.Equal(t, "id", res.Rejected[0].Column)
+		assert.Equal(t, 5, res.Rejected[1].Line)
+
+		res, err = c.BulkLoadNDJSON(ctx, "#bulkload", strings.NewReader(ndjson), BulkLoadOptions{MaxErrors: 1})
+		var loadErr *BulkLoadError
+		require.True(t, errors.As(err, &loadErr), "the second rejected row aborts the load")
+		assert.Equal(t, 4, loadErr.Line)
+		assert.Equal(t, int64(1), res.RowsCopied)
+		assert.Equal(t, 3, res.Rejected[0].Line)
+		return nil
+	})
+	require.NoError(t, err)
+
+	rows, err := conn.QueryContext(ctx, "select id, name, price, created, uid, data from #bulkload order by id")
+	require.NoError(t, err)
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id int
+		var name, price sql.NullString
+		var created sql.NullTime
+		var uid NullUniqueIdentifier
+		var data []byte
+		require.NoError(t, rows.Scan(&id, &name, &price, &created, &uid, &data))
+		got = append(got, strconv.Itoa(id)+"|"+name.String+"|"+price.String+"|"+created.Time.Format(sqlDateTimeFormat)+"|"+uid.UUID.String()+"|"+string(data))
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{
+		"1|Smith, J|12.50|2024-02-29 13:14:15Z|6F9619FF-8B86-D011-B42D-00C04FC964FF|\xca\xfe",
+		"2|||0001-01-01 00:00:00Z|00000000-0000-0000-0000-000000000000|",
+		"4|d|1.25|0001-01-01 00:00:00Z|00000000-0000-0000-0000-000000000000|\xca\xfe",
+	}, got)
+}
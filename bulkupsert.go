@@ -0,0 +1,199 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+)
+
+// bulkUpsertTable is the session temp table rows are copied to before they
+// are merged into the target table.
+const bulkUpsertTable = "#mssql_bulkupsert"
+
+// BulkUpsertOptions configures BulkUpsert.
+type BulkUpsertOptions struct {
+	// BulkOptions are the options of the copy to the temp table, except
+	// KeepIdentity which turns IDENTITY_INSERT on for the target table while
+	// the rows are inserted into it.
+	BulkOptions
+	// DeleteMissing deletes the rows of the target table whose key is not
+	// among the upserted rows.
+	DeleteMissing bool
+	// NoMerge runs an UPDATE, an INSERT and, with DeleteMissing, a DELETE in
+	// a transaction instead of a MERGE.
+	NoMerge bool
+}
+
+// BulkUpsertResult is the outcome of BulkUpsert.
+type BulkUpsertResult struct {
+	// RowsCopied is the number of rows copied to the temp table.
+	RowsCopied int64
+	Inserted   int64
+	Updated    int64
+	Deleted    int64
+}
+
+// BulkUpsert inserts or updates rows of table by key. The rows, holding the
+// values of columns, are bulk copied to a session temp table created from
+// the columns of table, and then merged into table: rows whose keyColumns
+// match a row of table update its other columns, and other rows are
+// inserted. The counts of the result are those of the OUTPUT clause.
+//
+// The key columns must be among columns, and a key must not appear in
+// several rows. NULL keys never match. With opts.DeleteMissing and no rows,
+// every row of table is deleted. When the copy or the merge fails the table
+// is left unchanged.
+func (c *Conn) BulkUpsert(ctx context.Context, table string, keyColumns, columns []string, rows iter.Seq[[]interface{}], opts BulkUpsertOptions) (result BulkUpsertResult, err error) {
+	merge, err := bulkUpsertQuery(table, bulkUpsertTable, keyColumns, columns, opts)
+	if err != nil {
+		return result, err
+	}
+	q := TSQLQuoter{}
+	selected := make([]string, len(columns))
+	for i, col := range columns {
+		selected[i] = "s." + q.ID(col)
+	}
+	// The join keeps an identity column of table from being an identity
+	// column of the temp table.
+	err = c.execBatch(ctx, fmt.Sprintf(`IF OBJECT_ID('tempdb..%s') IS NOT NULL DROP TABLE %s;
+SELECT TOP (0) %s INTO %s FROM %s AS s LEFT JOIN (SELECT 1 AS x) AS j ON 1 = 0;`,
+		bulkUpsertTable, bulkUpsertTable, strings.Join(selected, ", "), bulkUpsertTable, table))
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		dropErr := c.execBatch(context.WithoutCancel(ctx), fmt.Sprintf("DROP TABLE %s", bulkUpsertTable))
+		if err == nil {
+			err = dropErr
+		}
+	}()
+
+	b := c.CreateBulkContext(ctx, bulkUpsertTable, columns)
+	b.Options = opts.BulkOptions
+	b.Options.KeepIdentity = false
+	for row := range rows {
+		if err = b.AddRowContext(ctx, row); err != nil {
+			break
+		}
+	}
+	rowCount, doneErr := b.DoneContext(ctx)
+	if err == nil {
+		err = doneErr
+	}
+	result.RowsCopied = rowCount
+	if err != nil {
+		return result, err
+	}
+
+	if opts.KeepIdentity {
+		if err = c.execBatch(ctx, fmt.Sprintf("SET IDENTITY_INSERT %s ON", table)); err != nil {
+			return result, err
+		}
+		defer func() {
+			resetErr := c.execBatch(context.WithoutCancel(ctx), fmt.Sprintf("SET IDENTITY_INSERT %s OFF", table))
+			if err == nil {
+				err = resetErr
+			}
+		}()
+	}
+	stmt, err := c.prepareContext(ctx, merge)
+	if err != nil {
+		return result, err
+	}
+	res, err := stmt.QueryContext(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer res.Close()
+	counts := make([]driver.Value, 3)
+	if err = res.Next(counts); err != nil {
+		if err == io.EOF {
+			err = errors.New("mssql: BulkUpsert returned no counts")
+		}
+		return result, err
+	}
+	result.Inserted, _ = counts[0].(int64)
+	result.Updated, _ = counts[1].(int64)
+	result.Deleted, _ = counts[2].(int64)
+	return result, nil
+}
+
+// bulkUpsertQuery returns the batch merging the rows of source into table
+// and selecting the inserted, updated and deleted counts.
+func bulkUpsertQuery(table, source string, keyColumns, columns []string, opts BulkUpsertOptions) (string, error) {
+	if len(keyColumns) == 0 {
+		return "", errors.New("mssql: BulkUpsert needs key columns")
+	}
+	q := TSQLQuoter{}
+	isKey := make(map[string]bool, len(keyColumns))
+	on := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		found := false
+		for _, col := range columns {
+			found = found || col == key
+		}
+		if !found {
+			return "", fmt.Errorf("mssql: key column %s is not one of the upserted columns", key)
+		}
+		isKey[key] = true
+		on[i] = fmt.Sprintf("t.%s = s.%s", q.ID(key), q.ID(key))
+	}
+	names := make([]string, len(columns))
+	values := make([]string, len(columns))
+	var set []string
+	for i, col := range columns {
+		names[i] = q.ID(col)
+		values[i] = "s." + q.ID(col)
+		if !isKey[col] {
+			set = append(set, fmt.Sprintf("%s = s.%s", q.ID(col), q.ID(col)))
+		}
+	}
+	match := strings.Join(on, " AND ")
+
+	var w strings.Builder
+	w.WriteString("DECLARE @actions TABLE (action nvarchar(10));\n")
+	if opts.NoMerge {
+		w.WriteString("SET XACT_ABORT ON;\nBEGIN TRANSACTION;\n")
+		if opts.DeleteMissing {
+			fmt.Fprintf(&w, "DELETE t OUTPUT N'DELETE' INTO @actions FROM %s AS t WHERE NOT EXISTS (SELECT 1 FROM %s AS s WHERE %s);\n",
+				table, source, match)
+		}
+		if len(set) > 0 {
+			fmt.Fprintf(&w, "UPDATE t SET %s OUTPUT N'UPDATE' INTO @actions FROM %s AS t INNER JOIN %s AS s ON %s;\n",
+				strings.Join(set, ", "), table, source, match)
+		}
+		fmt.Fprintf(&w, "INSERT INTO %s (%s) OUTPUT N'INSERT' INTO @actions SELECT %s FROM %s AS s WHERE NOT EXISTS (SELECT 1 FROM %s AS t WHERE %s);\n",
+			table, strings.Join(names, ", "), strings.Join(values, ", "), source, table, match)
+		w.WriteString("COMMIT TRANSACTION;\n")
+	} else {
+		fmt.Fprintf(&w, "MERGE INTO %s WITH (HOLDLOCK) AS t USING %s AS s ON %s\n", table, source, match)
+		if len(set) > 0 {
+			fmt.Fprintf(&w, "WHEN MATCHED THEN UPDATE SET %s\n", strings.Join(set, ", "))
+		}
+		fmt.Fprintf(&w, "WHEN NOT MATCHED BY TARGET THEN INSERT (%s) VALUES (%s)\n", strings.Join(names, ", "), strings.Join(values, ", "))
+		if opts.DeleteMissing {
+			w.WriteString("WHEN NOT MATCHED BY SOURCE THEN DELETE\n")
+		}
+		w.WriteString("OUTPUT $action INTO @actions;\n")
+	}
+	w.WriteString(`SELECT
+	COUNT(CASE WHEN action = N'INSERT' THEN 1 END),
+	COUNT(CASE WHEN action = N'UPDATE' THEN 1 END),
+	COUNT(CASE WHEN action = N'DELETE' THEN 1 END)
+FROM @actions;`)
+	return w.String(), nil
+}
+
+// execBatch runs a batch without arguments on the connection.
+func (c *Conn) execBatch(ctx context.Context, query string) error {
+	stmt, err := c.prepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, nil)
+	return err
+}
@@ -0,0 +1,94 @@
+package mssql
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkUpsertQuery(t *testing.T) {
+	query, err := bulkUpsertQuery("dbo.target", "#src", []string{"id"}, []string{"id", "na]me"}, BulkUpsertOptions{DeleteMissing: true})
+	require.NoError(t, err)
+	assert.Equal(t, `DECLARE @actions TABLE (action nvarchar(10));
+MERGE INTO dbo.target WITH (HOLDLOCK) AS t USING #src AS s ON t.[id] = s.[id]
+WHEN MATCHED THEN UPDATE SET [na]]me] = s.[na]]me]
+WHEN NOT MATCHED BY TARGET THEN INSERT ([id], [na]]me]) VALUES (s.[id], s.[na]]me])
+WHEN NOT MATCHED BY SOURCE THEN DELETE
+OUTPUT $action INTO @actions;
+SELECT
+	COUNT(CASE WHEN action = N'INSERT' THEN 1 END),
+	COUNT(CASE WHEN action = N'UPDATE' THEN 1 END),
+	COUNT(CASE WHEN action = N'DELETE' THEN 1 END)
+FROM @actions;`, query)
+
+	query, err = bulkUpsertQuery("dbo.target", "#src", []string{"a", "b"}, []string{"a", "b"}, BulkUpsertOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, query, "WHEN MATCHED", "rows of key columns only are not updated")
+	assert.Contains(t, query, "ON t.[a] = s.[a] AND t.[b] = s.[b]\n")
+	assert.NotContains(t, query, "DELETE\n")
+
+	query, err = bulkUpsertQuery("dbo.target", "#src", []string{"id"}, []string{"id", "name"}, BulkUpsertOptions{NoMerge: true, DeleteMissing: true})
+	require.NoError(t, err)
+	assert.NotContains(t, query, "MERGE")
+	assert.Contains(t, query, `SET XACT_ABORT ON;
+BEGIN TRANSACTION;
+DELETE t OUTPUT N'DELETE' INTO @actions FROM dbo.target AS t WHERE NOT EXISTS (SELECT 1 FROM #src AS s WHERE t.[id] = s.[id]);
+UPDATE t SET [name] = s.[name] OUTPUT N'UPDATE' INTO @actions FROM dbo.target AS t INNER JOIN #src AS s ON t.[id] = s.[id];
+INSERT INTO dbo.target ([id], [name]) OUTPUT N'INSERT' INTO @actions SELECT s.[id], s.[name] FROM #src AS s WHERE NOT EXISTS (SELECT 1 FROM dbo.target AS t WHERE t.[id] = s.[id]);
+COMMIT TRANSACTION;
+`)
+
+	_, err = bulkUpsertQuery("dbo.target", "#src", nil, []string{"id"}, BulkUpsertOptions{})
+	assert.EqualError(t, err, "mssql: BulkUpsert needs key columns")
+	_, err = bulkUpsertQuery("dbo.target", "#src", []string{"key"}, []string{"id"}, BulkUpsertOptions{})
+	assert.EqualError(t, err, "mssql: key column key is not one of the upserted columns")
+}
+
+func TestBulkUpsert(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, noMerge := range []bool{false, true} {
+		_, err = conn.ExecContext(ctx, `if object_id('tempdb..#upsert') is not null drop table #upsert;
+create table #upsert (id int identity primary key, code int not null unique, name nvarchar(20));
+insert into #upsert (code, name) values (1, 'one'), (2, 'two'), (3, 'three');`)
+		require.NoError(t, err)
+
+		rows := [][]interface{}{{2, "deux"}, {3, "three"}, {4, "four"}}
+		var result BulkUpsertResult
+		err = conn.Raw(func(driverConn any) error {
+			var err error
+			result, err = driverConn.(*Conn).BulkUpsert(ctx, "#upsert", []string{"code"}, []string{"code", "name"},
+				slices.Values(rows), BulkUpsertOptions{DeleteMissing: true, NoMerge: noMerge})
+			return err
+		})
+		require.NoError(t, err, "NoMerge %v", noMerge)
+		assert.Equal(t, BulkUpsertResult{RowsCopied: 3, Inserted: 1, Updated: 2, Deleted: 1}, result, "NoMerge %v", noMerge)
+
+		var names []string
+		res, err := conn.QueryContext(ctx, "select name from #upsert order by code")
+		require.NoError(t, err)
+		for res.Next() {
+			var name string
+			require.NoError(t, res.Scan(&name))
+			names = append(names, name)
+		}
+		require.NoError(t, res.Err())
+		res.Close()
+		assert.Equal(t, []string{"deux", "three", "four"}, names, "NoMerge %v", noMerge)
+	}
+}
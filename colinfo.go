@@ -0,0 +1,254 @@
+package mssql
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// COLINFO status flags
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tds/aa8466c5-ca3d-48ca-a638-7c1becebe754
+const (
+	colInfoExpression    = 0x04
+	colInfoKey           = 0x08
+	colInfoHidden        = 0x10
+	colInfoDifferentName = 0x20
+)
+
+// colInfo describes a column of a FOR BROWSE query.
+type colInfo struct {
+	ColNum   uint8
+	TableNum uint8
+	Status   uint8
+	ColName  string
+}
+
+// parseTabName reads the names of the tables a FOR BROWSE query reads from,
+// with their parts joined by dots.
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tds/140e3348-da08-409a-b6c3-f0fc9cee2d6e
+func parseTabName(r *tdsBuffer) (tables []string) {
+	buf := make([]byte, r.uint16())
+	r.ReadFull(buf)
+	br := bytes.NewReader(buf)
+	for br.Len() > 0 {
+		numParts, err := readByte(br)
+		if err != nil {
+			badStreamPanic(err)
+		}
+		parts := make([]string, numParts)
+		for i := range parts {
+			parts[i] = readUsVarCharOrPanic(br)
+		}
+		tables = append(tables, strings.Join(parts, "."))
+	}
+	return tables
+}
+
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tds/aa8466c5-ca3d-48ca-a638-7c1becebe754
+func parseColInfo(r *tdsBuffer) (cols []colInfo) {
+	buf := make([]byte, r.uint16())
+	r.ReadFull(buf)
+	br := bytes.NewReader(buf)
+	for br.Len() > 0 {
+		var hdr [3]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			badStreamPanic(err)
+		}
+		col := colInfo{ColNum: hdr[0], TableNum: hdr[1], Status: hdr[2]}
+		if col.Status&colInfoDifferentName != 0 {
+			col.ColName = readBVarCharOrPanic(br)
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// applyColInfo adds the base table and column of the browse information to
+// the columns they describe.
+func applyColInfo(columns []columnStruct, tables []string, infos []colInfo) {
+	for _, info := range infos {
+		i := int(info.ColNum) - 1
+		if i < 0 || i >= len(columns) {
+			continue
+		}
+		column := &columns[i]
+		column.browseStatus = info.Status
+		if info.TableNum == 0 || int(info.TableNum) > len(tables) {
+			continue
+		}
+		column.baseTable = tables[info.TableNum-1]
+		column.baseColumn = column.ColName
+		if info.Status&colInfoDifferentName != 0 {
+			column.baseColumn = info.ColName
+		}
+	}
+}
+
+// Collation is the collation of a character column.
+type Collation struct {
+	// LCID is the Windows locale of the collation.
+	LCID uint32
+	// Flags holds the comparison options: 0x01 ignores case, 0x02 accents,
+	// 0x04 kana type and 0x08 width, 0x10 and 0x20 select binary and
+	// binary code point sorting.
+	Flags uint8
+	// Version of the collation.
+	Version uint8
+	// SortID is the sort order of SQL Server collations, zero for Windows
+	// collations.
+	SortID uint8
+}
+
+func (c *columnStruct) collation() (Collation, bool) {
+	ti := c.originalTypeInfo()
+	switch ti.TypeId {
+	case typeChar, typeVarChar, typeBigChar, typeBigVarChar, typeNChar, typeNVarChar, typeText, typeNText:
+	default:
+		return Collation{}, false
+	}
+	return Collation{
+		LCID:    ti.Collation.LcidAndFlags & 0x000fffff,
+		Flags:   uint8(ti.Collation.LcidAndFlags >> 20),
+		Version: uint8(ti.Collation.LcidAndFlags >> 28),
+		SortID:  ti.Collation.SortId,
+	}, true
+}
+
+func (c *columnStruct) udtName() (string, bool) {
+	ti := c.originalTypeInfo()
+	if ti.TypeId != typeUdt {
+		return "", false
+	}
+	return joinNameParts(ti.UdtInfo.DBName, ti.UdtInfo.SchemaName, ti.UdtInfo.TypeName), true
+}
+
+func (c *columnStruct) xmlSchema() (string, bool) {
+	ti := c.originalTypeInfo()
+	if ti.TypeId != typeXml || ti.XmlInfo.SchemaPresent == 0 {
+		return "", false
+	}
+	return joinNameParts(ti.XmlInfo.DBName, ti.XmlInfo.OwningSchema, ti.XmlInfo.XmlSchemaCollection), true
+}
+
+// joinNameParts joins the non-empty parts of a multi-part name.
+func joinNameParts(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, ".")
+}
+
+func (c *columnStruct) updatable() (updatable, ok bool) {
+	switch c.Flags & colFlagUpdateable {
+	case colFlagReadOnly:
+		return false, true
+	case colFlagReadWrite:
+		return true, true
+	}
+	return false, false
+}
+
+// ColumnTypeIdentity reports whether the column is an identity column.
+func (r *Rows) ColumnTypeIdentity(index int) bool {
+	return r.cols[index].Flags&colFlagIdentity != 0
+}
+
+// ColumnTypeComputed reports whether the column is a computed column.
+func (r *Rows) ColumnTypeComputed(index int) bool {
+	return r.cols[index].Flags&colFlagComputed != 0
+}
+
+// ColumnTypeUpdatable reports whether the column can be updated. If it is
+// unknown, ok is false.
+func (r *Rows) ColumnTypeUpdatable(index int) (updatable, ok bool) {
+	return r.cols[index].updatable()
+}
+
+// ColumnTypeHidden reports whether the column was added by the server to
+// identify the rows of a FOR BROWSE query rather than selected.
+func (r *Rows) ColumnTypeHidden(index int) bool {
+	return r.cols[index].Flags&colFlagHidden != 0 || r.cols[index].browseStatus&colInfoHidden != 0
+}
+
+// ColumnTypeCollation returns the collation of a character column.
+func (r *Rows) ColumnTypeCollation(index int) (Collation, bool) {
+	return r.cols[index].collation()
+}
+
+// ColumnTypeUDTName returns the name of the type of a CLR user-defined type
+// column, such as "sys.geography".
+func (r *Rows) ColumnTypeUDTName(index int) (string, bool) {
+	return r.cols[index].udtName()
+}
+
+// ColumnTypeXMLSchema returns the name of the schema collection of a typed
+// xml column.
+func (r *Rows) ColumnTypeXMLSchema(index int) (string, bool) {
+	return r.cols[index].xmlSchema()
+}
+
+// ColumnTypeBaseTable returns the table a column is read from. It is only
+// known for queries using FOR BROWSE.
+func (r *Rows) ColumnTypeBaseTable(index int) (string, bool) {
+	return r.cols[index].baseTable, r.cols[index].baseTable != ""
+}
+
+// ColumnTypeBaseColumn returns the name of the table column a column is read
+// from. It is only known for queries using FOR BROWSE.
+func (r *Rows) ColumnTypeBaseColumn(index int) (string, bool) {
+	return r.cols[index].baseColumn, r.cols[index].baseTable != ""
+}
+
+// ColumnTypeIdentity reports whether the column is an identity column.
+func (r *Rowsq) ColumnTypeIdentity(index int) bool {
+	return r.cols[index].Flags&colFlagIdentity != 0
+}
+
+// ColumnTypeComputed reports whether the column is a computed column.
+func (r *Rowsq) ColumnTypeComputed(index int) bool {
+	return r.cols[index].Flags&colFlagComputed != 0
+}
+
+// ColumnTypeUpdatable reports whether the column can be updated. If it is
+// unknown, ok is false.
+func (r *Rowsq) ColumnTypeUpdatable(index int) (updatable, ok bool) {
+	return r.cols[index].updatable()
+}
+
+// ColumnTypeHidden reports whether the column was added by the server to
+// identify the rows of a FOR BROWSE query rather than selected.
+func (r *Rowsq) ColumnTypeHidden(index int) bool {
+	return r.cols[index].Flags&colFlagHidden != 0 || r.cols[index].browseStatus&colInfoHidden != 0
+}
+
+// ColumnTypeCollation returns the collation of a character column.
+func (r *Rowsq) ColumnTypeCollation(index int) (Collation, bool) {
+	return r.cols[index].collation()
+}
+
+// ColumnTypeUDTName returns the name of the type of a CLR user-defined type
+// column, such as "sys.geography".
+func (r *Rowsq) ColumnTypeUDTName(index int) (string, bool) {
+	return r.cols[index].udtName()
+}
+
+// ColumnTypeXMLSchema returns the name of the schema collection of a typed
+// xml column.
+func (r *Rowsq) ColumnTypeXMLSchema(index int) (string, bool) {
+	return r.cols[index].xmlSchema()
+}
+
+// ColumnTypeBaseTable returns the table a column is read from. It is only
+// known for queries using FOR BROWSE.
+func (r *Rowsq) ColumnTypeBaseTable(index int) (string, bool) {
+	return r.cols[index].baseTable, r.cols[index].baseTable != ""
+}
+
+// ColumnTypeBaseColumn returns the name of the table column a column is read
+// from. It is only known for queries using FOR BROWSE.
+func (r *Rowsq) ColumnTypeBaseColumn(index int) (string, bool) {
+	return r.cols[index].baseColumn, r.cols[index].baseTable != ""
+}
@@ -0,0 +1,157 @@
+package mssql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/internal/cp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTokenBuffer(payload []byte) *tdsBuffer {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(len(payload)))
+	b = append(b, payload...)
+	return &tdsBuffer{packetSize: len(b), rbuf: b, rsize: len(b)}
+}
+
+func TestParseBrowseInfo(t *testing.T) {
+	var tabName []byte
+	tabName = append(tabName, 2)
+	tabName = append(tabName, 3, 0, 'd', 0, 'b', 0, 'o', 0)
+	tabName = append(tabName, 1, 0, 't', 0)
+	tabName = append(tabName, 1)
+	tabName = append(tabName, 1, 0, 'u', 0)
+	tables := parseTabName(makeTokenBuffer(tabName))
+	assert.Equal(t, []string{"dbo.t", "u"}, tables)
+
+	colInfoToken := []byte{
+		1, 1, 0,
+		2, 2, colInfoDifferentName, 4, 'r', 0, 'e', 0, 'a', 0, 'l', 0,
+		3, 0, colInfoExpression,
+		4, 1, colInfoKey | colInfoHidden,
+	}
+	infos := parseColInfo(makeTokenBuffer(colInfoToken))
+	require.Len(t, infos, 4)
+	assert.Equal(t, colInfo{ColNum: 2, TableNum: 2, Status: colInfoDifferentName, ColName: "real"}, infos[1])
+
+	columns := []columnStruct{{ColName: "id"}, {ColName: "alias"}, {ColName: "expr"}, {ColName: "key", Flags: colFlagHidden}}
+	applyColInfo(columns, tables, infos)
+	rows := &Rows{cols: columns}
+	for i, want := range []struct {
+		table, column string
+		ok, hidden    bool
+	}{
+		{"dbo.t", "id", true, false},
+		{"u", "real", true, false},
+		{"", "", false, false},
+		{"dbo.t", "key", true, true},
+	} {
+		table, ok := rows.ColumnTypeBaseTable(i)
+		column, _ := rows.ColumnTypeBaseColumn(i)
+		assert.Equal(t, want.table, table, i)
+		assert.Equal(t, want.column, column, i)
+		assert.Equal(t, want.ok, ok, i)
+		assert.Equal(t, want.hidden, rows.ColumnTypeHidden(i), i)
+	}
+}
+
+func TestColumnTypeFlags(t *testing.T) {
+	rows := &Rows{cols: []columnStruct{
+		{Flags: colFlagIdentity, ti: typeInfo{TypeId: typeIntN, Size: 4}},
+		{Flags: colFlagComputed | colFlagReadWrite | colFlagNullable, ti: typeInfo{TypeId: typeBigVarChar, Size: 10,
+			Collation: cp.Collation{LcidAndFlags: 0x00d00409, SortId: 52}}},
+		{Flags: 0x0008, ti: typeInfo{TypeId: typeUdt, UdtInfo: udtInfo{SchemaName: "sys", TypeName: "geography"}}},
+		{ti: typeInfo{TypeId: typeXml, XmlInfo: xmlInfo{SchemaPresent: 1, DBName: "db", OwningSchema: "dbo", XmlSchemaCollection: "orders"}}},
+	}}
+
+	assert.True(t, rows.ColumnTypeIdentity(0))
+	assert.False(t, rows.ColumnTypeComputed(0))
+	assert.True(t, rows.ColumnTypeComputed(1))
+
+	updatable, ok := rows.ColumnTypeUpdatable(0)
+	assert.False(t, updatable)
+	assert.True(t, ok)
+	updatable, ok = rows.ColumnTypeUpdatable(1)
+	assert.True(t, updatable)
+	assert.True(t, ok)
+	_, ok = rows.ColumnTypeUpdatable(2)
+	assert.False(t, ok, "updatability is unknown")
+
+	_, ok = rows.ColumnTypeCollation(0)
+	assert.False(t, ok)
+	collation, ok := rows.ColumnTypeCollation(1)
+	assert.True(t, ok)
+	assert.Equal(t, Collation{LCID: 0x0409, Flags: 0x0d, SortID: 52}, collation)
+
+	name, ok := rows.ColumnTypeUDTName(2)
+	assert.True(t, ok)
+	assert.Equal(t, "sys.geography", name)
+	_, ok = rows.ColumnTypeUDTName(1)
+	assert.False(t, ok)
+
+	schema, ok := rows.ColumnTypeXMLSchema(3)
+	assert.True(t, ok)
+	assert.Equal(t, "db.dbo.orders", schema)
+}
+
+func TestBrowseQuery(t *testing.T) {
+	checkConnStr(t)
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `create table #browse (
+		id int identity primary key,
+		name nvarchar(20) collate Latin1_General_CI_AS,
+		doubled as id * 2)`)
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "insert into #browse (name) values (N'a')")
+	require.NoError(t, err)
+
+	err = conn.Raw(func(driverConn any) error {
+		stmt, err := driverConn.(*Conn).prepareContext(ctx, "select name as label, doubled, id + 1 as next from #browse for browse")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		rows, err := stmt.QueryContext(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		r := rows.(*Rows)
+
+		column, ok := r.ColumnTypeBaseColumn(0)
+		assert.True(t, ok)
+		assert.Equal(t, "name", column)
+		table, _ := r.ColumnTypeBaseTable(0)
+		assert.Contains(t, table, "#browse")
+		collation, ok := r.ColumnTypeCollation(0)
+		assert.True(t, ok)
+		assert.Equal(t, uint32(0x0409), collation.LCID)
+
+		assert.True(t, r.ColumnTypeComputed(1))
+		_, ok = r.ColumnTypeBaseTable(2)
+		assert.False(t, ok, "expressions have no base table")
+
+		cols := r.Columns()
+		require.Len(t, cols, 4, "the key column is added")
+		assert.True(t, r.ColumnTypeHidden(3))
+		assert.True(t, r.ColumnTypeIdentity(3))
+
+		values := make([]driver.Value, len(cols))
+		require.NoError(t, rows.Next(values))
+		assert.Equal(t, "a", values[0])
+		return nil
+	})
+	require.NoError(t, err)
+}
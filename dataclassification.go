@@ -0,0 +1,158 @@
+package mssql
+
+// The data classification version requested by the driver. Version 2 adds
+// sensitivity ranks.
+const dataClassificationVersion = 2
+
+// SensitivityRank is the sensitivity of classified data.
+type SensitivityRank int32
+
+const (
+	SensitivityRankNotDefined SensitivityRank = -1
+	SensitivityRankNone       SensitivityRank = 0
+	SensitivityRankLow        SensitivityRank = 10
+	SensitivityRankMedium     SensitivityRank = 20
+	SensitivityRankHigh       SensitivityRank = 30
+	SensitivityRankCritical   SensitivityRank = 40
+)
+
+// SensitivityLabel is a label of classified data, such as "Confidential".
+type SensitivityLabel struct {
+	Name string
+	ID   string
+}
+
+// InformationType is the kind of classified data, such as "Financial".
+type InformationType struct {
+	Name string
+	ID   string
+}
+
+// SensitivityProperty is a classification of a column. Label and
+// InformationType are nil when the classification does not set them.
+type SensitivityProperty struct {
+	Label           *SensitivityLabel
+	InformationType *InformationType
+	Rank            SensitivityRank
+}
+
+// DataClassification is the sensitivity classification of the columns of a
+// result set, sent by the server when the dataclassification connection
+// parameter is set.
+type DataClassification struct {
+	Labels           []SensitivityLabel
+	InformationTypes []InformationType
+	// Rank is the highest rank of the data in the result set.
+	Rank SensitivityRank
+	// Columns holds the classifications of each column of the result set.
+	Columns [][]SensitivityProperty
+}
+
+// MsgDataClassification is sent to the sqlexp.ReturnMessage of a query before
+// the sqlexp.MsgNext of a result set with classified columns.
+type MsgDataClassification struct {
+	Classification *DataClassification
+}
+
+type featureExtDataClassification struct {
+}
+
+func (f *featureExtDataClassification) featureID() byte {
+	return featExtDATACLASSIFICATION
+}
+
+func (f *featureExtDataClassification) toBytes() []byte {
+	return []byte{dataClassificationVersion}
+}
+
+type dataClassificationAckStruct struct {
+	Version int
+	Enabled bool
+}
+
+// parseDataClassification reads a DATACLASSIFICATION token of the given
+// version.
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tds/85dfd8d5-fa93-4ca0-8a47-d3bd0c5cd1ec
+func parseDataClassification(r *tdsBuffer, version byte) *DataClassification {
+	dc := &DataClassification{Rank: SensitivityRankNotDefined}
+	dc.Labels = make([]SensitivityLabel, r.uint16())
+	for i := range dc.Labels {
+		dc.Labels[i].Name = r.UsVarChar()
+		dc.Labels[i].ID = r.UsVarChar()
+	}
+	dc.InformationTypes = make([]InformationType, r.uint16())
+	for i := range dc.InformationTypes {
+		dc.InformationTypes[i].Name = r.UsVarChar()
+		dc.InformationTypes[i].ID = r.UsVarChar()
+	}
+	if version >= 2 {
+		dc.Rank = SensitivityRank(r.int32())
+	}
+	dc.Columns = make([][]SensitivityProperty, r.uint16())
+	for i := range dc.Columns {
+		props := make([]SensitivityProperty, r.uint16())
+		for j := range props {
+			props[j].Rank = SensitivityRankNotDefined
+			if label := r.uint16(); label != 0xffff {
+				if int(label) >= len(dc.Labels) {
+					badStreamPanicf("invalid sensitivity label index %d", label)
+				}
+				props[j].Label = &dc.Labels[label]
+			}
+			if infoType := r.uint16(); infoType != 0xffff {
+				if int(infoType) >= len(dc.InformationTypes) {
+					badStreamPanicf("invalid information type index %d", infoType)
+				}
+				props[j].InformationType = &dc.InformationTypes[infoType]
+			}
+			if version >= 2 {
+				props[j].Rank = SensitivityRank(r.int32())
+			}
+		}
+		dc.Columns[i] = props
+	}
+	return dc
+}
+
+// applyDataClassification adds the classification of a result set to its
+// columns.
+func applyDataClassification(columns []columnStruct, dc *DataClassification) {
+	for i := range columns {
+		columns[i].classification = dc
+	}
+}
+
+func (c *columnStruct) sensitivity(index int) []SensitivityProperty {
+	if c.classification == nil || index >= len(c.classification.Columns) {
+		return nil
+	}
+	return c.classification.Columns[index]
+}
+
+// DataClassification returns the sensitivity classification of the result
+// set, or nil when it is not classified.
+func (r *Rows) DataClassification() *DataClassification {
+	if len(r.cols) == 0 {
+		return nil
+	}
+	return r.cols[0].classification
+}
+
+// ColumnTypeSensitivity returns the sensitivity classifications of a column.
+func (r *Rows) ColumnTypeSensitivity(index int) []SensitivityProperty {
+	return r.cols[index].sensitivity(index)
+}
+
+// DataClassification returns the sensitivity classification of the result
+// set, or nil when it is not classified.
+func (r *Rowsq) DataClassification() *DataClassification {
+	if len(r.cols) == 0 {
+		return nil
+	}
+	return r.cols[0].classification
+}
+
+// ColumnTypeSensitivity returns the sensitivity classifications of a column.
+func (r *Rowsq) ColumnTypeSensitivity(index int) []SensitivityProperty {
+	return r.cols[index].sensitivity(index)
+}
@@ -0,0 +1,95 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendUsVarChar(b []byte, s string) []byte {
+	u := str2ucs2(s)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(u)/2))
+	return append(b, u...)
+}
+
+func makeDataClassificationToken(version byte) []byte {
+	var b []byte
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = appendUsVarChar(b, "Confidential")
+	b = appendUsVarChar(b, "c1")
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = appendUsVarChar(b, "Financial")
+	b = appendUsVarChar(b, "f1")
+	b = appendUsVarChar(b, "Contact Info")
+	b = appendUsVarChar(b, "i1")
+	if version >= 2 {
+		b = binary.LittleEndian.AppendUint32(b, uint32(SensitivityRankHigh))
+	}
+	// Three columns: classified twice, not classified, and with only an
+	// information type.
+	b = binary.LittleEndian.AppendUint16(b, 3)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	if version >= 2 {
+		b = binary.LittleEndian.AppendUint32(b, uint32(SensitivityRankHigh))
+	}
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	if version >= 2 {
+		b = binary.LittleEndian.AppendUint32(b, uint32(SensitivityRankMedium))
+	}
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, 0xffff)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	if version >= 2 {
+		b = binary.LittleEndian.AppendUint32(b, uint32(SensitivityRankLow))
+	}
+	return b
+}
+
+func TestParseDataClassification(t *testing.T) {
+	b := makeDataClassificationToken(2)
+	dc := parseDataClassification(&tdsBuffer{packetSize: len(b), rbuf: b, rsize: len(b)}, 2)
+
+	confidential := &SensitivityLabel{Name: "Confidential", ID: "c1"}
+	financial := &InformationType{Name: "Financial", ID: "f1"}
+	contact := &InformationType{Name: "Contact Info", ID: "i1"}
+	assert.Equal(t, []SensitivityLabel{*confidential}, dc.Labels)
+	assert.Equal(t, []InformationType{*financial, *contact}, dc.InformationTypes)
+	assert.Equal(t, SensitivityRankHigh, dc.Rank)
+	assert.Equal(t, [][]SensitivityProperty{
+		{{confidential, financial, SensitivityRankHigh}, {confidential, contact, SensitivityRankMedium}},
+		{},
+		{{nil, contact, SensitivityRankLow}},
+	}, dc.Columns)
+
+	b = makeDataClassificationToken(1)
+	dc = parseDataClassification(&tdsBuffer{packetSize: len(b), rbuf: b, rsize: len(b)}, 1)
+	assert.Equal(t, SensitivityRankNotDefined, dc.Rank)
+	require.Len(t, dc.Columns, 3)
+	assert.Equal(t, SensitivityProperty{Label: confidential, InformationType: financial, Rank: SensitivityRankNotDefined}, dc.Columns[0][0])
+}
+
+func TestRowsDataClassification(t *testing.T) {
+	rows := &Rows{cols: make([]columnStruct, 3)}
+	assert.Nil(t, rows.DataClassification())
+	assert.Nil(t, rows.ColumnTypeSensitivity(0))
+
+	b := makeDataClassificationToken(2)
+	dc := parseDataClassification(&tdsBuffer{packetSize: len(b), rbuf: b, rsize: len(b)}, 2)
+	applyDataClassification(rows.cols, dc)
+	assert.Same(t, dc, rows.DataClassification())
+	assert.Len(t, rows.ColumnTypeSensitivity(0), 2)
+	assert.Empty(t, rows.ColumnTypeSensitivity(1))
+	assert.Equal(t, "Contact Info", rows.ColumnTypeSensitivity(2)[0].InformationType.Name)
+}
+
+func TestParseDataClassificationAck(t *testing.T) {
+	b := []byte{featExtDATACLASSIFICATION, 2, 0, 0, 0, 2, 1, featExtTERMINATOR}
+	ack := parseFeatureExtAck(&tdsBuffer{packetSize: len(b), rbuf: b, rsize: len(b)})
+	assert.Equal(t, dataClassificationAckStruct{Version: 2, Enabled: true}, ack[featExtDATACLASSIFICATION])
+}
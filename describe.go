@@ -0,0 +1,293 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// maxDescribedQueries bounds the number of query texts whose parameter types
+// a Connector remembers.
+const maxDescribedQueries = 1000
+
+// paramTypeCache holds the parameter types suggested by
+// sp_describe_undeclared_parameters, by describeKey. A nil entry records a
+// query whose parameters could not be described.
+type paramTypeCache struct {
+	mu      sync.Mutex
+	queries map[string]map[string]string
+}
+
+func (c *paramTypeCache) get(query string) (types map[string]string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	types, ok = c.queries[query]
+	return
+}
+
+func (c *paramTypeCache) put(query string, types map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.queries == nil {
+		c.queries = make(map[string]map[string]string)
+	}
+	if len(c.queries) >= maxDescribedQueries {
+		for q := range c.queries {
+			delete(c.queries, q)
+			break
+		}
+	}
+	c.queries[query] = types
+}
+
+// describeKey returns the key of the parameter types of a query in a
+// database, whose arguments of explicit types are declared by decls. The
+// suggested types depend on all three.
+func describeKey(database, query string, decls []string) string {
+	return database + "\x00" + strings.Join(decls, ",") + "\x00" + query
+}
+
+func (s *Stmt) describeParameters() bool {
+	return s.c.connector != nil && s.c.connector.DescribeParameters
+}
+
+// hasExplicitType reports whether the type of a parameter was chosen by the
+// caller, in which case it is sent as is rather than with the suggested type.
+func hasExplicitType(v driver.Value) bool {
+	switch v.(type) {
+	case TypedParam, Variant, TVP, sql.Out, VarChar, VarCharMax, NVarCharMax, NChar, DateTime1, DateTimeOffset:
+		return true
+	}
+	return false
+}
+
+// describeArgs looks up the types sp_describe_undeclared_parameters
+// suggests for the parameters of the query, which makeRPCParams then
+// declares them with. The types are looked up once per query text, current
+// database and declarations of the arguments of explicit types, and cached
+// in the Connector. Queries that cannot be described are sent with the usual
+// inferred types; the failure is cached only when describing the query again
+// would fail the same way.
+func (s *Stmt) describeArgs(ctx context.Context, args []namedValue) error {
+	s.paramTypes = nil
+	if isProc(s.query) {
+		return nil
+	}
+	decls, err := s.explicitDecls(args)
+	if err != nil {
+		return err
+	}
+	cache := &s.c.connector.paramTypes
+	key := describeKey(s.c.sess.database, s.query, decls)
+	types, ok := cache.get(key)
+	if !ok {
+		types, err = s.describeUndeclared(ctx, decls)
+		if err != nil {
+			if !s.c.connectionGood {
+				return err
+			}
+			s.c.sess.LogF(ctx, msdsn.LogDebug, "Unable to describe parameters, using inferred types: %v", err)
+			if ctx.Err() != nil || !isPermanentDescribeError(err) {
+				return nil
+			}
+			types = nil
+		}
+		cache.put(key, types)
+	}
+	s.paramTypes = types
+	return nil
+}
+
+// isPermanentDescribeError reports whether describing a query failed
+// because of the query itself, rather than because of a timeout, a
+// cancellation, a lock or an object that may exist later, such as a
+// temporary table created by the batch.
+func isPermanentDescribeError(err error) bool {
+	var serr Error
+	if !errors.As(err, &serr) {
+		return false
+	}
+	switch serr.Number {
+	case 208, // invalid object name
+		1205, // deadlock victim
+		1222: // lock request time out
+		return false
+	}
+	return true
+}
+
+// paramName returns the name an argument is declared with.
+func paramName(a namedValue) string {
+	if len(a.Name) > 0 {
+		return "@" + a.Name
+	}
+	return fmt.Sprintf("@p%d", a.Ordinal)
+}
+
+// makeParamDecl returns the declaration of an argument, such as
+// "@p1 nvarchar(5)".
+func (s *Stmt) makeParamDecl(a namedValue) (string, error) {
+	p, err := s.makeParam(a.Value)
+	if err != nil {
+		return "", err
+	}
+	decl := paramName(a) + " " + makeDecl(p.ti)
+	if isOutputValue(a.Value) {
+		decl += " output"
+	}
+	return decl, nil
+}
+
+// explicitDecls returns the declarations of the arguments whose type was
+// chosen by the caller.
+func (s *Stmt) explicitDecls(args []namedValue) ([]string, error) {
+	var decls []string
+	for _, a := range args {
+		if !hasExplicitType(a.Value) {
+			continue
+		}
+		decl, err := s.makeParamDecl(a)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, decl)
+	}
+	return decls, nil
+}
+
+// describeUndeclared calls sp_describe_undeclared_parameters for the query,
+// declaring the arguments of explicit types with decls, and returns the
+// suggested type of each remaining parameter by name.
+func (s *Stmt) describeUndeclared(ctx context.Context, decls []string) (map[string]string, error) {
+	q := Stmt{c: s.c,
+		query:          "sp_describe_undeclared_parameters",
+		skipEncryption: true,
+	}
+	describeArgs := []namedValue{
+		{Name: "tsql", Ordinal: 1, Value: s.query},
+		{Name: "params", Ordinal: 2, Value: strings.Join(decls, ",")},
+	}
+	oldouts := s.c.outs
+	s.c.clearOuts()
+	defer func() { s.c.outs = oldouts }()
+	rows, err := q.queryContext(ctx, describeArgs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nameCol, typeCol := -1, -1
+	for i, c := range rows.Columns() {
+		switch c {
+		case "name":
+			nameCol = i
+		case "suggested_system_type_name":
+			typeCol = i
+		}
+	}
+	if nameCol < 0 || typeCol < 0 {
+		return nil, fmt.Errorf("mssql: unexpected columns %v from sp_describe_undeclared_parameters", rows.Columns())
+	}
+	types := make(map[string]string)
+	values := make([]driver.Value, len(rows.Columns()))
+	for {
+		if err = rows.Next(values); err == io.EOF {
+			return types, nil
+		} else if err != nil {
+			return nil, err
+		}
+		name, _ := values[nameCol].(string)
+		typ, _ := values[typeCol].(string)
+		types[name] = typ
+	}
+}
+
+// makeDescribedParam returns the parameter for a value declared with the type
+// suggested by the server. ok is false when the value does not convert to
+// that type without loss, so it should be sent with its inferred type.
+func (s *Stmt) makeDescribedParam(v driver.Value, typeDecl string) (res param, ok bool) {
+	ti, err := parseTypeDecl(typeDecl)
+	if err != nil {
+		return res, false
+	}
+	if !convertsWithoutLoss(v, ti) {
+		return res, false
+	}
+	res, err = makeTypedParam(s.c, TypedParam{Value: v, Type: typeDecl})
+	return res, err == nil
+}
+
+// convertsWithoutLoss reports whether v keeps its value when converted to
+// the type ti. Integers out of range are already rejected by makeTypedParam.
+func convertsWithoutLoss(v driver.Value, ti typeInfo) bool {
+	switch v := v.(type) {
+	case string:
+		switch ti.TypeId {
+		case typeBigChar, typeBigVarChar:
+			// Characters outside ASCII may not exist in the code page
+			// of a varchar, so only nvarchar keeps them.
+			return isASCII(v)
+		case typeDecimalN, typeNumericN, typeMoneyN:
+			return fractionDigits(v) <= decimalScale(ti)
+		}
+	case float64:
+		switch ti.TypeId {
+		case typeFltN:
+			return ti.Size == 8 || float64(float32(v)) == v
+		case typeDecimalN, typeNumericN, typeMoneyN:
+			return fractionDigits(strconv.FormatFloat(v, 'f', -1, 64)) <= decimalScale(ti)
+		}
+	case time.Time:
+		switch ti.TypeId {
+		case typeDateN:
+			return v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0
+		case typeDateTimeN:
+			if ti.Size == 4 {
+				return v.Second() == 0 && v.Nanosecond() == 0
+			}
+			return v.Nanosecond() == 0
+		case typeDateTime2N, typeTimeN, typeDateTimeOffsetN:
+			return v.Nanosecond()%int(math.Pow10(9-int(ti.Scale))) == 0
+		}
+	}
+	return true
+}
+
+// decimalScale returns the number of digits after the decimal point of a
+// decimal or money type.
+func decimalScale(ti typeInfo) int {
+	if ti.TypeId == typeMoneyN {
+		return 4
+	}
+	return int(ti.Scale)
+}
+
+// fractionDigits returns the number of digits after the decimal point of a
+// number.
+func fractionDigits(s string) int {
+	_, frac, found := strings.Cut(strings.TrimSpace(s), ".")
+	if !found {
+		return 0
+	}
+	return len(strings.TrimRight(frac, "0"))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
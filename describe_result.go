@@ -0,0 +1,277 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/microsoft/go-mssqldb/internal/querytext"
+)
+
+// ColumnInfo describes a column of the result set of a query, as returned by
+// Conn.DescribeResultSet.
+type ColumnInfo struct {
+	// Ordinal is the 1-based position of the column in the result set.
+	Ordinal int
+	// Name is empty for expressions without an alias.
+	Name string
+	// Hidden columns are not part of the result set. They are added to
+	// identify the source rows, as for queries using FOR BROWSE.
+	Hidden   bool
+	Nullable bool
+
+	// TypeName is the declaration of the column type, such as
+	// "nvarchar(50)" or "decimal(10,2)".
+	TypeName string
+	// DatabaseTypeName, ScanType, Length, Precision and Scale match the
+	// values reported by sql.ColumnType for the same column.
+	DatabaseTypeName    string
+	ScanType            reflect.Type
+	Length              int64
+	HasLength           bool
+	Precision           int64
+	Scale               int64
+	HasPrecisionScale   bool
+	Collation           string
+	UserTypeName        string
+	XMLSchemaCollection string
+
+	Identity  bool
+	Computed  bool
+	Updatable bool
+
+	// The source of the column, when it comes from a table or view column.
+	SourceServer   string
+	SourceDatabase string
+	SourceSchema   string
+	SourceTable    string
+	SourceColumn   string
+}
+
+// DescribeResultSet returns the columns of the first result set of query
+// without running it, using sp_describe_first_result_set. params are sample
+// values of the query parameters, used to declare their types in the same way
+// as when running the query; they may be sql.NamedArg. The values themselves
+// are not sent. Placeholders in query are translated as for Stmt, so ? and $1
+// work with the sqlserver driver.
+//
+// The Conn is obtained from a sql.Conn with Raw:
+//
+//	err = conn.Raw(func(driverConn any) error {
+//		cols, err = driverConn.(*mssql.Conn).DescribeResultSet(ctx, query, id)
+//		return err
+//	})
+func (c *Conn) DescribeResultSet(ctx context.Context, query string, params ...interface{}) ([]ColumnInfo, error) {
+	if !c.connectionGood {
+		return nil, driver.ErrBadConn
+	}
+	if c.processQueryText {
+		query, _ = querytext.ParseParams(query)
+	}
+	s := &Stmt{c: c, query: query}
+	var decls []string
+	for i, p := range params {
+		a := namedValue{Ordinal: i + 1, Value: p}
+		if arg, ok := p.(sql.NamedArg); ok {
+			a.Name, a.Value = arg.Name, arg.Value
+		}
+		if !isOutputValue(a.Value) {
+			v, err := convertInputParameter(a.Value)
+			if err != nil {
+				return nil, err
+			}
+			a.Value = v
+		}
+		decl, err := s.makeParamDecl(a)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, decl)
+	}
+
+	q := Stmt{c: c,
+		query:          "sp_describe_first_result_set",
+		skipEncryption: true,
+	}
+	describeArgs := []namedValue{
+		{Name: "tsql", Ordinal: 1, Value: query},
+		{Name: "params", Ordinal: 2, Value: strings.Join(decls, ",")},
+		// Browse information fills in the source table and column.
+		{Name: "browse_information_mode", Ordinal: 3, Value: int64(1)},
+	}
+	oldouts := c.outs
+	c.clearOuts()
+	defer func() { c.outs = oldouts }()
+	rows, err := q.queryContext(ctx, describeArgs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := rows.Columns()
+	values := make([]driver.Value, len(names))
+	var cols []ColumnInfo
+	for {
+		if err = rows.Next(values); err == io.EOF {
+			return cols, nil
+		} else if err != nil {
+			return nil, err
+		}
+		row := make(map[string]driver.Value, len(names))
+		for i, name := range names {
+			row[name] = values[i]
+		}
+		col, err := makeColumnInfo(row)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+}
+
+// makeColumnInfo returns the column described by a row of
+// sp_describe_first_result_set, keyed by column name.
+func makeColumnInfo(row map[string]driver.Value) (col ColumnInfo, err error) {
+	str := func(name string) string {
+		s, _ := row[name].(string)
+		return s
+	}
+	num := func(name string) int64 {
+		n, _ := row[name].(int64)
+		return n
+	}
+	flag := func(name string) bool {
+		b, _ := row[name].(bool)
+		return b
+	}
+	col = ColumnInfo{
+		Ordinal:        int(num("column_ordinal")),
+		Name:           str("name"),
+		Hidden:         flag("is_hidden"),
+		Nullable:       flag("is_nullable"),
+		TypeName:       str("system_type_name"),
+		Collation:      str("collation_name"),
+		Identity:       flag("is_identity_column"),
+		Computed:       flag("is_computed_column"),
+		Updatable:      flag("is_updateable"),
+		SourceServer:   str("source_server"),
+		SourceDatabase: str("source_database"),
+		SourceSchema:   str("source_schema"),
+		SourceTable:    str("source_table"),
+		SourceColumn:   str("source_column"),
+	}
+	if name := str("user_type_name"); name != "" {
+		col.UserTypeName = str("user_type_schema") + "." + name
+	}
+	if name := str("xml_collection_name"); name != "" {
+		col.XMLSchemaCollection = str("xml_collection_schema") + "." + name
+	}
+	ti, err := describedTypeInfo(num("system_type_id"), num("max_length"), num("precision"), num("scale"), str("user_type_name"))
+	if err != nil {
+		return col, fmt.Errorf("mssql: cannot describe column %d (%s): %v", col.Ordinal, col.TypeName, err)
+	}
+	col.DatabaseTypeName = makeGoLangTypeName(ti)
+	col.ScanType = makeGoLangScanType(ti)
+	if ti.TypeId == typeUdt && !isBuiltinUdt(ti.UdtInfo.TypeName) {
+		col.Length, col.HasLength = int64(ti.Size), true
+	} else {
+		col.Length, col.HasLength = makeGoLangTypeLength(ti)
+	}
+	col.Precision, col.Scale, col.HasPrecisionScale = makeGoLangTypePrecisionScale(ti)
+	return col, nil
+}
+
+func isBuiltinUdt(name string) bool {
+	switch name {
+	case "hierarchyid", "geometry", "geography":
+		return true
+	}
+	return false
+}
+
+// describedTypeInfo returns the type info the server sends in the column
+// metadata of a column with the given system type, so that it is reported
+// the same way as the columns of a result set.
+func describedTypeInfo(systemTypeID, maxLength, prec, scale int64, udtName string) (ti typeInfo, err error) {
+	size := int(maxLength)
+	if maxLength == -1 {
+		size = 0xffff
+	}
+	switch systemTypeID {
+	case 48: // tinyint
+		ti = typeInfo{TypeId: typeIntN, Size: 1}
+	case 52: // smallint
+		ti = typeInfo{TypeId: typeIntN, Size: 2}
+	case 56: // int
+		ti = typeInfo{TypeId: typeIntN, Size: 4}
+	case 127: // bigint
+		ti = typeInfo{TypeId: typeIntN, Size: 8}
+	case 104: // bit
+		ti = typeInfo{TypeId: typeBitN, Size: 1}
+	case 59: // real
+		ti = typeInfo{TypeId: typeFltN, Size: 4}
+	case 62: // float
+		ti = typeInfo{TypeId: typeFltN, Size: 8}
+	case 122: // smallmoney
+		ti = typeInfo{TypeId: typeMoneyN, Size: 4}
+	case 60: // money
+		ti = typeInfo{TypeId: typeMoneyN, Size: 8}
+	case 58: // smalldatetime
+		ti = typeInfo{TypeId: typeDateTimeN, Size: 4}
+	case 61: // datetime
+		ti = typeInfo{TypeId: typeDateTimeN, Size: 8}
+	case 40: // date
+		ti = typeInfo{TypeId: typeDateN, Size: 3}
+	case 41: // time
+		ti = typeInfo{TypeId: typeTimeN}
+	case 42: // datetime2
+		ti = typeInfo{TypeId: typeDateTime2N}
+	case 43: // datetimeoffset
+		ti = typeInfo{TypeId: typeDateTimeOffsetN}
+	case 106: // decimal
+		ti = typeInfo{TypeId: typeDecimalN}
+	case 108: // numeric
+		ti = typeInfo{TypeId: typeNumericN}
+	case 36: // uniqueidentifier
+		ti = typeInfo{TypeId: typeGuid, Size: 16}
+	case 165: // varbinary
+		ti = typeInfo{TypeId: typeBigVarBin}
+	case 173, 189: // binary, timestamp
+		ti = typeInfo{TypeId: typeBigBinary}
+	case 167: // varchar
+		ti = typeInfo{TypeId: typeBigVarChar}
+	case 175: // char
+		ti = typeInfo{TypeId: typeBigChar}
+	case 231: // nvarchar and sysname
+		ti = typeInfo{TypeId: typeNVarChar}
+	case 239: // nchar
+		ti = typeInfo{TypeId: typeNChar}
+	case 34: // image
+		ti = typeInfo{TypeId: typeImage}
+	case 35: // text
+		ti = typeInfo{TypeId: typeText}
+	case 99: // ntext
+		ti = typeInfo{TypeId: typeNText}
+	case 241: // xml
+		ti = typeInfo{TypeId: typeXml}
+	case 98: // sql_variant
+		ti = typeInfo{TypeId: typeVariant}
+	case 240: // CLR types
+		ti = typeInfo{TypeId: typeUdt}
+		ti.UdtInfo.TypeName = udtName
+	default:
+		return ti, fmt.Errorf("unsupported system type %d", systemTypeID)
+	}
+	if ti.Size == 0 {
+		ti.Size = size
+	}
+	switch ti.TypeId {
+	case typeDecimalN, typeNumericN, typeTimeN, typeDateTime2N, typeDateTimeOffsetN:
+		ti.Prec, ti.Scale = uint8(prec), uint8(scale)
+	}
+	return ti, nil
+}
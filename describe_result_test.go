@@ -0,0 +1,166 @@
+package mssql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeColumnInfo(t *testing.T) {
+	col, err := makeColumnInfo(map[string]driver.Value{
+		"is_hidden":          false,
+		"column_ordinal":     int64(2),
+		"name":               "Name",
+		"is_nullable":        true,
+		"system_type_id":     int64(231),
+		"system_type_name":   "nvarchar(50)",
+		"max_length":         int64(100),
+		"precision":          int64(0),
+		"scale":              int64(0),
+		"collation_name":     "Latin1_General_CI_AS",
+		"user_type_schema":   nil,
+		"user_type_name":     nil,
+		"source_database":    "shop",
+		"source_schema":      "dbo",
+		"source_table":       "customers",
+		"source_column":      "name",
+		"is_identity_column": false,
+		"is_updateable":      true,
+		"is_computed_column": false,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ColumnInfo{
+		Ordinal:          2,
+		Name:             "Name",
+		Nullable:         true,
+		TypeName:         "nvarchar(50)",
+		DatabaseTypeName: "NVARCHAR",
+		ScanType:         reflect.TypeOf(""),
+		Length:           50,
+		HasLength:        true,
+		Collation:        "Latin1_General_CI_AS",
+		Updatable:        true,
+		SourceDatabase:   "shop",
+		SourceSchema:     "dbo",
+		SourceTable:      "customers",
+		SourceColumn:     "name",
+	}, col)
+
+	_, err = makeColumnInfo(map[string]driver.Value{"system_type_id": int64(1)})
+	assert.Error(t, err)
+}
+
+func TestDescribedTypeInfo(t *testing.T) {
+	tests := []struct {
+		id, maxLength, prec, scale int64
+		udt                        string
+		name                       string
+		length                     int64
+		hasLength                  bool
+	}{
+		{56, 4, 10, 0, "", "INT", 0, false},
+		{167, -1, 0, 0, "", "VARCHAR", 2147483645, true},
+		{239, 20, 0, 0, "", "NCHAR", 10, true},
+		{106, 9, 12, 4, "", "DECIMAL", 0, false},
+		{42, 8, 27, 7, "", "DATETIME2", 0, false},
+		{189, 8, 0, 0, "", "BINARY", 8, true},
+		{240, -1, 0, 0, "geometry", "GEOMETRY", 2147483647, true},
+	}
+	for _, tt := range tests {
+		ti, err := describedTypeInfo(tt.id, tt.maxLength, tt.prec, tt.scale, tt.udt)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.name, makeGoLangTypeName(ti))
+		length, ok := makeGoLangTypeLength(ti)
+		assert.Equal(t, tt.length, length, tt.name)
+		assert.Equal(t, tt.hasLength, ok, tt.name)
+	}
+
+	ti, err := describedTypeInfo(106, 9, 12, 4, "")
+	require.NoError(t, err)
+	prec, scale, ok := makeGoLangTypePrecisionScale(ti)
+	assert.Equal(t, []int64{12, 4}, []int64{prec, scale})
+	assert.True(t, ok)
+}
+
+func TestDescribeResultSet(t *testing.T) {
+	checkConnStr(t)
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `create table #orders (
+		id int identity primary key,
+		code varchar(10) collate Latin1_General_CI_AS not null,
+		amount decimal(10, 2),
+		doubled as amount * 2)`)
+	require.NoError(t, err)
+
+	var cols []ColumnInfo
+	err = conn.Raw(func(driverConn any) error {
+		cols, err = driverConn.(*Conn).DescribeResultSet(ctx,
+			"select id, code, doubled, @p1 + 1 from #orders where id > @p1 and code = @code",
+			int32(1), sql.Named("code", "a"))
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, cols, 4)
+
+	assert.Equal(t, 1, cols[0].Ordinal)
+	assert.Equal(t, "id", cols[0].Name)
+	assert.Equal(t, "INT", cols[0].DatabaseTypeName)
+	assert.True(t, cols[0].Identity)
+	assert.False(t, cols[0].Nullable)
+	assert.Equal(t, "id", cols[0].SourceColumn)
+
+	assert.Equal(t, "varchar(10)", cols[1].TypeName)
+	assert.Equal(t, int64(10), cols[1].Length)
+	assert.Equal(t, "Latin1_General_CI_AS", cols[1].Collation)
+
+	assert.True(t, cols[2].Computed)
+	assert.Equal(t, "DECIMAL", cols[2].DatabaseTypeName)
+
+	assert.Equal(t, "", cols[3].Name)
+	assert.Equal(t, "INT", cols[3].DatabaseTypeName)
+
+	err = conn.Raw(func(driverConn any) error {
+		_, err := driverConn.(*Conn).DescribeResultSet(ctx, "select * from #missing")
+		return err
+	})
+	assert.Error(t, err)
+}
+
+func TestDescribeResultSetProcessQueryText(t *testing.T) {
+	checkConnStr(t)
+	db, err := sql.Open("sqlserver", makeConnStr(t).String())
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, query := range []string{
+		"select name from sys.objects where object_id > ? and name <> ?",
+		"select name from sys.objects where object_id > $1 and name <> $2",
+	} {
+		var cols []ColumnInfo
+		err = conn.Raw(func(driverConn any) error {
+			cols, err = driverConn.(*Conn).DescribeResultSet(ctx, query, int32(1), "a")
+			return err
+		})
+		require.NoError(t, err, query)
+		require.Len(t, cols, 1, query)
+		assert.Equal(t, "name", cols[0].Name, query)
+	}
+}
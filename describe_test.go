@@ -0,0 +1,170 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParamTypeCache(t *testing.T) {
+	var c paramTypeCache
+	_, ok := c.get("select @p1")
+	assert.False(t, ok)
+
+	c.put("select @p1", map[string]string{"@p1": "int"})
+	c.put("select @p2", nil)
+	types, ok := c.get("select @p1")
+	assert.True(t, ok)
+	assert.Equal(t, "int", types["@p1"])
+	types, ok = c.get("select @p2")
+	assert.True(t, ok, "failures are cached too")
+	assert.Nil(t, types)
+
+	for i := 0; i < maxDescribedQueries+10; i++ {
+		c.put(fmt.Sprintf("select %d", i), nil)
+	}
+	assert.Len(t, c.queries, maxDescribedQueries)
+}
+
+func TestDescribeKey(t *testing.T) {
+	query := "select * from t where a = @p1"
+	keys := map[string]bool{
+		describeKey("db1", query, nil):                          true,
+		describeKey("db2", query, nil):                          true,
+		describeKey("db1", query, []string{"@p2 varchar(10)"}):  true,
+		describeKey("db1", query, []string{"@p2 nvarchar(10)"}): true,
+		describeKey("db1", query+" ", nil):                      true,
+	}
+	assert.Len(t, keys, 5, "database, declarations and query make distinct keys")
+}
+
+func TestIsPermanentDescribeError(t *testing.T) {
+	assert.True(t, isPermanentDescribeError(Error{Number: 102, Message: "Incorrect syntax"}))
+	assert.True(t, isPermanentDescribeError(fmt.Errorf("wrapped: %w", Error{Number: 11508})))
+	assert.False(t, isPermanentDescribeError(Error{Number: 208, Message: "Invalid object name '#later'"}))
+	assert.False(t, isPermanentDescribeError(Error{Number: 1205}))
+	assert.False(t, isPermanentDescribeError(context.DeadlineExceeded))
+	assert.False(t, isPermanentDescribeError(context.Canceled))
+}
+
+func TestMakeDescribedParamFallback(t *testing.T) {
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}}
+	for _, tt := range []struct {
+		value driver.Value
+		decl  string
+		ok    bool
+	}{
+		{int64(5), "int", true},
+		{int64(5e9), "int", false},
+		{int64(300), "tinyint", false},
+		{2.0, "int", true},
+		{2.7, "int", false},
+		{1.5, "real", true},
+		{0.1, "real", false},
+		{0.1, "float", true},
+		{1.25, "decimal(10, 2)", true},
+		{1.255, "decimal(10, 2)", false},
+		{"1.25", "decimal(10, 2)", true},
+		{"1.255", "decimal(10, 2)", false},
+		{"1.2345", "money", true},
+		{"1.23456", "money", false},
+		{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "date", true},
+		{time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), "date", false},
+		{time.Date(2024, 1, 2, 3, 4, 5, 120000000, time.UTC), "datetime2(2)", true},
+		{time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC), "datetime2(2)", false},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "smalldatetime", false},
+		{"abcé", "varchar(10)", false},
+	} {
+		_, ok := s.makeDescribedParam(tt.value, tt.decl)
+		assert.Equal(t, tt.ok, ok, "%v as %s", tt.value, tt.decl)
+	}
+
+	// A value that does not fit the suggested type is sent with its
+	// inferred type.
+	s.paramTypes = map[string]string{"@p1": "int", "@p2": "int"}
+	_, decls, err := s.makeRPCParams([]namedValue{{Ordinal: 1, Value: int64(5e9)}, {Ordinal: 2, Value: 2.7}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@p1 bigint", "@p2 float"}, decls)
+}
+
+func TestMakeRPCParamsDescribed(t *testing.T) {
+	s := &Stmt{
+		c:     &Conn{sess: &tdsSession{}},
+		query: "select * from t where a = @p1 and b = @p2 and c = @p3 and d = @name and e = @p5",
+		paramTypes: map[string]string{
+			"@p1":   "varchar(50)",
+			"@p2":   "varchar(50)",
+			"@p3":   "int",
+			"@name": "decimal(10,2)",
+			"@p5":   "varchar(10)",
+		},
+	}
+	args := []namedValue{
+		{Ordinal: 1, Value: "abc"},
+		{Ordinal: 2, Value: "abcé"},
+		{Ordinal: 3, Value: "not a number"},
+		{Name: "name", Ordinal: 4, Value: "1.5"},
+		{Ordinal: 5, Value: NVarCharMax("explicit")},
+	}
+	params, decls, err := s.makeRPCParams(args, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"@p1 varchar(50)",
+		"@p2 nvarchar(4)",
+		"@p3 nvarchar(12)",
+		"@name decimal(10, 2)",
+		"@p5 nvarchar(max)",
+	}, decls)
+	assert.Equal(t, []byte("abc"), params[2].buffer)
+}
+
+func TestDescribeParameters(t *testing.T) {
+	checkConnStr(t)
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	connector.DescribeParameters = true
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := testContext(t)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "create table #described (code varchar(10) primary key, amount decimal(10, 2))")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "insert into #described values (@p1, @p2)", "a", 1.25)
+	require.NoError(t, err)
+
+	// Temporary tables created by the session can be described.
+	query := "select amount from #described where code = @p1"
+	var amount string
+	err = conn.QueryRowContext(ctx, query, "a").Scan(&amount)
+	require.NoError(t, err)
+	assert.Equal(t, "1.25", amount)
+	var database string
+	require.NoError(t, conn.QueryRowContext(ctx, "select db_name()").Scan(&database))
+	types, ok := connector.paramTypes.get(describeKey(database, query, nil))
+	assert.True(t, ok, "types should be cached")
+	assert.Equal(t, map[string]string{"@p1": "varchar(10)"}, types)
+
+	// Explicit types are kept.
+	err = conn.QueryRowContext(ctx, query, NVarCharMax("a")).Scan(&amount)
+	require.NoError(t, err)
+	assert.Equal(t, "1.25", amount)
+
+	// Queries that cannot be described run with the inferred types.
+	var n int
+	later := "create table #later (x int); select count(*) from #later where x = @p1"
+	err = conn.QueryRowContext(ctx, later, 1).Scan(&n)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, ok = connector.paramTypes.get(describeKey(database, later, nil))
+	assert.False(t, ok, "a missing object is not cached as a failure")
+}
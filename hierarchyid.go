@@ -0,0 +1,378 @@
+package mssql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HierarchyID is a position in a tree hierarchy, as stored in a SQL Server
+// hierarchyid column. The zero value is the root node "/".
+//
+// A HierarchyID can be scanned from a hierarchyid column and used as a query
+// or bulk copy parameter; it is sent to the server in its binary form, which
+// SQL Server converts implicitly to hierarchyid.
+type HierarchyID struct {
+	// levels holds the labels of each level of the path. A level has more
+	// than one label when it was created between two siblings, e.g. /1.2/.
+	levels [][]int64
+}
+
+// ParseHierarchyID parses the canonical string representation of a
+// hierarchyid, such as "/", "/1/" or "/1/3.2/-4/".
+func ParseHierarchyID(s string) (HierarchyID, error) {
+	if s == "/" {
+		return HierarchyID{}, nil
+	}
+	if len(s) < 3 || s[0] != '/' || s[len(s)-1] != '/' {
+		return HierarchyID{}, fmt.Errorf("mssql: invalid hierarchyid %q", s)
+	}
+	var h HierarchyID
+	for _, level := range strings.Split(s[1:len(s)-1], "/") {
+		if level == "" {
+			return HierarchyID{}, fmt.Errorf("mssql: invalid hierarchyid %q: empty level", s)
+		}
+		parts := strings.Split(level, ".")
+		labels := make([]int64, len(parts))
+		for i, part := range parts {
+			label, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return HierarchyID{}, fmt.Errorf("mssql: invalid hierarchyid %q: %v", s, err)
+			}
+			if err := checkHierarchyIDLabel(label, i == len(parts)-1); err != nil {
+				return HierarchyID{}, err
+			}
+			labels[i] = label
+		}
+		h.levels = append(h.levels, labels)
+	}
+	return h, nil
+}
+
+// String returns the canonical representation of h, e.g. "/1/3.2/".
+func (h HierarchyID) String() string {
+	var sb strings.Builder
+	sb.WriteByte('/')
+	for _, level := range h.levels {
+		for i, label := range level {
+			if i > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(strconv.FormatInt(label, 10))
+		}
+		sb.WriteByte('/')
+	}
+	return sb.String()
+}
+
+// GetLevel returns the depth of h in the tree. The root is at level 0.
+func (h HierarchyID) GetLevel() int {
+	return len(h.levels)
+}
+
+// GetAncestor returns the ancestor n levels above h. GetAncestor(0) returns h.
+// It returns false when n is negative or greater than the level of h.
+func (h HierarchyID) GetAncestor(n int) (HierarchyID, bool) {
+	if n < 0 || n > len(h.levels) {
+		return HierarchyID{}, false
+	}
+	return HierarchyID{levels: h.levels[:len(h.levels)-n]}, true
+}
+
+// IsDescendantOf reports whether h is parent or one of its descendants.
+func (h HierarchyID) IsDescendantOf(parent HierarchyID) bool {
+	if len(parent.levels) > len(h.levels) {
+		return false
+	}
+	for i, level := range parent.levels {
+		if !equalHierarchyIDLevel(level, h.levels[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare returns -1, 0 or 1 depending on whether h sorts before, equal to
+// or after other. Nodes are ordered depth-first, the same way SQL Server
+// orders hierarchyid values.
+func (h HierarchyID) Compare(other HierarchyID) int {
+	a, _ := h.MarshalBinary()
+	b, _ := other.MarshalBinary()
+	return bytes.Compare(a, b)
+}
+
+// Equal reports whether h and other are the same node.
+func (h HierarchyID) Equal(other HierarchyID) bool {
+	if len(h.levels) != len(other.levels) {
+		return false
+	}
+	for i := range h.levels {
+		if !equalHierarchyIDLevel(h.levels[i], other.levels[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalHierarchyIDLevel(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Scan implements the sql.Scanner interface. It accepts the binary form
+// returned for hierarchyid columns and the string form returned by
+// hierarchyid::ToString().
+func (h *HierarchyID) Scan(v interface{}) error {
+	switch vt := v.(type) {
+	case []byte:
+		return h.UnmarshalBinary(vt)
+	case string:
+		return h.UnmarshalText([]byte(vt))
+	default:
+		return fmt.Errorf("mssql: cannot convert %T to HierarchyID", v)
+	}
+}
+
+// Value implements the driver.Valuer interface, returning the binary form of h.
+func (h HierarchyID) Value() (driver.Value, error) {
+	return h.MarshalBinary()
+}
+
+// MarshalText returns the canonical string representation of h.
+func (h HierarchyID) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText parses the canonical string representation of a hierarchyid.
+func (h *HierarchyID) UnmarshalText(text []byte) error {
+	parsed, err := ParseHierarchyID(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// hierarchyIDPattern describes the bit layout used for labels in the range
+// starting at min. Each 'x' holds a bit of label-min, most significant first,
+// '0' and '1' are fixed bits and 'T' is 1 for the last label of a level.
+type hierarchyIDPattern struct {
+	min     int64
+	layout  string
+	prefix  string
+	xBits   uint
+	maximum int64
+}
+
+var hierarchyIDPatterns = func() []hierarchyIDPattern {
+	patterns := []hierarchyIDPattern{
+		{min: -281479271682120, layout: "000100xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+		{min: -4294971464, layout: "000101xxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+		{min: -4168, layout: "000110xxxxx0xxx0x1xxxT"},
+		{min: -72, layout: "0010xx0x1xxxT"},
+		{min: -8, layout: "00111xxxT"},
+		{min: 0, layout: "01xxT"},
+		{min: 4, layout: "100xxT"},
+		{min: 8, layout: "101xxxT"},
+		{min: 16, layout: "110xx0x1xxxT"},
+		{min: 80, layout: "1110xxx0xxx0x1xxxT"},
+		{min: 1104, layout: "11110xxxxx0xxx0x1xxxT"},
+		{min: 5200, layout: "111110xxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+		{min: 4294972496, layout: "111111xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+	}
+	for i := range patterns {
+		p := &patterns[i]
+		p.prefix = p.layout[:strings.IndexByte(p.layout, 'x')]
+		p.xBits = uint(strings.Count(p.layout, "x"))
+		p.maximum = p.min + 1<<p.xBits - 1
+	}
+	return patterns
+}()
+
+func findHierarchyIDPattern(v int64) *hierarchyIDPattern {
+	for i := range hierarchyIDPatterns {
+		p := &hierarchyIDPatterns[i]
+		if v >= p.min && v <= p.maximum {
+			return p
+		}
+	}
+	return nil
+}
+
+// checkHierarchyIDLabel reports whether label can be encoded. Labels that are
+// not the last of their level are stored as label+1 with a cleared T bit, so
+// that /1.2/ sorts between /1/ and /2/.
+func checkHierarchyIDLabel(label int64, last bool) error {
+	v := label
+	if !last {
+		v++
+	}
+	if findHierarchyIDPattern(v) == nil {
+		return fmt.Errorf("mssql: hierarchyid label %d is out of range", label)
+	}
+	return nil
+}
+
+// MarshalBinary returns the SQL Server serialization of h.
+func (h HierarchyID) MarshalBinary() ([]byte, error) {
+	var w hierarchyIDBitWriter
+	for _, level := range h.levels {
+		for i, label := range level {
+			last := i == len(level)-1
+			v := label
+			if !last {
+				v++
+			}
+			p := findHierarchyIDPattern(v)
+			if p == nil {
+				return nil, fmt.Errorf("mssql: hierarchyid label %d is out of range", label)
+			}
+			offset := uint64(v - p.min)
+			x := p.xBits
+			for _, c := range []byte(p.layout) {
+				switch c {
+				case '0':
+					w.writeBit(false)
+				case '1':
+					w.writeBit(true)
+				case 'x':
+					x--
+					w.writeBit(offset>>x&1 == 1)
+				case 'T':
+					w.writeBit(last)
+				}
+			}
+		}
+	}
+	if w.buf == nil {
+		// The root is an empty value, not NULL.
+		return []byte{}, nil
+	}
+	return w.buf, nil
+}
+
+// UnmarshalBinary parses the SQL Server serialization of a hierarchyid.
+func (h *HierarchyID) UnmarshalBinary(data []byte) error {
+	r := hierarchyIDBitReader{buf: data}
+	var levels [][]int64
+	var level []int64
+	for !r.restIsZero() {
+		p := r.matchPattern()
+		if p == nil {
+			return errors.New("mssql: invalid hierarchyid encoding")
+		}
+		var offset uint64
+		var last bool
+		for _, c := range []byte(p.layout) {
+			bit, ok := r.readBit()
+			if !ok {
+				return errors.New("mssql: truncated hierarchyid encoding")
+			}
+			switch c {
+			case '0', '1':
+				if bit != (c == '1') {
+					return errors.New("mssql: invalid hierarchyid encoding")
+				}
+			case 'x':
+				offset <<= 1
+				if bit {
+					offset |= 1
+				}
+			case 'T':
+				last = bit
+			}
+		}
+		label := p.min + int64(offset)
+		if !last {
+			label--
+		}
+		level = append(level, label)
+		if last {
+			levels = append(levels, level)
+			level = nil
+		}
+	}
+	if level != nil {
+		return errors.New("mssql: truncated hierarchyid encoding")
+	}
+	*h = HierarchyID{levels: levels}
+	return nil
+}
+
+type hierarchyIDBitWriter struct {
+	buf  []byte
+	nbit uint
+}
+
+func (w *hierarchyIDBitWriter) writeBit(bit bool) {
+	if w.nbit%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 0x80 >> (w.nbit % 8)
+	}
+	w.nbit++
+}
+
+type hierarchyIDBitReader struct {
+	buf []byte
+	pos uint
+}
+
+func (r *hierarchyIDBitReader) bit(pos uint) (bool, bool) {
+	if pos >= uint(len(r.buf))*8 {
+		return false, false
+	}
+	return r.buf[pos/8]&(0x80>>(pos%8)) != 0, true
+}
+
+func (r *hierarchyIDBitReader) readBit() (bool, bool) {
+	bit, ok := r.bit(r.pos)
+	if ok {
+		r.pos++
+	}
+	return bit, ok
+}
+
+// restIsZero reports whether only zero padding remains.
+func (r *hierarchyIDBitReader) restIsZero() bool {
+	for pos := r.pos; ; pos++ {
+		bit, ok := r.bit(pos)
+		if !ok {
+			return true
+		}
+		if bit {
+			return false
+		}
+	}
+}
+
+// matchPattern returns the pattern whose prefix matches the bits at the
+// current position without consuming them.
+func (r *hierarchyIDBitReader) matchPattern() *hierarchyIDPattern {
+	for i := range hierarchyIDPatterns {
+		p := &hierarchyIDPatterns[i]
+		matched := true
+		for j, c := range []byte(p.prefix) {
+			bit, ok := r.bit(r.pos + uint(j))
+			if !ok || bit != (c == '1') {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHierarchyIDPatterns(t *testing.T) {
+	prev := hierarchyIDPatterns[0].min - 1
+	for _, p := range hierarchyIDPatterns {
+		assert.Equal(t, prev+1, p.min, "patterns must cover a contiguous range: %s", p.layout)
+		assert.Equal(t, byte('T'), p.layout[len(p.layout)-1], p.layout)
+		prev = p.maximum
+	}
+	assert.Equal(t, int64(-281479271682120), hierarchyIDPatterns[0].min)
+	assert.Equal(t, int64(281479271683151), prev)
+}
+
+func TestHierarchyIDBinary(t *testing.T) {
+	tests := []struct {
+		s   string
+		bin []byte
+	}{
+		{"/", []byte{}},
+		{"/1/", []byte{0x58}},
+		{"/2/", []byte{0x68}},
+		{"/3/", []byte{0x78}},
+		{"/1/1/", []byte{0x5a, 0xc0}},
+		{"/-1/", []byte{0x3f, 0x80}},
+		{"/1.2/", []byte{0x63, 0x40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			h, err := ParseHierarchyID(tt.s)
+			require.NoError(t, err)
+			bin, err := h.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, tt.bin, append([]byte{}, bin...))
+
+			var decoded HierarchyID
+			require.NoError(t, decoded.UnmarshalBinary(tt.bin))
+			assert.Equal(t, tt.s, decoded.String())
+		})
+	}
+}
+
+func TestHierarchyIDRoundTrip(t *testing.T) {
+	labels := []string{"0", "3", "4", "7", "8", "15", "16", "79", "80", "1103", "1104", "5199", "5200", "4294972495",
+		"4294972496", "281479271683150", "281479271683151",
+		"-1", "-8", "-9", "-72", "-73", "-4168", "-4169", "-4294971464",
+		"-4294971465", "-281479271682120"}
+	for _, label := range labels {
+		for _, s := range []string{"/" + label + "/", "/1/2." + label + "/", "/" + label + "/-3.7.1/"} {
+			h, err := ParseHierarchyID(s)
+			require.NoError(t, err, s)
+			bin, err := h.MarshalBinary()
+			require.NoError(t, err, s)
+			var decoded HierarchyID
+			require.NoError(t, decoded.UnmarshalBinary(bin), s)
+			assert.Equal(t, s, decoded.String())
+			assert.True(t, h.Equal(decoded), s)
+		}
+	}
+	// Labels followed by another one are stored plus one.
+	for _, s := range []string{"/4294972495.1/", "/281479271683150.1/", "/-4294971465.1/", "/-281479271682121.1/"} {
+		h, err := ParseHierarchyID(s)
+		require.NoError(t, err, s)
+		bin, err := h.MarshalBinary()
+		require.NoError(t, err, s)
+		var decoded HierarchyID
+		require.NoError(t, decoded.UnmarshalBinary(bin), s)
+		assert.Equal(t, s, decoded.String())
+	}
+}
+
+func TestHierarchyIDParseErrors(t *testing.T) {
+	for _, s := range []string{"", "1/", "/1", "//", "/1//", "/a/", "/1..2/", "/281479271683152/", "/281479271683151.1/", "/-281479271682121/"} {
+		_, err := ParseHierarchyID(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestHierarchyIDUnmarshalErrors(t *testing.T) {
+	var h HierarchyID
+	// 0000 1... does not match any label pattern.
+	assert.Error(t, h.UnmarshalBinary([]byte{0x08}))
+	// /1.x/ without the final label.
+	assert.Error(t, h.UnmarshalBinary([]byte{0x60}))
+	// 110 prefix with its fixed bits cut off.
+	assert.Error(t, h.UnmarshalBinary([]byte{0xc0 | 0x1f}))
+}
+
+func TestHierarchyIDCompare(t *testing.T) {
+	ordered := []string{"/", "/-1/", "/0/", "/1/", "/1/1/", "/1/2/", "/1.2/", "/2/", "/2/1/", "/3/", "/3.-1/", "/3.1/", "/4/", "/80/", "/5200/"}
+	shuffled := append([]string{}, ordered...)
+	for i, j := 0, len(shuffled)-1; i < j; i, j = i+1, j-1 {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	ids := make([]HierarchyID, len(shuffled))
+	for i, s := range shuffled {
+		var err error
+		ids[i], err = ParseHierarchyID(s)
+		require.NoError(t, err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+	got := make([]string, len(ids))
+	for i, h := range ids {
+		got[i] = h.String()
+	}
+	assert.Equal(t, ordered, got)
+}
+
+func TestHierarchyIDAncestors(t *testing.T) {
+	h, err := ParseHierarchyID("/1/3.2/4/")
+	require.NoError(t, err)
+	assert.Equal(t, 3, h.GetLevel())
+	assert.Equal(t, 0, HierarchyID{}.GetLevel())
+
+	for n, want := range []string{"/1/3.2/4/", "/1/3.2/", "/1/", "/"} {
+		a, ok := h.GetAncestor(n)
+		require.True(t, ok)
+		assert.Equal(t, want, a.String())
+		assert.True(t, h.IsDescendantOf(a))
+		assert.Equal(t, n == 0, a.IsDescendantOf(h))
+	}
+	_, ok := h.GetAncestor(4)
+	assert.False(t, ok)
+	_, ok = h.GetAncestor(-1)
+	assert.False(t, ok)
+
+	sibling, err := ParseHierarchyID("/1/3/")
+	require.NoError(t, err)
+	assert.False(t, h.IsDescendantOf(sibling))
+}
+
+func TestHierarchyIDScanValue(t *testing.T) {
+	var h HierarchyID
+	require.NoError(t, h.Scan([]byte{0x5a, 0xc0}))
+	assert.Equal(t, "/1/1/", h.String())
+	require.NoError(t, h.Scan("/2/"))
+	assert.Equal(t, "/2/", h.String())
+	assert.Error(t, h.Scan(1))
+
+	v, err := h.Value()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x68}, v)
+	v, err = HierarchyID{}.Value()
+	require.NoError(t, err)
+	assert.NotNil(t, v, "the root must not be sent as NULL")
+	assert.Implements(t, (*driver.Valuer)(nil), h)
+
+	text, err := h.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "/2/", string(text))
+}
+
+func TestHierarchyIDQuery(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	h, err := ParseHierarchyID("/1/3.2/-4/")
+	require.NoError(t, err)
+
+	var s string
+	var roundTrip HierarchyID
+	err = conn.QueryRow("select cast(@p1 as hierarchyid).ToString(), cast(@p1 as hierarchyid)", h).Scan(&s, &roundTrip)
+	require.NoError(t, err)
+	assert.Equal(t, h.String(), s)
+	assert.True(t, h.Equal(roundTrip))
+
+	parent, _ := h.GetAncestor(1)
+	var isDescendant bool
+	err = conn.QueryRow("select cast(@p1 as hierarchyid).IsDescendantOf(@p2)", h, parent).Scan(&isDescendant)
+	require.NoError(t, err)
+	assert.Equal(t, h.IsDescendantOf(parent), isDescendant)
+
+	var root HierarchyID
+	err = conn.QueryRow("select cast(@p1 as hierarchyid)", HierarchyID{}).Scan(&root)
+	require.NoError(t, err)
+	assert.Equal(t, "/", root.String())
+}
@@ -2,8 +2,11 @@ package msdsn
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -67,6 +70,7 @@ const (
 	TrustServerCertificate = "trustservercertificate"
 	Certificate            = "certificate"
 	ServerCertificate      = "servercertificate"
+	ServerPins             = "serverpins"
 	TLSMin                 = "tlsmin"
 	PacketSize             = "packet size"
 	LogParam               = "log"
@@ -89,6 +93,7 @@ const (
 	GuidConversion         = "guid conversion"
 	Timezone               = "timezone"
 	EpaEnabled             = "epa enabled"
+	DataClassification     = "dataclassification"
 )
 
 type EncodeParameters struct {
@@ -164,6 +169,9 @@ type Config struct {
 	Encoding EncodeParameters
 	// EPA mode determines how the Channel Bindings are calculated.
 	EpaEnabled bool
+	// DataClassification requests the sensitivity classification of the
+	// columns of result sets.
+	DataClassification bool
 }
 
 func readDERFile(filename string) ([]byte, error) {
@@ -332,6 +340,18 @@ func parseTLS(params map[string]string, host string) (Encryption, *tls.Config, e
 		}
 	}
 
+	var pins [][sha256.Size]byte
+	if serverPins, ok := params[ServerPins]; ok {
+		if encryption == EncryptionDisabled {
+			return encryption, nil, errors.New("cannot specify 'serverpins' when encryption is disabled")
+		}
+		var err error
+		pins, err = parseServerPins(serverPins)
+		if err != nil {
+			return encryption, nil, err
+		}
+	}
+
 	if encryption != EncryptionDisabled {
 		tlsMin := params[TLSMin]
 		if encrypt == "strict" {
@@ -341,11 +361,90 @@ func parseTLS(params map[string]string, host string) (Encryption, *tls.Config, e
 		if err != nil {
 			return encryption, nil, fmt.Errorf("failed to setup TLS: %w", err)
 		}
+		if len(pins) > 0 {
+			setupTLSServerPins(tlsConfig, pins)
+		}
 		return encryption, tlsConfig, nil
 	}
 	return encryption, nil, nil
 }
 
+// parseServerPins parses a comma separated list of SHA-256 hashes of
+// certificate SubjectPublicKeyInfo structures. Each pin is base64 or hex
+// encoded and may carry the "sha256/" prefix used by HTTP public key pinning.
+func parseServerPins(value string) ([][sha256.Size]byte, error) {
+	var pins [][sha256.Size]byte
+	for _, pin := range strings.Split(value, ",") {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		encoded := pin
+		if len(encoded) > len("sha256/") && strings.EqualFold(encoded[:len("sha256/")], "sha256/") {
+			encoded = encoded[len("sha256/"):]
+		}
+		var raw []byte
+		var err error
+		if len(encoded) == hex.EncodedLen(sha256.Size) {
+			raw, err = hex.DecodeString(encoded)
+		} else {
+			raw, err = base64.StdEncoding.DecodeString(encoded)
+		}
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid server pin '%s': expected a base64 or hex encoded SHA-256 hash", pin)
+		}
+		var p [sha256.Size]byte
+		copy(p[:], raw)
+		pins = append(pins, p)
+	}
+	if len(pins) == 0 {
+		return nil, errors.New("serverpins parameter must contain at least one pin")
+	}
+	return pins, nil
+}
+
+// setupTLSServerPins requires a certificate presented by the server to have
+// a public key matching one of pins. When the certificate chain is verified,
+// any certificate of a verified chain may match, which allows pinning an
+// intermediate or root CA; otherwise only the leaf certificate may. The pin
+// check is in addition to any verification
+// already configured.
+func setupTLSServerPins(config *tls.Config, pins [][sha256.Size]byte) {
+	verify := config.VerifyPeerCertificate
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if verify != nil {
+			if err := verify(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		var certs []*x509.Certificate
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(verifiedChains) == 0 {
+			// Without verification the other certificates prove nothing:
+			// anyone can append the real server's certificate to their own.
+			if len(rawCerts) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("cannot parse server certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+		for _, cert := range certs {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if hash == pin {
+					return nil
+				}
+			}
+		}
+		return errors.New("server certificate public key does not match any of the configured server pins")
+	}
+}
+
 var skipSetup = errors.New("skip setting up TLS")
 
 func getDsnType(dsn string) int {
@@ -642,6 +741,14 @@ func Parse(dsn string) (Config, error) {
 		p.Encoding.GuidConversion = false
 	}
 
+	if dc, ok := params[DataClassification]; ok {
+		var err error
+		p.DataClassification, err = strconv.ParseBool(dc)
+		if err != nil {
+			return p, fmt.Errorf("invalid dataclassification '%s': %v", dc, err)
+		}
+	}
+
 	p.EpaEnabled = false
 	epaString, ok := params[EpaEnabled]
 	if !ok {
@@ -716,6 +823,10 @@ func (p Config) URL() *url.URL {
 		q.Add("columnencryption", "true")
 	}
 
+	if p.DataClassification {
+		q.Add(DataClassification, "true")
+	}
+
 	if p.Encoding.GuidConversion {
 		q.Add(GuidConversion, strconv.FormatBool(p.Encoding.GuidConversion))
 	}
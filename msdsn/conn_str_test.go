@@ -28,6 +28,7 @@ func TestInvalidConnectionString(t *testing.T) {
 		"multisubnetfailover=invalid",
 		"timezone=invalid",
 		"epa enabled=invalid",
+		"dataclassification=invalid",
 
 		// ODBC mode
 		"odbc:password={",
@@ -117,6 +118,8 @@ func TestValidConnectionString(t *testing.T) {
 		{"epa enabled=0", func(p Config) bool { return !p.EpaEnabled }},
 		{"server=test;epa enabled=true", func(p Config) bool { return p.Host == "test" && p.EpaEnabled }},
 		{"server=test;epa enabled=false", func(p Config) bool { return p.Host == "test" && !p.EpaEnabled }},
+		{"dataclassification=true", func(p Config) bool { return p.DataClassification }},
+		{"server=test", func(p Config) bool { return !p.DataClassification }},
 
 		// ADO connection string tests with double-quoted values containing semicolons
 		{"server=test;password=\"pass;word\"", func(p Config) bool { return p.Host == "test" && p.Password == "pass;word" }},
@@ -282,6 +285,26 @@ func TestConnParseRoundTripFixed(t *testing.T) {
 	}
 }
 
+func TestConnParseRoundTripDataClassification(t *testing.T) {
+	connStr := "sqlserver://sa:sa@localhost/sqlexpress?database=master&log=127&disableretry=true&dial+timeout=30&dataclassification=true"
+	params, err := Parse(connStr)
+	if err != nil {
+		t.Fatal("Test URL is not valid", err)
+	}
+	rtParams, err := Parse(params.URL().String())
+	if err != nil {
+		t.Fatal("Params after roundtrip are not valid", err)
+	}
+	if !rtParams.DataClassification {
+		t.Fatal("DataClassification was lost in roundtrip", params.URL().String())
+	}
+	params.ActivityID = nil
+	rtParams.ActivityID = nil
+	if !reflect.DeepEqual(params, rtParams) {
+		t.Fatal("Parameters do not match after roundtrip", params, rtParams)
+	}
+}
+
 func TestServerNameInTLSConfig(t *testing.T) {
 	var tests = []struct {
 		dsn          string
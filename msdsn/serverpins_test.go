@@ -0,0 +1,81 @@
+package msdsn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPinTestCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestParseServerPins(t *testing.T) {
+	hash := sha256.Sum256([]byte("spki"))
+	b64 := base64.StdEncoding.EncodeToString(hash[:])
+	hx := hex.EncodeToString(hash[:])
+
+	for _, value := range []string{b64, "sha256/" + b64, "SHA256/" + b64, hx, " " + hx + " ,"} {
+		pins, err := parseServerPins(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, [][sha256.Size]byte{hash}, pins, value)
+	}
+
+	pins, err := parseServerPins(b64 + "," + hx)
+	assert.NoError(t, err)
+	assert.Len(t, pins, 2)
+
+	for _, value := range []string{"", ",", "not-a-pin", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		_, err := parseServerPins(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestServerPinsConnectionString(t *testing.T) {
+	cert := newPinTestCertificate(t, "server")
+	other := newPinTestCertificate(t, "other")
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(hash[:])
+
+	config, err := Parse("server=somehost;encrypt=true;serverpins=" + pin)
+	require.NoError(t, err)
+	require.NotNil(t, config.TLSConfig.VerifyPeerCertificate)
+	verify := config.TLSConfig.VerifyPeerCertificate
+
+	assert.NoError(t, verify([][]byte{cert.Raw}, nil), "leaf matches pin")
+	assert.Error(t, verify([][]byte{other.Raw}, nil), "leaf does not match pin")
+	assert.Error(t, verify([][]byte{other.Raw, cert.Raw}, nil), "pinned certificate appended to an unverified chain")
+	assert.Error(t, verify(nil, nil), "no certificate")
+	assert.NoError(t, verify([][]byte{other.Raw}, [][]*x509.Certificate{{other, cert}}), "pinned certificate in verified chain")
+	assert.Error(t, verify([][]byte{cert.Raw}, [][]*x509.Certificate{{other}}), "only verified chains are checked when present")
+
+	_, err = Parse("server=somehost;encrypt=disable;serverpins=" + pin)
+	assert.ErrorContains(t, err, "encryption is disabled")
+
+	_, err = Parse("server=somehost;encrypt=true;serverpins=bogus")
+	assert.ErrorContains(t, err, "invalid server pin")
+}
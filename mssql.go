@@ -2,6 +2,8 @@ package mssql
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/binary"
@@ -13,6 +15,7 @@ import (
 	"net"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -140,6 +143,23 @@ func NewConnectorWithAccessTokenProvider(dsn string, tokenProvider func(ctx cont
 	)
 }
 
+// NewPasswordProviderConnector creates a new connector from a Config and a password provider.
+// The password provider is called for every new physical connection that uses
+// SQL Server authentication and its result replaces the password in the Config.
+// This allows short-lived credentials, such as cloud IAM authentication tokens,
+// to be supplied at connection time.
+// The returned connector may be used with sql.OpenDB.
+func NewPasswordProviderConnector(config msdsn.Config, passwordProvider func(ctx context.Context) (string, error)) (*Connector, error) {
+	if passwordProvider == nil {
+		return nil, errors.New("mssql: passwordProvider cannot be nil")
+	}
+
+	conn := NewConnectorConfig(config)
+	conn.passwordProvider = passwordProvider
+
+	return conn, nil
+}
+
 // NewConnectorConfig creates a new Connector for a DSN Config struct.
 // The returned connector may be used with sql.OpenDB.
 func NewConnectorConfig(config msdsn.Config) *Connector {
@@ -151,6 +171,7 @@ func newConnector(config msdsn.Config, driver *Driver) *Connector {
 		params:       config,
 		driver:       driver,
 		keyProviders: make(aecmk.ColumnEncryptionKeyProviderMap),
+		tokenCache:   newTokenCache(),
 	}
 }
 
@@ -173,6 +194,12 @@ type Connector struct {
 	// callback that can provide a security token during ADAL login
 	adalTokenProvider func(ctx context.Context, serverSPN, stsURL string) (string, error)
 
+	// callback that can provide the password for SQL Server authentication during login
+	passwordProvider func(ctx context.Context) (string, error)
+
+	// cache of tokens returned by securityTokenProvider and adalTokenProvider
+	tokenCache *tokenCache
+
 	// SessionInitSQL is executed after marking a given session to be reset.
 	// When not present, the next query will still reset the session to the
 	// database defaults.
@@ -202,6 +229,44 @@ type Connector struct {
 	// If Dialer is not set, normal net dialers are used.
 	Dialer Dialer
 
+	// VerifyServerCertificate, if not nil, is called during every TLS handshake
+	// with the server, for both TDS 8.0 strict encryption and TLS negotiated
+	// inside the TDS stream. It runs after the certificate checks configured in
+	// the connection string, including serverpins. host is the server the
+	// connection was made to, which differs from the connection string when
+	// the server routed the connection elsewhere. peerCertificates is the chain
+	// presented by the server and verifiedChains is empty when chain
+	// verification is skipped, such as with TrustServerCertificate.
+	// Returning an error aborts the connection.
+	VerifyServerCertificate func(host string, peerCertificates []*x509.Certificate, verifiedChains [][]*x509.Certificate) error
+
+	// TLSSessionCacheSize is the number of TLS sessions kept for resumption by
+	// the connections of this connector. Resuming a session skips the full TLS
+	// handshake when opening new connections to a server already connected to.
+	// Defaults to 64. Changes have no effect after the first connection.
+	TLSSessionCacheSize int
+
+	// DisableTLSSessionResumption turns off the connector's TLS session cache so
+	// every connection performs a full TLS handshake.
+	DisableTLSSessionResumption bool
+
+	// DescribeParameters declares the parameters of queries with the types
+	// suggested by sp_describe_undeclared_parameters instead of the types
+	// inferred from their Go values, so that, for example, a string compared
+	// with a varchar column is sent as varchar and can use its index. The
+	// server is asked once per query text, current database and types of
+	// the explicitly typed parameters, and the answer is cached in the
+	// connector. Parameters with an explicit type, such as TypedParam or
+	// VarChar, keep it, and values that do not convert to the suggested type
+	// without loss are sent as usual. Stored procedure calls are not affected.
+	DescribeParameters bool
+
+	sessionCacheOnce sync.Once
+	sessionCache     tls.ClientSessionCache
+
+	paramTypes     paramTypeCache
+	typeConverters typeConverters
+
 	keyProviders aecmk.ColumnEncryptionKeyProviderMap
 }
 
@@ -452,6 +517,9 @@ type Stmt struct {
 	paramCount     int
 	notifSub       *queryNotifSub
 	skipEncryption bool
+	// paramTypes holds the types sp_describe_undeclared_parameters
+	// suggested for the parameters of the query, by name.
+	paramTypes map[string]string
 }
 
 type queryNotifSub struct {
@@ -475,7 +543,7 @@ func (c *Conn) prepareContext(ctx context.Context, query string) (*Stmt, error)
 	if c.processQueryText {
 		query, paramCount = querytext.ParseParams(query)
 	}
-	return &Stmt{c, query, paramCount, nil, false}, nil
+	return &Stmt{c, query, paramCount, nil, false, nil}, nil
 }
 
 func (s *Stmt) Close() error {
@@ -648,9 +716,15 @@ func (s *Stmt) makeRPCParams(args []namedValue, isProc bool) ([]param, []string,
 	params := make([]param, len(args)+offset)
 	decls := make([]string, len(args))
 	for i, val := range args {
-		params[i+offset], err = s.makeParam(val.Value)
-		if err != nil {
-			return nil, nil, err
+		var described bool
+		if typeDecl := s.paramTypes[paramName(val)]; typeDecl != "" && !hasExplicitType(val.Value) {
+			params[i+offset], described = s.makeDescribedParam(val.Value, typeDecl)
+		}
+		if !described {
+			params[i+offset], err = s.makeParam(val.Value)
+			if err != nil {
+				return nil, nil, err
+			}
 		}
 		var name string
 		if len(val.Name) > 0 {
@@ -723,6 +797,11 @@ func (s *Stmt) queryContext(ctx context.Context, args []namedValue) (rows driver
 	if !s.c.connectionGood {
 		return nil, driver.ErrBadConn
 	}
+	if s.describeParameters() && len(args) > 0 {
+		if err = s.describeArgs(ctx, args); err != nil {
+			return nil, err
+		}
+	}
 	if s.doEncryption() && len(args) > 0 {
 		args, err = s.encryptArgs(ctx, args)
 	}
@@ -796,6 +875,11 @@ func (s *Stmt) exec(ctx context.Context, args []namedValue) (res driver.Result,
 	if !s.c.connectionGood {
 		return nil, driver.ErrBadConn
 	}
+	if s.describeParameters() && len(args) > 0 {
+		if err = s.describeArgs(ctx, args); err != nil {
+			return nil, err
+		}
+	}
 	if s.doEncryption() && len(args) > 0 {
 		args, err = s.encryptArgs(ctx, args)
 	}
@@ -1008,6 +1092,8 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 		}
 	case UniqueIdentifier:
 	case NullUniqueIdentifier:
+	case BigRat, BigInt, decimalTexter:
+		// Sent as decimal rather than as the string from their Value.
 	default:
 		break
 	case driver.Valuer:
@@ -1163,6 +1249,8 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 		} else {
 			res.ti.TypeId = typeDateTimeN
 		}
+	case BigRat, BigInt, decimalTexter:
+		return makeBigNumParam(val)
 	case driver.Valuer:
 		// We have a custom Valuer implementation with a nil value
 		return s.makeParam(nil)
@@ -1188,7 +1276,7 @@ func (c *Conn) Ping(ctx context.Context) error {
 	if !c.connectionGood {
 		return driver.ErrBadConn
 	}
-	stmt := &Stmt{c, `select 1;`, 0, nil, true}
+	stmt := &Stmt{c, `select 1;`, 0, nil, true, nil}
 	_, err := stmt.ExecContext(ctx, nil)
 	return err
 }
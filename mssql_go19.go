@@ -9,13 +9,13 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
 	"time"
 
 	"github.com/golang-sql/sqlexp"
 	"github.com/shopspring/decimal"
 
-	// "github.com/cockroachdb/apd"
 	"github.com/golang-sql/civil"
 )
 
@@ -73,8 +73,12 @@ func convertInputParameter(val interface{}) (interface{}, error) {
 		return val, nil
 	case civil.Time:
 		return val, nil
-	// case *apd.Decimal:
-	// 	return nil
+	case Variant:
+		return val, nil
+	case TypedParam:
+		return val, nil
+	case *big.Rat, *big.Int, BigRat, BigInt, decimalTexter:
+		return val, nil
 	case float32:
 		return val, nil
 	case driver.Valuer:
@@ -141,6 +145,9 @@ func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
 		return driver.ErrRemoveArgument
 	default:
 		var err error
+		if nv.Value, err = c.convertParam(nv.Value); err != nil {
+			return err
+		}
 		nv.Value, err = convertInputParameter(nv.Value)
 		return err
 	}
@@ -219,6 +226,12 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 			res, err = s.makeParam(dest)
 		}
 		res.Flags = fByRevValue
+	case Variant:
+		res, err = makeVariantParam(s.c, val)
+	case TypedParam:
+		res, err = makeTypedParam(s.c, val)
+	case *big.Rat, *big.Int:
+		res, err = makeBigNumParam(val)
 	case TVP:
 		err = val.check()
 		if err != nil {
@@ -0,0 +1,230 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ParallelBulkOptions configures a ParallelBulk.
+type ParallelBulkOptions struct {
+	// BulkOptions are the options of each stream. Tablock lets the streams
+	// of a heap load concurrently with bulk update locks; on a table with a
+	// clustered index it makes them wait on each other. Notify is called by
+	// each stream with its own row count.
+	BulkOptions
+	// Connections is the number of connections copying rows. It defaults
+	// to 4.
+	Connections int
+	// PartitionKey returns the key of a row. Rows with the same key are
+	// copied by the same connection, which keeps the rows of a partition of
+	// a partitioned table in one stream. When nil, rows are distributed
+	// round-robin.
+	PartitionKey func(row []interface{}) int
+	// StagingTable makes the load all or nothing. Rows are copied to this
+	// table, which must have the copied columns, and only once every stream
+	// succeeded they are inserted into the destination table in a
+	// transaction. The staging table is truncated before the load, after it
+	// and when it fails, leaving the destination table unchanged.
+	StagingTable string
+	// ReplaceDestination replaces the rows of the destination table with
+	// those of StagingTable, which must then have the same structure as the
+	// destination table, with ALTER TABLE SWITCH instead of inserting them.
+	// Every row the destination table held before the load is deleted.
+	ReplaceDestination bool
+}
+
+const defaultParallelBulkConnections = 4
+
+// ParallelBulk copies rows to a table over several connections at once.
+// AddRow is not safe for concurrent use.
+type ParallelBulk struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	table   string
+	columns []string
+	opts    ParallelBulkOptions
+
+	conns  []*Conn
+	rows   []chan []interface{}
+	next   int
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	errs   []error
+	copied int64
+	done   bool
+}
+
+// CreateParallelBulk opens the connections of a parallel bulk copy of the
+// given columns to table.
+func (c *Connector) CreateParallelBulk(ctx context.Context, table string, columns []string, opts ParallelBulkOptions) (_ *ParallelBulk, err error) {
+	n := opts.Connections
+	if n <= 0 {
+		n = defaultParallelBulkConnections
+	}
+	if opts.ReplaceDestination && opts.StagingTable == "" {
+		return nil, errors.New("mssql: ReplaceDestination needs a StagingTable")
+	}
+	p := &ParallelBulk{table: table, columns: columns, opts: opts}
+	p.ctx, p.cancel = context.WithCancelCause(ctx)
+	defer func() {
+		if err != nil {
+			p.close()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		conn, err := c.driver.connect(p.ctx, c, c.params)
+		if err != nil {
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	if opts.StagingTable != "" {
+		if err = p.exec(p.ctx, fmt.Sprintf("TRUNCATE TABLE %s", opts.StagingTable)); err != nil {
+			return nil, err
+		}
+		table = opts.StagingTable
+	}
+
+	p.rows = make([]chan []interface{}, n)
+	for i, conn := range p.conns {
+		b := conn.CreateBulkContext(p.ctx, table, columns)
+		b.Options = opts.BulkOptions
+		p.rows[i] = make(chan []interface{}, 256)
+		p.wg.Add(1)
+		go p.stream(b, p.rows[i])
+	}
+	return p, nil
+}
+
+// stream copies the rows of a channel with one Bulk. After a failure the
+// other streams are cancelled and the remaining rows are discarded.
+func (p *ParallelBulk) stream(b *Bulk, rows chan []interface{}) {
+	defer p.wg.Done()
+	var err error
+	for row := range rows {
+		if err == nil {
+			err = b.AddRowContext(p.ctx, row)
+		}
+	}
+	rowCount, doneErr := b.DoneContext(p.ctx)
+	if err == nil {
+		err = doneErr
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.copied += rowCount
+	if err != nil {
+		// Streams cancelled because of another failure only report it.
+		if !errors.Is(err, context.Canceled) || context.Cause(p.ctx) == context.Canceled {
+			p.errs = append(p.errs, err)
+		}
+		p.cancel(err)
+	}
+}
+
+// AddRow queues a row for one of the connections. The row must not be
+// modified afterwards. It returns the error of a failed stream, after which
+// the copy is cancelled.
+func (p *ParallelBulk) AddRow(row []interface{}) error {
+	if p.done {
+		return errParallelBulkDone
+	}
+	i := p.next
+	if p.opts.PartitionKey != nil {
+		i = p.opts.PartitionKey(row) % len(p.rows)
+		if i < 0 {
+			i += len(p.rows)
+		}
+	} else {
+		p.next = (p.next + 1) % len(p.rows)
+	}
+	select {
+	case p.rows[i] <- row:
+		return nil
+	case <-p.ctx.Done():
+		return context.Cause(p.ctx)
+	}
+}
+
+var errParallelBulkDone = errors.New("mssql: ParallelBulk is already done")
+
+// Done waits for the streams to end and closes the connections. It returns
+// the number of rows copied and the errors of the failed streams. With a
+// staging table the rows are copied only when no stream failed. Later calls
+// of Done and AddRow return an error.
+func (p *ParallelBulk) Done() (rowcount int64, err error) {
+	if p.done {
+		return 0, errParallelBulkDone
+	}
+	p.done = true
+	for _, rows := range p.rows {
+		close(rows)
+	}
+	p.wg.Wait()
+	defer p.close()
+
+	err = errors.Join(p.errs...)
+	if p.opts.StagingTable == "" {
+		return p.copied, err
+	}
+	// The staging table is cleaned up even when the copy was cancelled.
+	ctx := context.WithoutCancel(p.ctx)
+	if err == nil {
+		err = p.exec(ctx, stagingMoveQuery(p.table, p.opts.StagingTable, p.columns, p.opts))
+	}
+	if err != nil {
+		if truncErr := p.exec(ctx, fmt.Sprintf("TRUNCATE TABLE %s", p.opts.StagingTable)); truncErr != nil {
+			err = errors.Join(err, truncErr)
+		}
+		return 0, err
+	}
+	return p.copied, nil
+}
+
+// stagingMoveQuery returns the batch moving the rows of staging to table in
+// a transaction.
+func stagingMoveQuery(table, staging string, columns []string, opts ParallelBulkOptions) string {
+	var w strings.Builder
+	w.WriteString("SET XACT_ABORT ON;\nBEGIN TRANSACTION;\n")
+	if opts.ReplaceDestination {
+		fmt.Fprintf(&w, "TRUNCATE TABLE %s;\nALTER TABLE %s SWITCH TO %s;\n", table, staging, table)
+	} else {
+		q := TSQLQuoter{}
+		names := make([]string, len(columns))
+		for i, col := range columns {
+			names[i] = q.ID(col)
+		}
+		list := strings.Join(names, ", ")
+		if opts.KeepIdentity {
+			fmt.Fprintf(&w, "SET IDENTITY_INSERT %s ON;\n", table)
+		}
+		fmt.Fprintf(&w, "INSERT INTO %s (%s) SELECT %s FROM %s;\n", table, list, list, staging)
+		if opts.KeepIdentity {
+			fmt.Fprintf(&w, "SET IDENTITY_INSERT %s OFF;\n", table)
+		}
+		fmt.Fprintf(&w, "TRUNCATE TABLE %s;\n", staging)
+	}
+	w.WriteString("COMMIT TRANSACTION;")
+	return w.String()
+}
+
+// exec runs a statement on the first connection.
+func (p *ParallelBulk) exec(ctx context.Context, query string) error {
+	stmt, err := p.conns[0].prepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, nil)
+	return err
+}
+
+func (p *ParallelBulk) close() {
+	p.cancel(nil)
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+}
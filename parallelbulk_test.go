@@ -0,0 +1,154 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelBulkAddRow(t *testing.T) {
+	newBulk := func(opts ParallelBulkOptions) *ParallelBulk {
+		p := &ParallelBulk{opts: opts, rows: make([]chan []interface{}, 3)}
+		p.ctx, p.cancel = context.WithCancelCause(context.Background())
+		for i := range p.rows {
+			p.rows[i] = make(chan []interface{}, 10)
+		}
+		return p
+	}
+
+	p := newBulk(ParallelBulkOptions{})
+	for i := 0; i < 4; i++ {
+		require.NoError(t, p.AddRow([]interface{}{i}))
+	}
+	assert.Equal(t, []int{2, 1, 1}, []int{len(p.rows[0]), len(p.rows[1]), len(p.rows[2])}, "round-robin")
+
+	p = newBulk(ParallelBulkOptions{PartitionKey: func(row []interface{}) int { return row[0].(int) }})
+	for _, key := range []int{4, 7, -2, 2} {
+		require.NoError(t, p.AddRow([]interface{}{key}))
+	}
+	assert.Equal(t, []int{0, 3, 1}, []int{len(p.rows[0]), len(p.rows[1]), len(p.rows[2])}, "by key")
+
+	p = newBulk(ParallelBulkOptions{})
+	failure := errors.New("stream failed")
+	p.cancel(failure)
+	for i := 0; i < 30; i++ {
+		if err := p.AddRow([]interface{}{i}); err != nil {
+			assert.Equal(t, failure, err)
+			return
+		}
+	}
+	t.Fatal("AddRow did not return the stream failure")
+}
+
+func TestParallelBulkDoneTwice(t *testing.T) {
+	p := &ParallelBulk{rows: []chan []interface{}{make(chan []interface{}, 1)}, copied: 3}
+	p.ctx, p.cancel = context.WithCancelCause(context.Background())
+	rows, err := p.Done()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rows)
+
+	_, err = p.Done()
+	assert.EqualError(t, err, "mssql: ParallelBulk is already done")
+	assert.EqualError(t, p.AddRow([]interface{}{1}), "mssql: ParallelBulk is already done")
+}
+
+func TestStagingMoveQuery(t *testing.T) {
+	columns := []string{"id", "na]me"}
+	assert.Equal(t, `SET XACT_ABORT ON;
+BEGIN TRANSACTION;
+INSERT INTO dbo.t ([id], [na]]me]) SELECT [id], [na]]me] FROM dbo.s;
+TRUNCATE TABLE dbo.s;
+COMMIT TRANSACTION;`, stagingMoveQuery("dbo.t", "dbo.s", columns, ParallelBulkOptions{}))
+
+	query := stagingMoveQuery("dbo.t", "dbo.s", columns, ParallelBulkOptions{BulkOptions: BulkOptions{KeepIdentity: true}})
+	assert.Contains(t, query, "SET IDENTITY_INSERT dbo.t ON;\nINSERT INTO dbo.t")
+	assert.Contains(t, query, "SET IDENTITY_INSERT dbo.t OFF;\n")
+
+	query = stagingMoveQuery("dbo.t", "dbo.s", columns, ParallelBulkOptions{ReplaceDestination: true})
+	assert.Equal(t, `SET XACT_ABORT ON;
+BEGIN TRANSACTION;
+TRUNCATE TABLE dbo.t;
+ALTER TABLE dbo.s SWITCH TO dbo.t;
+COMMIT TRANSACTION;`, query)
+}
+
+func TestParallelBulk(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	ctx := testContext(t)
+
+	// The tables must be visible to all the connections.
+	table := fmt.Sprintf("parallel_bulk_%d", time.Now().UnixNano())
+	staging := table + "_staging"
+	for _, name := range []string{table, staging} {
+		_, err = db.ExecContext(ctx, "CREATE TABLE "+name+" (id INT NOT NULL PRIMARY KEY, name NVARCHAR(20))")
+		require.NoError(t, err)
+		defer db.Exec("DROP TABLE " + name)
+	}
+	_, err = db.ExecContext(ctx, "INSERT INTO "+table+" VALUES (-1, 'old')")
+	require.NoError(t, err)
+
+	load := func(ids []int, replace bool) (int64, error) {
+		p, err := connector.CreateParallelBulk(ctx, table, []string{"id", "name"}, ParallelBulkOptions{
+			Connections:        3,
+			StagingTable:       staging,
+			ReplaceDestination: replace,
+		})
+		require.NoError(t, err)
+		for _, id := range ids {
+			if err := p.AddRow([]interface{}{id, fmt.Sprint("row ", id)}); err != nil {
+				break
+			}
+		}
+		return p.Done()
+	}
+
+	// A duplicate key fails one stream, so nothing is copied.
+	rows, err := load([]int{1, 2, 3, 1}, false)
+	assert.Error(t, err)
+	assert.Equal(t, int64(0), rows)
+	var names []string
+	queryNames := func() {
+		names = nil
+		r, err := db.QueryContext(ctx, "SELECT name FROM "+table+" ORDER BY id")
+		require.NoError(t, err)
+		defer r.Close()
+		for r.Next() {
+			var name string
+			require.NoError(t, r.Scan(&name))
+			names = append(names, name)
+		}
+	}
+	queryNames()
+	assert.Equal(t, []string{"old"}, names)
+
+	ids := make([]int, 100)
+	for i := range ids {
+		ids[i] = i
+	}
+	rows, err = load(ids, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), rows)
+	queryNames()
+	assert.Len(t, names, 101, "the rows are added to the table")
+	assert.Equal(t, []string{"old", "row 0"}, names[:2])
+
+	rows, err = load(ids[:10], true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), rows)
+	queryNames()
+	assert.Len(t, names, 10, "the rows of the table are replaced")
+	assert.Equal(t, "row 0", names[0])
+}
@@ -0,0 +1,333 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+)
+
+const (
+	// defaultGeographySRID is the SRID used for geography values parsed
+	// without one, WGS 84.
+	defaultGeographySRID = 4326
+)
+
+// Shape is a spatial value held by a Geometry or Geography. It is one of
+// Point, LineString, Polygon, MultiPoint, MultiLineString, MultiPolygon or
+// GeometryCollection.
+type Shape interface {
+	// openGISType returns the type of the shape as stored by SQL Server.
+	openGISType() spatialType
+	isEmpty() bool
+}
+
+// Point is a single position. For geography values X is the longitude and
+// Y the latitude. Z and M are NaN when the point has no elevation or measure,
+// and a point whose X and Y are NaN is empty.
+type Point struct {
+	X, Y, Z, M float64
+}
+
+// NewPoint returns a two dimensional point.
+func NewPoint(x, y float64) Point {
+	return Point{X: x, Y: y, Z: math.NaN(), M: math.NaN()}
+}
+
+// EmptyPoint returns a point without coordinates, POINT EMPTY.
+func EmptyPoint() Point {
+	return Point{X: math.NaN(), Y: math.NaN(), Z: math.NaN(), M: math.NaN()}
+}
+
+// IsEmpty reports whether p has no coordinates.
+func (p Point) IsEmpty() bool {
+	return math.IsNaN(p.X) && math.IsNaN(p.Y)
+}
+
+// LineString is a sequence of points joined by straight segments.
+type LineString []Point
+
+// Polygon is a list of rings. The first ring is the exterior ring and the
+// remaining rings are holes.
+type Polygon []LineString
+
+// MultiPoint is a collection of points.
+type MultiPoint []Point
+
+// MultiLineString is a collection of line strings.
+type MultiLineString []LineString
+
+// MultiPolygon is a collection of polygons.
+type MultiPolygon []Polygon
+
+// GeometryCollection is a collection of arbitrary shapes.
+type GeometryCollection []Shape
+
+// spatialType is the OpenGIS type of a shape in the SQL Server serialization.
+type spatialType byte
+
+const (
+	spatialPoint              spatialType = 1
+	spatialLineString         spatialType = 2
+	spatialPolygon            spatialType = 3
+	spatialMultiPoint         spatialType = 4
+	spatialMultiLineString    spatialType = 5
+	spatialMultiPolygon       spatialType = 6
+	spatialGeometryCollection spatialType = 7
+)
+
+func (p Point) openGISType() spatialType              { return spatialPoint }
+func (l LineString) openGISType() spatialType         { return spatialLineString }
+func (p Polygon) openGISType() spatialType            { return spatialPolygon }
+func (m MultiPoint) openGISType() spatialType         { return spatialMultiPoint }
+func (m MultiLineString) openGISType() spatialType    { return spatialMultiLineString }
+func (m MultiPolygon) openGISType() spatialType       { return spatialMultiPolygon }
+func (c GeometryCollection) openGISType() spatialType { return spatialGeometryCollection }
+
+func (p Point) isEmpty() bool              { return p.IsEmpty() }
+func (l LineString) isEmpty() bool         { return len(l) == 0 }
+func (p Polygon) isEmpty() bool            { return len(p) == 0 }
+func (m MultiPoint) isEmpty() bool         { return len(m) == 0 }
+func (m MultiLineString) isEmpty() bool    { return len(m) == 0 }
+func (m MultiPolygon) isEmpty() bool       { return len(m) == 0 }
+func (c GeometryCollection) isEmpty() bool { return len(c) == 0 }
+
+// Geometry is a value of the SQL Server geometry type, a shape in a flat
+// coordinate system.
+//
+// A Geometry can be scanned from a geometry column and used as a query or
+// bulk copy parameter; it is sent to the server in the SQL Server
+// serialization format, which SQL Server converts implicitly to geometry.
+// A nil Shape is treated as an empty GeometryCollection.
+type Geometry struct {
+	SRID  int32
+	Shape Shape
+}
+
+// Geography is a value of the SQL Server geography type, a shape on the
+// surface of the earth. Points hold the longitude in X and the latitude in Y.
+//
+// A Geography can be scanned from a geography column and used as a query or
+// bulk copy parameter in the same way as Geometry. A nil Shape is treated as
+// an empty GeometryCollection.
+type Geography struct {
+	SRID  int32
+	Shape Shape
+}
+
+// GeometryFromWKT parses Well-Known Text, such as "POINT (1 2)".
+func GeometryFromWKT(wkt string, srid int32) (Geometry, error) {
+	shape, err := parseWKT(wkt)
+	if err != nil {
+		return Geometry{}, err
+	}
+	return Geometry{SRID: srid, Shape: shape}, nil
+}
+
+// GeometryFromWKB parses Well-Known Binary.
+func GeometryFromWKB(wkb []byte, srid int32) (Geometry, error) {
+	shape, err := decodeWKB(wkb)
+	if err != nil {
+		return Geometry{}, err
+	}
+	return Geometry{SRID: srid, Shape: shape}, nil
+}
+
+// GeometryFromGeoJSON parses a GeoJSON geometry object.
+func GeometryFromGeoJSON(data []byte, srid int32) (Geometry, error) {
+	shape, err := decodeGeoJSON(data)
+	if err != nil {
+		return Geometry{}, err
+	}
+	return Geometry{SRID: srid, Shape: shape}, nil
+}
+
+// WKT returns the Well-Known Text of g in the form produced by SQL Server's
+// ToString method, which includes Z and M values.
+func (g Geometry) WKT() string {
+	return formatWKT(g.Shape)
+}
+
+// String returns the Well-Known Text of g.
+func (g Geometry) String() string {
+	return g.WKT()
+}
+
+// WKB returns the ISO Well-Known Binary of g in little-endian byte order.
+func (g Geometry) WKB() ([]byte, error) {
+	return encodeWKB(g.Shape)
+}
+
+// GeoJSON returns g as a GeoJSON geometry object. M values are dropped.
+func (g Geometry) GeoJSON() ([]byte, error) {
+	return encodeGeoJSON(g.Shape)
+}
+
+// MarshalBinary returns the SQL Server serialization of g.
+func (g Geometry) MarshalBinary() ([]byte, error) {
+	return encodeSpatial(g.SRID, g.Shape, false)
+}
+
+// UnmarshalBinary parses the SQL Server serialization of a geometry.
+func (g *Geometry) UnmarshalBinary(data []byte) error {
+	srid, shape, err := decodeSpatial(data, false)
+	if err != nil {
+		return err
+	}
+	*g = Geometry{SRID: srid, Shape: shape}
+	return nil
+}
+
+// Scan implements the sql.Scanner interface. It accepts the binary form
+// returned for geometry columns and Well-Known Text.
+func (g *Geometry) Scan(v interface{}) error {
+	switch vt := v.(type) {
+	case []byte:
+		return g.UnmarshalBinary(vt)
+	case string:
+		parsed, err := GeometryFromWKT(vt, 0)
+		if err != nil {
+			return err
+		}
+		*g = parsed
+		return nil
+	default:
+		return fmt.Errorf("mssql: cannot convert %T to Geometry", v)
+	}
+}
+
+// Value implements the driver.Valuer interface, returning the SQL Server
+// serialization of g.
+func (g Geometry) Value() (driver.Value, error) {
+	return g.MarshalBinary()
+}
+
+// GeographyFromWKT parses Well-Known Text, such as "POINT (-122.35 47.65)".
+// Coordinates are in longitude, latitude order.
+func GeographyFromWKT(wkt string, srid int32) (Geography, error) {
+	shape, err := parseWKT(wkt)
+	if err != nil {
+		return Geography{}, err
+	}
+	return Geography{SRID: srid, Shape: shape}, nil
+}
+
+// GeographyFromWKB parses Well-Known Binary. Coordinates are in longitude,
+// latitude order.
+func GeographyFromWKB(wkb []byte, srid int32) (Geography, error) {
+	shape, err := decodeWKB(wkb)
+	if err != nil {
+		return Geography{}, err
+	}
+	return Geography{SRID: srid, Shape: shape}, nil
+}
+
+// GeographyFromGeoJSON parses a GeoJSON geometry object.
+func GeographyFromGeoJSON(data []byte, srid int32) (Geography, error) {
+	shape, err := decodeGeoJSON(data)
+	if err != nil {
+		return Geography{}, err
+	}
+	return Geography{SRID: srid, Shape: shape}, nil
+}
+
+// WKT returns the Well-Known Text of g in the form produced by SQL Server's
+// ToString method, which includes Z and M values.
+func (g Geography) WKT() string {
+	return formatWKT(g.Shape)
+}
+
+// String returns the Well-Known Text of g.
+func (g Geography) String() string {
+	return g.WKT()
+}
+
+// WKB returns the ISO Well-Known Binary of g in little-endian byte order.
+func (g Geography) WKB() ([]byte, error) {
+	return encodeWKB(g.Shape)
+}
+
+// GeoJSON returns g as a GeoJSON geometry object. M values are dropped.
+func (g Geography) GeoJSON() ([]byte, error) {
+	return encodeGeoJSON(g.Shape)
+}
+
+// MarshalBinary returns the SQL Server serialization of g.
+func (g Geography) MarshalBinary() ([]byte, error) {
+	return encodeSpatial(g.SRID, g.Shape, true)
+}
+
+// UnmarshalBinary parses the SQL Server serialization of a geography.
+func (g *Geography) UnmarshalBinary(data []byte) error {
+	srid, shape, err := decodeSpatial(data, true)
+	if err != nil {
+		return err
+	}
+	*g = Geography{SRID: srid, Shape: shape}
+	return nil
+}
+
+// Scan implements the sql.Scanner interface. It accepts the binary form
+// returned for geography columns and Well-Known Text, which is assumed to
+// use SRID 4326.
+func (g *Geography) Scan(v interface{}) error {
+	switch vt := v.(type) {
+	case []byte:
+		return g.UnmarshalBinary(vt)
+	case string:
+		parsed, err := GeographyFromWKT(vt, defaultGeographySRID)
+		if err != nil {
+			return err
+		}
+		*g = parsed
+		return nil
+	default:
+		return fmt.Errorf("mssql: cannot convert %T to Geography", v)
+	}
+}
+
+// Value implements the driver.Valuer interface, returning the SQL Server
+// serialization of g.
+func (g Geography) Value() (driver.Value, error) {
+	return g.MarshalBinary()
+}
+
+// walkPoints calls fn for every point of s.
+func walkPoints(s Shape, fn func(Point)) {
+	switch s := s.(type) {
+	case Point:
+		fn(s)
+	case LineString:
+		for _, p := range s {
+			fn(p)
+		}
+	case MultiPoint:
+		for _, p := range s {
+			fn(p)
+		}
+	case Polygon:
+		for _, ring := range s {
+			walkPoints(ring, fn)
+		}
+	case MultiLineString:
+		for _, line := range s {
+			walkPoints(line, fn)
+		}
+	case MultiPolygon:
+		for _, polygon := range s {
+			walkPoints(polygon, fn)
+		}
+	case GeometryCollection:
+		for _, child := range s {
+			walkPoints(child, fn)
+		}
+	}
+}
+
+// shapeDimensions reports whether any point of s has a Z or M value.
+func shapeDimensions(s Shape) (hasZ, hasM bool) {
+	walkPoints(s, func(p Point) {
+		hasZ = hasZ || !math.IsNaN(p.Z)
+		hasM = hasM || !math.IsNaN(p.M)
+	})
+	return
+}
@@ -0,0 +1,412 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SQL Server serialization of geometry and geography values
+// https://learn.microsoft.com/en-us/openspecs/sql_server_protocols/ms-ssclrt/
+
+const (
+	spatialFlagHasZ          = 0x01
+	spatialFlagHasM          = 0x02
+	spatialFlagIsValid       = 0x04
+	spatialFlagSinglePoint   = 0x08
+	spatialFlagSingleSegment = 0x10
+
+	// Figure attributes of version 1 serializations.
+	spatialFigureInteriorRing = 0x00
+	spatialFigureStroke       = 0x01
+	spatialFigureExteriorRing = 0x02
+	// Figure attributes of version 2 serializations that describe curves.
+	spatialFigureArc            = 0x02
+	spatialFigureCompositeCurve = 0x03
+)
+
+type spatialFigure struct {
+	attribute   byte
+	pointOffset int32
+}
+
+type spatialShape struct {
+	parentOffset int32
+	figureOffset int32
+	kind         spatialType
+}
+
+// spatialEncoder flattens a shape tree into the point, figure and shape
+// lists of the serialization format.
+type spatialEncoder struct {
+	points  []Point
+	figures []spatialFigure
+	shapes  []spatialShape
+}
+
+func (e *spatialEncoder) addFigure(attribute byte, points []Point) {
+	e.figures = append(e.figures, spatialFigure{attribute: attribute, pointOffset: int32(len(e.points))})
+	e.points = append(e.points, points...)
+}
+
+func (e *spatialEncoder) addShape(s Shape, parent int32) error {
+	index := int32(len(e.shapes))
+	e.shapes = append(e.shapes, spatialShape{parentOffset: parent, figureOffset: -1, kind: s.openGISType()})
+	firstFigure := int32(len(e.figures))
+	switch s := s.(type) {
+	case Point:
+		if !s.IsEmpty() {
+			e.addFigure(spatialFigureStroke, []Point{s})
+		}
+	case LineString:
+		if len(s) > 0 {
+			e.addFigure(spatialFigureStroke, s)
+		}
+	case Polygon:
+		for i, ring := range s {
+			attribute := byte(spatialFigureInteriorRing)
+			if i == 0 {
+				attribute = spatialFigureExteriorRing
+			}
+			e.addFigure(attribute, ring)
+		}
+	case MultiPoint:
+		for _, p := range s {
+			if err := e.addShape(p, index); err != nil {
+				return err
+			}
+		}
+	case MultiLineString:
+		for _, l := range s {
+			if err := e.addShape(l, index); err != nil {
+				return err
+			}
+		}
+	case MultiPolygon:
+		for _, p := range s {
+			if err := e.addShape(p, index); err != nil {
+				return err
+			}
+		}
+	case GeometryCollection:
+		for _, child := range s {
+			if child == nil {
+				return errors.New("mssql: nil shape in GeometryCollection")
+			}
+			if err := e.addShape(child, index); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("mssql: unsupported shape %T", s)
+	}
+	if int32(len(e.figures)) > firstFigure {
+		e.shapes[index].figureOffset = firstFigure
+	}
+	return nil
+}
+
+// encodeSpatial returns the version 1 serialization of shape. Geography
+// points are stored latitude first.
+func encodeSpatial(srid int32, shape Shape, geography bool) ([]byte, error) {
+	if shape == nil {
+		shape = GeometryCollection{}
+	}
+	var e spatialEncoder
+	if err := e.addShape(shape, -1); err != nil {
+		return nil, err
+	}
+	hasZ, hasM := shapeDimensions(shape)
+
+	// The valid flag is left cleared so that the server validates the
+	// shape, which is not checked here.
+	var flags byte
+	if hasZ {
+		flags |= spatialFlagHasZ
+	}
+	if hasM {
+		flags |= spatialFlagHasM
+	}
+	single := false
+	switch {
+	case len(e.shapes) == 1 && len(e.points) == 1 && e.shapes[0].kind == spatialPoint:
+		flags |= spatialFlagSinglePoint
+		single = true
+	case len(e.shapes) == 1 && len(e.points) == 2 && e.shapes[0].kind == spatialLineString:
+		flags |= spatialFlagSingleSegment
+		single = true
+	}
+
+	buf := make([]byte, 0, 6+len(e.points)*16)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(srid))
+	buf = append(buf, 1, flags)
+	if !single {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.points)))
+	}
+	for _, p := range e.points {
+		first, second := p.X, p.Y
+		if geography {
+			first, second = p.Y, p.X
+		}
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(first))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(second))
+	}
+	if hasZ {
+		for _, p := range e.points {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.Z))
+		}
+	}
+	if hasM {
+		for _, p := range e.points {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.M))
+		}
+	}
+	if single {
+		return buf, nil
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.figures)))
+	for _, f := range e.figures {
+		buf = append(buf, f.attribute)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(f.pointOffset))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.shapes)))
+	for _, s := range e.shapes {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(s.parentOffset))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(s.figureOffset))
+		buf = append(buf, byte(s.kind))
+	}
+	return buf, nil
+}
+
+var errSpatialTruncated = errors.New("mssql: truncated spatial value")
+
+type spatialReader struct {
+	buf []byte
+	err error
+}
+
+func (r *spatialReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = errSpatialTruncated
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *spatialReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *spatialReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *spatialReader) float64() float64 {
+	if b := r.next(8); b != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// count reads a list length and checks that at least size bytes per
+// element remain, so corrupt input cannot trigger huge allocations.
+func (r *spatialReader) count(size int) int {
+	n := r.uint32()
+	if r.err == nil && uint64(n)*uint64(size) > uint64(len(r.buf)) {
+		r.err = errSpatialTruncated
+	}
+	if r.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// decodeSpatial parses a version 1 or 2 serialization. Curves and full
+// globe values, which only exist in version 2, are not supported.
+func decodeSpatial(data []byte, geography bool) (int32, Shape, error) {
+	r := spatialReader{buf: data}
+	srid := int32(r.uint32())
+	version := r.byte()
+	flags := r.byte()
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+	if version != 1 && version != 2 {
+		return 0, nil, fmt.Errorf("mssql: unsupported spatial serialization version %d", version)
+	}
+
+	var numPoints int
+	switch {
+	case flags&spatialFlagSinglePoint != 0:
+		numPoints = 1
+	case flags&spatialFlagSingleSegment != 0:
+		numPoints = 2
+	default:
+		numPoints = r.count(16)
+	}
+	points := make([]Point, numPoints)
+	for i := range points {
+		first, second := r.float64(), r.float64()
+		if geography {
+			first, second = second, first
+		}
+		points[i] = Point{X: first, Y: second, Z: math.NaN(), M: math.NaN()}
+	}
+	if flags&spatialFlagHasZ != 0 {
+		for i := range points {
+			points[i].Z = r.float64()
+		}
+	}
+	if flags&spatialFlagHasM != 0 {
+		for i := range points {
+			points[i].M = r.float64()
+		}
+	}
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+	if flags&spatialFlagSinglePoint != 0 {
+		return srid, points[0], nil
+	}
+	if flags&spatialFlagSingleSegment != 0 {
+		return srid, LineString(points), nil
+	}
+
+	figures := make([]spatialFigure, r.count(5))
+	for i := range figures {
+		figures[i].attribute = r.byte()
+		figures[i].pointOffset = int32(r.uint32())
+		if version == 2 && (figures[i].attribute == spatialFigureArc || figures[i].attribute == spatialFigureCompositeCurve) {
+			return 0, nil, errors.New("mssql: curved spatial values are not supported")
+		}
+	}
+	shapes := make([]spatialShape, r.count(9))
+	for i := range shapes {
+		shapes[i].parentOffset = int32(r.uint32())
+		shapes[i].figureOffset = int32(r.uint32())
+		shapes[i].kind = spatialType(r.byte())
+	}
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+	if len(shapes) == 0 {
+		return 0, nil, errors.New("mssql: spatial value has no shapes")
+	}
+	d := spatialDecoder{points: points, figures: figures, shapes: shapes}
+	shape, err := d.shape(0)
+	if err != nil {
+		return 0, nil, err
+	}
+	return srid, shape, nil
+}
+
+type spatialDecoder struct {
+	points  []Point
+	figures []spatialFigure
+	shapes  []spatialShape
+}
+
+// figureRange returns the figures of the leaf shape at index, which extend
+// up to the first figure of the next shape that has any.
+func (d *spatialDecoder) figureRange(index int) (int, int, error) {
+	start := d.shapes[index].figureOffset
+	if start == -1 {
+		return 0, 0, nil
+	}
+	end := int32(len(d.figures))
+	for _, s := range d.shapes[index+1:] {
+		if s.figureOffset != -1 {
+			end = s.figureOffset
+			break
+		}
+	}
+	if start < 0 || start > end || end > int32(len(d.figures)) {
+		return 0, 0, errors.New("mssql: invalid spatial figure offset")
+	}
+	return int(start), int(end), nil
+}
+
+func (d *spatialDecoder) figurePoints(figure int) ([]Point, error) {
+	start := d.figures[figure].pointOffset
+	end := int32(len(d.points))
+	if figure+1 < len(d.figures) {
+		end = d.figures[figure+1].pointOffset
+	}
+	if start < 0 || start > end || end > int32(len(d.points)) {
+		return nil, errors.New("mssql: invalid spatial point offset")
+	}
+	return d.points[start:end], nil
+}
+
+func (d *spatialDecoder) children(index int) []int {
+	var children []int
+	for i := index + 1; i < len(d.shapes); i++ {
+		if d.shapes[i].parentOffset == int32(index) {
+			children = append(children, i)
+		}
+	}
+	return children
+}
+
+func (d *spatialDecoder) shape(index int) (Shape, error) {
+	s := d.shapes[index]
+	switch s.kind {
+	case spatialPoint, spatialLineString, spatialPolygon:
+		start, end, err := d.figureRange(index)
+		if err != nil {
+			return nil, err
+		}
+		var rings []LineString
+		for f := start; f < end; f++ {
+			points, err := d.figurePoints(f)
+			if err != nil {
+				return nil, err
+			}
+			rings = append(rings, LineString(points))
+		}
+		switch s.kind {
+		case spatialPoint:
+			if len(rings) == 0 {
+				return EmptyPoint(), nil
+			}
+			if len(rings) != 1 || len(rings[0]) != 1 {
+				return nil, errors.New("mssql: invalid spatial point")
+			}
+			return rings[0][0], nil
+		case spatialLineString:
+			if len(rings) == 0 {
+				return LineString{}, nil
+			}
+			if len(rings) != 1 {
+				return nil, errors.New("mssql: invalid spatial line string")
+			}
+			return rings[0], nil
+		default:
+			return Polygon(rings), nil
+		}
+	case spatialMultiPoint, spatialMultiLineString, spatialMultiPolygon, spatialGeometryCollection:
+		children := []Shape{}
+		for _, child := range d.children(index) {
+			c, err := d.shape(child)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, c)
+		}
+		return collectionOf(s.kind, children)
+	default:
+		return nil, fmt.Errorf("mssql: unsupported spatial shape type %d", s.kind)
+	}
+}
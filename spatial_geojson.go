@@ -0,0 +1,231 @@
+package mssql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var geoJSONTypeNames = map[spatialType]string{
+	spatialPoint:              "Point",
+	spatialLineString:         "LineString",
+	spatialPolygon:            "Polygon",
+	spatialMultiPoint:         "MultiPoint",
+	spatialMultiLineString:    "MultiLineString",
+	spatialMultiPolygon:       "MultiPolygon",
+	spatialGeometryCollection: "GeometryCollection",
+}
+
+type geoJSONGeometry struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates,omitempty"`
+	Geometries  []json.RawMessage `json:"geometries,omitempty"`
+}
+
+// encodeGeoJSON returns s as a GeoJSON geometry object. GeoJSON has no
+// measure so M values are dropped, and empty points are written with an
+// empty coordinate array.
+func encodeGeoJSON(s Shape) ([]byte, error) {
+	if s == nil {
+		s = GeometryCollection{}
+	}
+	if c, ok := s.(GeometryCollection); ok {
+		geometries := make([]json.RawMessage, len(c))
+		for i, child := range c {
+			if child == nil {
+				return nil, errors.New("mssql: nil shape in GeometryCollection")
+			}
+			var err error
+			if geometries[i], err = encodeGeoJSON(child); err != nil {
+				return nil, err
+			}
+		}
+		// Geometries must be present even when empty.
+		return json.Marshal(struct {
+			Type       string            `json:"type"`
+			Geometries []json.RawMessage `json:"geometries"`
+		}{"GeometryCollection", geometries})
+	}
+	coordinates, err := json.Marshal(geoJSONCoordinates(s))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}{geoJSONTypeNames[s.openGISType()], coordinates})
+}
+
+func geoJSONPosition(p Point) []float64 {
+	if p.IsEmpty() {
+		return []float64{}
+	}
+	if math.IsNaN(p.Z) {
+		return []float64{p.X, p.Y}
+	}
+	return []float64{p.X, p.Y, p.Z}
+}
+
+func geoJSONPositions(points []Point) [][]float64 {
+	positions := make([][]float64, len(points))
+	for i, p := range points {
+		positions[i] = geoJSONPosition(p)
+	}
+	return positions
+}
+
+func geoJSONCoordinates(s Shape) interface{} {
+	switch s := s.(type) {
+	case Point:
+		return geoJSONPosition(s)
+	case LineString:
+		return geoJSONPositions(s)
+	case MultiPoint:
+		return geoJSONPositions(s)
+	case Polygon:
+		rings := make([][][]float64, len(s))
+		for i, ring := range s {
+			rings[i] = geoJSONPositions(ring)
+		}
+		return rings
+	case MultiLineString:
+		lines := make([][][]float64, len(s))
+		for i, line := range s {
+			lines[i] = geoJSONPositions(line)
+		}
+		return lines
+	case MultiPolygon:
+		polygons := make([]interface{}, len(s))
+		for i, polygon := range s {
+			polygons[i] = geoJSONCoordinates(polygon)
+		}
+		return polygons
+	}
+	return nil
+}
+
+// decodeGeoJSON parses a GeoJSON geometry object.
+func decodeGeoJSON(data []byte) (Shape, error) {
+	return decodeGeoJSONDepth(data, 0)
+}
+
+func decodeGeoJSONDepth(data []byte, depth int) (Shape, error) {
+	if depth > maxWKBDepth {
+		return nil, errors.New("mssql: GeoJSON geometry is nested too deeply")
+	}
+	var g geoJSONGeometry
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("mssql: invalid GeoJSON: %v", err)
+	}
+	var kind spatialType
+	for k, name := range geoJSONTypeNames {
+		if g.Type == name {
+			kind = k
+		}
+	}
+	if kind == 0 {
+		return nil, fmt.Errorf("mssql: unsupported GeoJSON type %q", g.Type)
+	}
+	if kind == spatialGeometryCollection {
+		collection := GeometryCollection{}
+		for _, child := range g.Geometries {
+			s, err := decodeGeoJSONDepth(child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			collection = append(collection, s)
+		}
+		return collection, nil
+	}
+	if g.Coordinates == nil {
+		return nil, fmt.Errorf("mssql: GeoJSON %s has no coordinates", g.Type)
+	}
+	var err error
+	var s Shape
+	switch kind {
+	case spatialPoint:
+		var position []float64
+		if err = json.Unmarshal(g.Coordinates, &position); err == nil {
+			s, err = geoJSONPoint(position)
+		}
+	case spatialLineString, spatialMultiPoint:
+		var positions [][]float64
+		if err = json.Unmarshal(g.Coordinates, &positions); err == nil {
+			var points []Point
+			if points, err = geoJSONPoints(positions); err == nil {
+				if kind == spatialLineString {
+					s = LineString(points)
+				} else {
+					s = MultiPoint(points)
+				}
+			}
+		}
+	case spatialPolygon, spatialMultiLineString:
+		var lists [][][]float64
+		if err = json.Unmarshal(g.Coordinates, &lists); err == nil {
+			var lines []LineString
+			if lines, err = geoJSONLines(lists); err == nil {
+				if kind == spatialPolygon {
+					s = Polygon(lines)
+				} else {
+					s = MultiLineString(lines)
+				}
+			}
+		}
+	case spatialMultiPolygon:
+		var polygons [][][][]float64
+		if err = json.Unmarshal(g.Coordinates, &polygons); err == nil {
+			m := make(MultiPolygon, len(polygons))
+			for i, polygon := range polygons {
+				var rings []LineString
+				if rings, err = geoJSONLines(polygon); err != nil {
+					break
+				}
+				m[i] = Polygon(rings)
+			}
+			s = m
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mssql: invalid GeoJSON %s: %v", g.Type, err)
+	}
+	return s, nil
+}
+
+func geoJSONPoint(position []float64) (Point, error) {
+	p := EmptyPoint()
+	switch len(position) {
+	case 0:
+	case 2:
+		p.X, p.Y = position[0], position[1]
+	case 3:
+		p.X, p.Y, p.Z = position[0], position[1], position[2]
+	default:
+		return Point{}, fmt.Errorf("a position must have 2 or 3 elements, found %d", len(position))
+	}
+	return p, nil
+}
+
+func geoJSONPoints(positions [][]float64) ([]Point, error) {
+	points := make([]Point, len(positions))
+	for i, position := range positions {
+		var err error
+		if points[i], err = geoJSONPoint(position); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func geoJSONLines(lists [][][]float64) ([]LineString, error) {
+	lines := make([]LineString, len(lists))
+	for i, positions := range lists {
+		points, err := geoJSONPoints(positions)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = points
+	}
+	return lines, nil
+}
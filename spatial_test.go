@@ -0,0 +1,301 @@
+package mssql
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestGeometrySerialization(t *testing.T) {
+	tests := []struct {
+		name string
+		wkt  string
+		srid int32
+		bin  string
+	}{
+		{"point", "POINT (1 2)", 0,
+			"00000000010c000000000000f03f0000000000000040"},
+		{"segment", "LINESTRING (0 0, 1 1)", 0,
+			"00000000011400000000000000000000000000000000000000000000f03f000000000000f03f"},
+		{"linestring", "LINESTRING (100 100, 20 180, 180 180)", 0,
+			"00000000010403000000000000000000594000000000000059400000000000003440000000000080664000000000008066400000000000806640" +
+				"01000000010000000001000000ffffffff0000000002"},
+		{"empty", "GEOMETRYCOLLECTION EMPTY", 4326,
+			"e61000000104000000000000000001000000ffffffffffffffff07"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := GeometryFromWKT(tt.wkt, tt.srid)
+			require.NoError(t, err)
+			bin, err := g.MarshalBinary()
+			require.NoError(t, err)
+			// The server marks the values it returns as valid, the driver
+			// leaves the validation to the server.
+			want := mustHex(t, tt.bin)
+			want[5] &^= spatialFlagIsValid
+			assert.Equal(t, hex.EncodeToString(want), hex.EncodeToString(bin))
+
+			var decoded Geometry
+			require.NoError(t, decoded.Scan(mustHex(t, tt.bin)))
+			assert.Equal(t, tt.srid, decoded.SRID)
+			assert.Equal(t, tt.wkt, decoded.String())
+		})
+	}
+}
+
+func TestGeographySerialization(t *testing.T) {
+	g, err := GeographyFromWKT("POINT (-122.35 47.65)", 4326)
+	require.NoError(t, err)
+	bin, err := g.MarshalBinary()
+	require.NoError(t, err)
+	// Geography points are stored latitude first.
+	assert.Equal(t, "e61000000108"+hexFloat(47.65)+hexFloat(-122.35), hex.EncodeToString(bin))
+
+	var decoded Geography
+	require.NoError(t, decoded.Scan(bin))
+	assert.Equal(t, int32(4326), decoded.SRID)
+	assert.Equal(t, "POINT (-122.35 47.65)", decoded.WKT())
+
+	require.NoError(t, decoded.Scan("LINESTRING (1 2, 3 4)"))
+	assert.Equal(t, int32(4326), decoded.SRID)
+}
+
+func TestSpatialFlags(t *testing.T) {
+	tests := []struct {
+		wkt   string
+		flags byte
+	}{
+		{"POINT (1 2)", spatialFlagSinglePoint},
+		{"POINT (1 2 3)", spatialFlagSinglePoint | spatialFlagHasZ},
+		{"LINESTRING (0 0, 1 1)", spatialFlagSingleSegment},
+		// A self-intersecting polygon is sent for the server to reject.
+		{"POLYGON ((0 0, 2 2, 2 0, 0 2, 0 0))", 0},
+	}
+	for _, tt := range tests {
+		g, err := GeometryFromWKT(tt.wkt, 0)
+		require.NoError(t, err)
+		bin, err := g.MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, tt.flags, bin[5], tt.wkt)
+	}
+}
+
+func hexFloat(v float64) string {
+	var g Geometry
+	g.Shape = NewPoint(v, 0)
+	bin, _ := g.MarshalBinary()
+	return hex.EncodeToString(bin[6:14])
+}
+
+var spatialRoundTripWKT = []string{
+	"POINT (1 2)",
+	"POINT (1.5 -2.25 3)",
+	"POINT (1 2 3 4)",
+	"POINT (1 2 NULL 4)",
+	"POINT EMPTY",
+	"LINESTRING EMPTY",
+	"LINESTRING (0 0, 1 1, 2 0)",
+	"LINESTRING (0 0 1, 1 1 2)",
+	"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 2 4, 4 4, 4 2, 2 2))",
+	"POLYGON EMPTY",
+	"MULTIPOINT ((1 2), (3 4))",
+	"MULTIPOINT EMPTY",
+	"MULTILINESTRING ((0 0, 1 1), (2 2, 3 3, 4 4))",
+	"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5), (5.1 5.1, 5.2 5.1, 5.2 5.2, 5.1 5.1)))",
+	"GEOMETRYCOLLECTION (POINT (1 2), LINESTRING (0 0, 1 1), POLYGON ((0 0, 1 0, 1 1, 0 0)))",
+	"GEOMETRYCOLLECTION (POINT EMPTY, MULTIPOINT ((1 1), (2 2)), GEOMETRYCOLLECTION (POINT (3 3)), LINESTRING (4 4, 5 5))",
+	"GEOMETRYCOLLECTION (MULTIPOLYGON EMPTY, POINT (1 1))",
+	"GEOMETRYCOLLECTION EMPTY",
+}
+
+func TestSpatialRoundTrip(t *testing.T) {
+	for _, wkt := range spatialRoundTripWKT {
+		t.Run(wkt, func(t *testing.T) {
+			g, err := GeometryFromWKT(wkt, 0)
+			require.NoError(t, err)
+			assert.Equal(t, wkt, g.WKT())
+
+			bin, err := g.MarshalBinary()
+			require.NoError(t, err)
+			var fromBinary Geometry
+			require.NoError(t, fromBinary.UnmarshalBinary(bin))
+			assert.Equal(t, wkt, fromBinary.WKT())
+
+			geography := Geography{SRID: 4326, Shape: g.Shape}
+			bin, err = geography.MarshalBinary()
+			require.NoError(t, err)
+			var fromGeography Geography
+			require.NoError(t, fromGeography.UnmarshalBinary(bin))
+			assert.Equal(t, wkt, fromGeography.WKT())
+
+			wkb, err := g.WKB()
+			require.NoError(t, err)
+			fromWKB, err := GeometryFromWKB(wkb, 0)
+			require.NoError(t, err)
+			assert.Equal(t, wkt, fromWKB.WKT())
+		})
+	}
+}
+
+func TestSpatialWKB(t *testing.T) {
+	g, err := GeometryFromWKT("POINT (1 2)", 0)
+	require.NoError(t, err)
+	wkb, err := g.WKB()
+	require.NoError(t, err)
+	assert.Equal(t, "0101000000000000000000f03f0000000000000040", hex.EncodeToString(wkb))
+
+	g, err = GeometryFromWKT("POINT Z (1 2 3)", 0)
+	require.NoError(t, err)
+	wkb, err = g.WKB()
+	require.NoError(t, err)
+	assert.Equal(t, "01e9030000000000000000f03f00000000000000400000000000000840", hex.EncodeToString(wkb))
+
+	// Big-endian extended WKB with an SRID, as written by PostGIS.
+	g, err = GeometryFromWKB(mustHex(t, "00a0000001000010e63ff000000000000040000000000000004008000000000000"), 4326)
+	require.NoError(t, err)
+	assert.Equal(t, "POINT (1 2 3)", g.WKT())
+
+	for _, bad := range []string{"", "02", "0101000000", "01ff000000", "0102000000ffffffff", "0101000000000000000000f03f000000000000004000"} {
+		_, err := GeometryFromWKB(mustHex(t, bad), 0)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSpatialWKT(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"point(1 2)", "POINT (1 2)"},
+		{"  POINT M (1 2 4) ", "POINT (1 2 NULL 4)"},
+		{"POINT ZM (1 2 3 4)", "POINT (1 2 3 4)"},
+		{"MULTIPOINT (1 2, 3 4)", "MULTIPOINT ((1 2), (3 4))"},
+		{"MULTIPOINT ((1 2), EMPTY)", "MULTIPOINT ((1 2), EMPTY)"},
+		{"LINESTRING(1e3 -2.5E-1,0 0)", "LINESTRING (1000 -0.25, 0 0)"},
+	}
+	for _, tt := range tests {
+		g, err := GeometryFromWKT(tt.in, 0)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.out, g.WKT())
+	}
+
+	for _, bad := range []string{"", "POINT", "POINT (1)", "POINT (1 2 3 4 5)", "POINT (NULL 2)", "POINT Z (1 2)",
+		"CIRCULARSTRING (0 0, 1 1, 2 0)", "POINT (1 2) x", "LINESTRING (1 2, 3 4", "POLYGON (1 2, 3 4)", "POINT (a b)"} {
+		_, err := GeometryFromWKT(bad, 0)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSpatialGeoJSON(t *testing.T) {
+	tests := []struct {
+		wkt     string
+		geojson string
+	}{
+		{"POINT (1 2)", `{"type":"Point","coordinates":[1,2]}`},
+		{"POINT (1 2 3)", `{"type":"Point","coordinates":[1,2,3]}`},
+		{"POINT EMPTY", `{"type":"Point","coordinates":[]}`},
+		{"LINESTRING (0 0, 1 1)", `{"type":"LineString","coordinates":[[0,0],[1,1]]}`},
+		{"POLYGON ((0 0, 1 0, 1 1, 0 0))", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`},
+		{"MULTIPOINT ((1 2), (3 4))", `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`},
+		{"MULTILINESTRING ((0 0, 1 1))", `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]]]}`},
+		{"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)))", `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]]]}`},
+		{"GEOMETRYCOLLECTION (POINT (1 2), LINESTRING (0 0, 1 1))",
+			`{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2]},{"type":"LineString","coordinates":[[0,0],[1,1]]}]}`},
+		{"GEOMETRYCOLLECTION EMPTY", `{"type":"GeometryCollection","geometries":[]}`},
+	}
+	for _, tt := range tests {
+		g, err := GeographyFromWKT(tt.wkt, 4326)
+		require.NoError(t, err, tt.wkt)
+		geojson, err := g.GeoJSON()
+		require.NoError(t, err, tt.wkt)
+		assert.JSONEq(t, tt.geojson, string(geojson))
+
+		decoded, err := GeographyFromGeoJSON([]byte(tt.geojson), 4326)
+		require.NoError(t, err, tt.geojson)
+		assert.Equal(t, tt.wkt, decoded.WKT())
+	}
+
+	// M values have no GeoJSON representation.
+	g, err := GeometryFromWKT("POINT (1 2 3 4)", 0)
+	require.NoError(t, err)
+	geojson, err := g.GeoJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"Point","coordinates":[1,2,3]}`, string(geojson))
+
+	for _, bad := range []string{``, `{}`, `{"type":"Feature"}`, `{"type":"Point"}`, `{"type":"Point","coordinates":[1]}`, `{"type":"LineString","coordinates":[1,2]}`} {
+		_, err := GeometryFromGeoJSON([]byte(bad), 0)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSpatialDecodeErrors(t *testing.T) {
+	var g Geometry
+	for _, bad := range []string{
+		"",
+		// Unknown serialization version.
+		"000000000304",
+		"00000000010c0000",
+		// Point count larger than the data.
+		"000000000104ffffff7f",
+		// Figure pointing past the points.
+		"00000000010401000000000000000000f03f0000000000000040" + "010000000105000000" + "01000000ffffffff0000000001",
+		// Unknown shape type.
+		"0000000001040000000000000000" + "01000000ffffffffffffffff0b",
+		// Version 2 arc figure.
+		"000000000204" + "03000000" +
+			"00000000000000000000000000000000" + "000000000000f03f000000000000f03f" + "00000000000000400000000000000000" +
+			"010000000200000000" + "01000000ffffffff0000000008",
+	} {
+		assert.Error(t, g.UnmarshalBinary(mustHex(t, bad)), bad)
+	}
+	assert.Error(t, g.Scan(1))
+}
+
+func TestSpatialPoint(t *testing.T) {
+	p := NewPoint(1, 2)
+	assert.False(t, p.IsEmpty())
+	assert.True(t, math.IsNaN(p.Z))
+	assert.True(t, EmptyPoint().IsEmpty())
+
+	var g Geometry
+	assert.Equal(t, "GEOMETRYCOLLECTION EMPTY", g.WKT())
+	_, err := Geometry{Shape: GeometryCollection{nil}}.MarshalBinary()
+	assert.Error(t, err)
+}
+
+func TestSpatialQuery(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	for _, wkt := range spatialRoundTripWKT {
+		t.Run(wkt, func(t *testing.T) {
+			g, err := GeometryFromWKT(wkt, 0)
+			require.NoError(t, err)
+			var text string
+			var scanned Geometry
+			err = conn.QueryRow("select cast(@p1 as geometry).ToString(), geometry::Parse(@p2)", g, wkt).Scan(&text, &scanned)
+			require.NoError(t, err)
+			assert.Equal(t, wkt, text)
+			assert.Equal(t, wkt, scanned.WKT())
+		})
+	}
+
+	g, err := GeographyFromWKT("LINESTRING (-122.36 47.656, -122.343 47.656)", 4326)
+	require.NoError(t, err)
+	var text string
+	var srid int32
+	err = conn.QueryRow("select cast(@p1 as geography).STAsText(), cast(@p1 as geography).STSrid", g).Scan(&text, &srid)
+	require.NoError(t, err)
+	assert.Equal(t, "LINESTRING (-122.36 47.656, -122.343 47.656)", text)
+	assert.Equal(t, int32(4326), srid)
+}
@@ -0,0 +1,327 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	wkbZ = 1000
+	wkbM = 2000
+
+	// Extended WKB, as written by PostGIS, flags dimensions in the high bits
+	// of the type instead.
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+// encodeWKB returns the ISO Well-Known Binary of s in little-endian byte order.
+func encodeWKB(s Shape) ([]byte, error) {
+	if s == nil {
+		s = GeometryCollection{}
+	}
+	hasZ, hasM := shapeDimensions(s)
+	w := wkbWriter{hasZ: hasZ, hasM: hasM}
+	if err := w.shape(s); err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+type wkbWriter struct {
+	buf        []byte
+	hasZ, hasM bool
+}
+
+func (w *wkbWriter) header(kind spatialType) {
+	code := uint32(kind)
+	if w.hasZ {
+		code += wkbZ
+	}
+	if w.hasM {
+		code += wkbM
+	}
+	w.buf = append(w.buf, 1)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, code)
+}
+
+func (w *wkbWriter) uint32(v int) {
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(v))
+}
+
+func (w *wkbWriter) point(p Point) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(p.X))
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(p.Y))
+	if w.hasZ {
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(p.Z))
+	}
+	if w.hasM {
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(p.M))
+	}
+}
+
+func (w *wkbWriter) points(points []Point) {
+	w.uint32(len(points))
+	for _, p := range points {
+		w.point(p)
+	}
+}
+
+func (w *wkbWriter) shape(s Shape) error {
+	w.header(s.openGISType())
+	switch s := s.(type) {
+	case Point:
+		// An empty point is written with NaN coordinates.
+		w.point(s)
+	case LineString:
+		w.points(s)
+	case Polygon:
+		w.uint32(len(s))
+		for _, ring := range s {
+			w.points(ring)
+		}
+	case MultiPoint:
+		w.uint32(len(s))
+		for _, p := range s {
+			if err := w.shape(p); err != nil {
+				return err
+			}
+		}
+	case MultiLineString:
+		w.uint32(len(s))
+		for _, l := range s {
+			if err := w.shape(l); err != nil {
+				return err
+			}
+		}
+	case MultiPolygon:
+		w.uint32(len(s))
+		for _, p := range s {
+			if err := w.shape(p); err != nil {
+				return err
+			}
+		}
+	case GeometryCollection:
+		w.uint32(len(s))
+		for _, child := range s {
+			if child == nil {
+				return errors.New("mssql: nil shape in GeometryCollection")
+			}
+			if err := w.shape(child); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("mssql: unsupported shape %T", s)
+	}
+	return nil
+}
+
+// decodeWKB parses ISO or extended Well-Known Binary in either byte order.
+// An SRID embedded in extended WKB is ignored.
+func decodeWKB(data []byte) (Shape, error) {
+	r := wkbReader{buf: data}
+	s, err := r.shape(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.buf) != 0 {
+		return nil, errors.New("mssql: trailing data after WKB geometry")
+	}
+	return s, nil
+}
+
+// maxWKBDepth bounds the nesting of geometry collections.
+const maxWKBDepth = 64
+
+type wkbReader struct {
+	buf   []byte
+	order binary.ByteOrder
+}
+
+func (r *wkbReader) next(n int) ([]byte, error) {
+	if len(r.buf) < n {
+		return nil, errors.New("mssql: truncated WKB")
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *wkbReader) uint32() (uint32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint32(b), nil
+}
+
+// count reads a list length and checks that at least size bytes per
+// element remain.
+func (r *wkbReader) count(size int) (int, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	if uint64(n)*uint64(size) > uint64(len(r.buf)) {
+		return 0, errors.New("mssql: truncated WKB")
+	}
+	return int(n), nil
+}
+
+func (r *wkbReader) point(hasZ, hasM bool) (Point, error) {
+	p := EmptyPoint()
+	coords := []*float64{&p.X, &p.Y}
+	if hasZ {
+		coords = append(coords, &p.Z)
+	}
+	if hasM {
+		coords = append(coords, &p.M)
+	}
+	for _, c := range coords {
+		b, err := r.next(8)
+		if err != nil {
+			return Point{}, err
+		}
+		*c = math.Float64frombits(r.order.Uint64(b))
+	}
+	return p, nil
+}
+
+func (r *wkbReader) points(hasZ, hasM bool) ([]Point, error) {
+	size := 16
+	if hasZ {
+		size += 8
+	}
+	if hasM {
+		size += 8
+	}
+	n, err := r.count(size)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]Point, n)
+	for i := range points {
+		if points[i], err = r.point(hasZ, hasM); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func (r *wkbReader) shape(depth int) (Shape, error) {
+	if depth > maxWKBDepth {
+		return nil, errors.New("mssql: WKB geometry is nested too deeply")
+	}
+	order, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	switch order[0] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("mssql: invalid WKB byte order %d", order[0])
+	}
+	code, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	hasZ := code&ewkbZ != 0
+	hasM := code&ewkbM != 0
+	if code&ewkbSRID != 0 {
+		if _, err := r.next(4); err != nil {
+			return nil, err
+		}
+	}
+	code &^= ewkbZ | ewkbM | ewkbSRID
+	switch code / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	}
+	kind := spatialType(code % 1000)
+
+	switch kind {
+	case spatialPoint:
+		return r.point(hasZ, hasM)
+	case spatialLineString:
+		points, err := r.points(hasZ, hasM)
+		return LineString(points), err
+	case spatialPolygon:
+		n, err := r.count(4)
+		if err != nil {
+			return nil, err
+		}
+		polygon := make(Polygon, n)
+		for i := range polygon {
+			ring, err := r.points(hasZ, hasM)
+			if err != nil {
+				return nil, err
+			}
+			polygon[i] = ring
+		}
+		return polygon, nil
+	case spatialMultiPoint, spatialMultiLineString, spatialMultiPolygon, spatialGeometryCollection:
+		n, err := r.count(5)
+		if err != nil {
+			return nil, err
+		}
+		children := make([]Shape, n)
+		for i := range children {
+			if children[i], err = r.shape(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return collectionOf(kind, children)
+	default:
+		return nil, fmt.Errorf("mssql: unsupported WKB geometry type %d", code)
+	}
+}
+
+// collectionOf builds the collection shape of the given kind from children,
+// checking that they have the expected type.
+func collectionOf(kind spatialType, children []Shape) (Shape, error) {
+	switch kind {
+	case spatialMultiPoint:
+		m := make(MultiPoint, len(children))
+		for i, c := range children {
+			p, ok := c.(Point)
+			if !ok {
+				return nil, fmt.Errorf("mssql: invalid %T in MultiPoint", c)
+			}
+			m[i] = p
+		}
+		return m, nil
+	case spatialMultiLineString:
+		m := make(MultiLineString, len(children))
+		for i, c := range children {
+			l, ok := c.(LineString)
+			if !ok {
+				return nil, fmt.Errorf("mssql: invalid %T in MultiLineString", c)
+			}
+			m[i] = l
+		}
+		return m, nil
+	case spatialMultiPolygon:
+		m := make(MultiPolygon, len(children))
+		for i, c := range children {
+			p, ok := c.(Polygon)
+			if !ok {
+				return nil, fmt.Errorf("mssql: invalid %T in MultiPolygon", c)
+			}
+			m[i] = p
+		}
+		return m, nil
+	default:
+		return GeometryCollection(children), nil
+	}
+}
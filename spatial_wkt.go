@@ -0,0 +1,377 @@
+package mssql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var spatialTypeNames = map[spatialType]string{
+	spatialPoint:              "POINT",
+	spatialLineString:         "LINESTRING",
+	spatialPolygon:            "POLYGON",
+	spatialMultiPoint:         "MULTIPOINT",
+	spatialMultiLineString:    "MULTILINESTRING",
+	spatialMultiPolygon:       "MULTIPOLYGON",
+	spatialGeometryCollection: "GEOMETRYCOLLECTION",
+}
+
+// formatWKT returns the Well-Known Text of s. As in SQL Server, a point with
+// an M value but no Z value is written with NULL in place of Z.
+func formatWKT(s Shape) string {
+	if s == nil {
+		s = GeometryCollection{}
+	}
+	var sb strings.Builder
+	writeWKTShape(&sb, s)
+	return sb.String()
+}
+
+func writeWKTShape(sb *strings.Builder, s Shape) {
+	sb.WriteString(spatialTypeNames[s.openGISType()])
+	if s.isEmpty() {
+		sb.WriteString(" EMPTY")
+		return
+	}
+	sb.WriteByte(' ')
+	writeWKTBody(sb, s)
+}
+
+func writeWKTBody(sb *strings.Builder, s Shape) {
+	if s.isEmpty() {
+		sb.WriteString("EMPTY")
+		return
+	}
+	sb.WriteByte('(')
+	switch s := s.(type) {
+	case Point:
+		writeWKTPoint(sb, s)
+	case LineString:
+		for i, p := range s {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeWKTPoint(sb, p)
+		}
+	case Polygon:
+		for i, ring := range s {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeWKTBody(sb, ring)
+		}
+	case MultiPoint:
+		for i, p := range s {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeWKTBody(sb, p)
+		}
+	case MultiLineString:
+		for i, l := range s {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeWKTBody(sb, l)
+		}
+	case MultiPolygon:
+		for i, p := range s {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeWKTBody(sb, p)
+		}
+	case GeometryCollection:
+		for i, child := range s {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeWKTShape(sb, child)
+		}
+	}
+	sb.WriteByte(')')
+}
+
+func writeWKTPoint(sb *strings.Builder, p Point) {
+	sb.WriteString(formatWKTNumber(p.X))
+	sb.WriteByte(' ')
+	sb.WriteString(formatWKTNumber(p.Y))
+	hasM := !math.IsNaN(p.M)
+	if !math.IsNaN(p.Z) || hasM {
+		sb.WriteByte(' ')
+		sb.WriteString(formatWKTNumber(p.Z))
+	}
+	if hasM {
+		sb.WriteByte(' ')
+		sb.WriteString(formatWKTNumber(p.M))
+	}
+}
+
+func formatWKTNumber(v float64) string {
+	if math.IsNaN(v) {
+		return "NULL"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// parseWKT parses Well-Known Text. Both the SQL Server form, where the third
+// and fourth coordinates are Z and M and either may be NULL, and the OGC
+// form with a Z, M or ZM tag after the type name are accepted.
+func parseWKT(wkt string) (Shape, error) {
+	p := wktParser{input: wkt}
+	p.advance()
+	s, err := p.shape(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %q after geometry", p.tok)
+	}
+	return s, nil
+}
+
+type wktParser struct {
+	input string
+	pos   int
+	tok   string
+}
+
+func (p *wktParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("mssql: invalid WKT: "+format, args...)
+}
+
+// advance moves to the next token: a word, a number, or one of "(),".
+func (p *wktParser) advance() {
+	for p.pos < len(p.input) && strings.IndexByte(" \t\r\n", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos < len(p.input) && strings.IndexByte("(),", p.input[p.pos]) >= 0 {
+		p.pos++
+	} else {
+		for p.pos < len(p.input) && strings.IndexByte(" \t\r\n(),", p.input[p.pos]) < 0 {
+			p.pos++
+		}
+	}
+	p.tok = p.input[start:p.pos]
+}
+
+func (p *wktParser) expect(tok string) error {
+	if p.tok != tok {
+		if p.tok == "" {
+			return p.errorf("expected %q at end of input", tok)
+		}
+		return p.errorf("expected %q, found %q", tok, p.tok)
+	}
+	p.advance()
+	return nil
+}
+
+func (p *wktParser) isWord(word string) bool {
+	return strings.EqualFold(p.tok, word)
+}
+
+// wktDims records which optional coordinates a tagged geometry has.
+type wktDims struct {
+	tagged     bool
+	hasZ, hasM bool
+}
+
+func (p *wktParser) shape(depth int) (Shape, error) {
+	if depth > maxWKBDepth {
+		return nil, p.errorf("geometry is nested too deeply")
+	}
+	var kind spatialType
+	for k, name := range spatialTypeNames {
+		if p.isWord(name) {
+			kind = k
+		}
+	}
+	if kind == 0 {
+		return nil, p.errorf("unknown geometry type %q", p.tok)
+	}
+	p.advance()
+	var dims wktDims
+	switch {
+	case p.isWord("Z"):
+		dims = wktDims{tagged: true, hasZ: true}
+	case p.isWord("M"):
+		dims = wktDims{tagged: true, hasM: true}
+	case p.isWord("ZM"):
+		dims = wktDims{tagged: true, hasZ: true, hasM: true}
+	}
+	if dims.tagged {
+		p.advance()
+	}
+	if kind == spatialGeometryCollection {
+		if p.isWord("EMPTY") {
+			p.advance()
+			return GeometryCollection{}, nil
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		collection := GeometryCollection{}
+		for {
+			child, err := p.shape(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			collection = append(collection, child)
+			if p.tok != "," {
+				break
+			}
+			p.advance()
+		}
+		return collection, p.expect(")")
+	}
+	return p.body(kind, dims)
+}
+
+// body parses the coordinates of a shape that is not a geometry collection,
+// including EMPTY.
+func (p *wktParser) body(kind spatialType, dims wktDims) (Shape, error) {
+	if p.isWord("EMPTY") {
+		p.advance()
+		switch kind {
+		case spatialPoint:
+			return EmptyPoint(), nil
+		case spatialLineString:
+			return LineString{}, nil
+		case spatialPolygon:
+			return Polygon{}, nil
+		}
+		return collectionOf(kind, nil)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var s Shape
+	var err error
+	switch kind {
+	case spatialPoint:
+		s, err = p.point(dims)
+	case spatialLineString:
+		var points []Point
+		points, err = p.points(dims)
+		s = LineString(points)
+	case spatialMultiPoint:
+		var children []Shape
+		children, err = p.list(func() (Shape, error) {
+			// Points of a MULTIPOINT may or may not be parenthesized.
+			if p.tok == "(" || p.isWord("EMPTY") {
+				return p.body(spatialPoint, dims)
+			}
+			return p.point(dims)
+		})
+		if err == nil {
+			s, err = collectionOf(kind, children)
+		}
+	default:
+		child := map[spatialType]spatialType{
+			spatialPolygon:         spatialLineString,
+			spatialMultiLineString: spatialLineString,
+			spatialMultiPolygon:    spatialPolygon,
+		}[kind]
+		var children []Shape
+		children, err = p.list(func() (Shape, error) {
+			return p.body(child, dims)
+		})
+		if err == nil && kind == spatialPolygon {
+			polygon := make(Polygon, len(children))
+			for i, c := range children {
+				polygon[i] = c.(LineString)
+			}
+			s = polygon
+		} else if err == nil {
+			s, err = collectionOf(kind, children)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, p.expect(")")
+}
+
+func (p *wktParser) list(item func() (Shape, error)) ([]Shape, error) {
+	var items []Shape
+	for {
+		s, err := item()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, s)
+		if p.tok != "," {
+			return items, nil
+		}
+		p.advance()
+	}
+}
+
+func (p *wktParser) points(dims wktDims) ([]Point, error) {
+	var points []Point
+	for {
+		pt, err := p.point(dims)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pt)
+		if p.tok != "," {
+			return points, nil
+		}
+		p.advance()
+	}
+}
+
+func (p *wktParser) point(dims wktDims) (Point, error) {
+	var coords []float64
+	for p.tok != "" && p.tok != "," && p.tok != ")" {
+		if p.isWord("NULL") {
+			coords = append(coords, math.NaN())
+		} else {
+			v, err := strconv.ParseFloat(p.tok, 64)
+			if err != nil {
+				return Point{}, p.errorf("invalid coordinate %q", p.tok)
+			}
+			coords = append(coords, v)
+		}
+		p.advance()
+	}
+	pt := EmptyPoint()
+	switch {
+	case len(coords) < 2 || len(coords) > 4:
+		return Point{}, p.errorf("a point must have 2 to 4 coordinates, found %d", len(coords))
+	case math.IsNaN(coords[0]) || math.IsNaN(coords[1]):
+		return Point{}, errors.New("mssql: invalid WKT: X and Y cannot be NULL")
+	}
+	pt.X, pt.Y = coords[0], coords[1]
+	rest := coords[2:]
+	if dims.tagged {
+		want := 0
+		if dims.hasZ {
+			want++
+		}
+		if dims.hasM {
+			want++
+		}
+		if len(rest) != want {
+			return Point{}, p.errorf("expected %d coordinates, found %d", 2+want, len(coords))
+		}
+		if dims.hasZ {
+			pt.Z, rest = rest[0], rest[1:]
+		}
+		if dims.hasM {
+			pt.M = rest[0]
+		}
+		return pt, nil
+	}
+	if len(rest) > 0 {
+		pt.Z = rest[0]
+	}
+	if len(rest) > 1 {
+		pt.M = rest[1]
+	}
+	return pt, nil
+}
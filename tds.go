@@ -17,6 +17,7 @@ import (
 
 	"github.com/microsoft/go-mssqldb/aecmk"
 	"github.com/microsoft/go-mssqldb/integratedauth"
+	"github.com/microsoft/go-mssqldb/internal/cp"
 	"github.com/microsoft/go-mssqldb/msdsn"
 )
 
@@ -175,6 +176,11 @@ type tdsSession struct {
 	connid          UniqueIdentifier
 	activityid      UniqueIdentifier
 	encoding        msdsn.EncodeParameters
+	// collation is the default collation of the current database.
+	collation cp.Collation
+	// dataClassificationVersion is the version of the DATACLASSIFICATION
+	// tokens sent by the server, zero when they are not sent.
+	dataClassificationVersion byte
 }
 
 type alwaysEncryptedSettings struct {
@@ -196,6 +202,13 @@ type columnStruct struct {
 	ColName    string
 	ti         typeInfo
 	cryptoMeta *cryptoMetadata
+
+	// Browse information of FOR BROWSE queries.
+	browseStatus uint8
+	baseTable    string
+	baseColumn   string
+	// classification of the result set the column belongs to.
+	classification *DataClassification
 }
 
 func (c *columnStruct) isEncrypted() bool {
@@ -481,6 +494,12 @@ type featureExtFedAuth struct {
 	// FedAuthToken is populated during login with the value from the provider.
 	FedAuthToken string
 
+	// tokenCacheKey is the key FedAuthToken is cached under, and
+	// tokenFromCache reports whether it was read from the cache rather than
+	// from the provider.
+	tokenCacheKey  string
+	tokenFromCache bool
+
 	// Nonce is populated during login with the value from the provider.
 	Nonce []byte
 
@@ -1062,19 +1081,25 @@ func prepareLogin(ctx context.Context, c *Connector, p msdsn.Config, logger Cont
 	if p.ColumnEncryption {
 		_ = l.FeatureExt.Add(&featureExtColumnEncryption{})
 	}
+	if p.DataClassification {
+		_ = l.FeatureExt.Add(&featureExtDataClassification{})
+	}
 	switch {
 	case fe.FedAuthLibrary == FedAuthLibrarySecurityToken:
 		if uint64(p.LogFlags)&logDebug != 0 {
 			logger.Log(ctx, msdsn.LogDebug, "Starting federated authentication using security token")
 		}
 
-		fe.FedAuthToken, err = c.securityTokenProvider(ctx)
+		var cacheResult tokenCacheResult
+		fe.FedAuthToken, cacheResult, err = c.tokenCache.get(ctx, "", c.securityTokenProvider, tokenRefreshErrorLogger(ctx, p, logger))
 		if err != nil {
 			if uint64(p.LogFlags)&logDebug != 0 {
 				logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("Failed to retrieve service principal token for federated authentication security token library: %v", err))
 			}
 			return nil, err
 		}
+		logTokenCacheResult(ctx, p, logger, cacheResult)
+		fe.tokenCacheKey, fe.tokenFromCache = "", isTokenCacheHit(cacheResult)
 
 		_ = l.FeatureExt.Add(fe)
 
@@ -1102,22 +1127,55 @@ func prepareLogin(ctx context.Context, c *Connector, p msdsn.Config, logger Cont
 		// Default to SQL server authentication with user and password
 		l.UserName = p.User
 		l.Password = p.Password
+		if c != nil && c.passwordProvider != nil {
+			l.Password, err = c.passwordProvider(ctx)
+			if err != nil {
+				if uint64(p.LogFlags)&logDebug != 0 {
+					logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("Failed to retrieve password from password provider: %v", err))
+				}
+				return nil, err
+			}
+		}
 	}
 
 	return l, nil
 }
 
-func getTLSConn(conn *timeoutConn, p msdsn.Config, alpnSeq string) (tlsConn *tls.Conn, err error) {
+// connectionTLSConfig returns a copy of the TLS configuration used to connect
+// to p.Host, with the connector's certificate verification callback installed.
+func connectionTLSConfig(c *Connector, p msdsn.Config) (*tls.Config, error) {
 	var config *tls.Config
 	if pc := p.TLSConfig; pc != nil {
-		config = pc
-	}
-	if config == nil {
+		config = pc.Clone()
+	} else {
+		var err error
 		config, err = msdsn.SetupTLS("", "", false, p.Host, "")
 		if err != nil {
 			return nil, err
 		}
 	}
+	if c != nil && c.VerifyServerCertificate != nil {
+		verify := c.VerifyServerCertificate
+		host := p.Host
+		verifyConnection := config.VerifyConnection
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verifyConnection != nil {
+				if err := verifyConnection(cs); err != nil {
+					return err
+				}
+			}
+			return verify(host, cs.PeerCertificates, cs.VerifiedChains)
+		}
+	}
+	setupTLSSessionCache(c, p, config)
+	return config, nil
+}
+
+func getTLSConn(conn *timeoutConn, c *Connector, p msdsn.Config, alpnSeq string) (tlsConn *tls.Conn, err error) {
+	config, err := connectionTLSConfig(c, p)
+	if err != nil {
+		return nil, err
+	}
 	//Set ALPN Sequence
 	config.NextProtos = []string{alpnSeq}
 	tlsConn = tls.Client(conn.c, config)
@@ -1153,6 +1211,8 @@ func connect(ctx context.Context, c *Connector, logger ContextLogger, p msdsn.Co
 		packetSize = 32767
 	}
 
+	retriedLogin := false
+
 initiate_connection:
 	dialCtx := ctx
 	if p.DialTimeout >= 0 {
@@ -1173,10 +1233,11 @@ initiate_connection:
 	outbuf := newTdsBuffer(packetSize, toconn)
 
 	if p.Encryption == msdsn.EncryptionStrict {
-		tlsConn, err := getTLSConn(toconn, p, "tds/8.0")
+		tlsConn, err := getTLSConn(toconn, c, p, "tds/8.0")
 		if err != nil {
 			return nil, err
 		}
+		logTLSHandshake(ctx, p, logger, tlsConn.ConnectionState())
 		isTransportEncrypted = true
 		outbuf.transport = tlsConn
 		if p.EpaEnabled {
@@ -1219,26 +1280,15 @@ initiate_connection:
 	//We need not perform TLS handshake if the communication channel is already encrypted (encrypt=strict)
 	if !isTransportEncrypted {
 		if encrypt != encryptNotSup {
-			var config *tls.Config
-			if pc := p.TLSConfig; pc != nil {
-				config = pc
-				if !config.DynamicRecordSizingDisabled {
-					config = config.Clone()
-
-					// fix for https://github.com/microsoft/go-mssqldb/issues/166
-					// Go implementation of TLS payload size heuristic algorithm splits single TDS package to multiple TCP segments,
-					// while SQL Server seems to expect one TCP segment per encrypted TDS package.
-					// Setting DynamicRecordSizingDisabled to true disables that algorithm and uses 16384 bytes per TLS package
-					config.DynamicRecordSizingDisabled = true
-				}
-			}
-			if config == nil {
-				config, err = msdsn.SetupTLS("", "", false, p.Host, "")
-				if err != nil {
-					return nil, err
-				}
-
+			config, err := connectionTLSConfig(c, p)
+			if err != nil {
+				return nil, err
 			}
+			// fix for https://github.com/microsoft/go-mssqldb/issues/166
+			// Go implementation of TLS payload size heuristic algorithm splits single TDS package to multiple TCP segments,
+			// while SQL Server seems to expect one TCP segment per encrypted TDS package.
+			// Setting DynamicRecordSizingDisabled to true disables that algorithm and uses 16384 bytes per TLS package
+			config.DynamicRecordSizingDisabled = true
 
 			// setting up connection handler which will allow wrapping of TLS handshake packets inside TDS stream
 			handshakeConn := tlsHandshakeConn{buf: outbuf}
@@ -1248,6 +1298,7 @@ initiate_connection:
 			if err != nil {
 				return nil, fmt.Errorf("TLS Handshake failed: %v", err)
 			}
+			logTLSHandshake(ctx, p, logger, tlsConn.ConnectionState())
 			// Flush any pending packet from the handshake
 			// The driver's Finished message is still in the buffer
 			_, err = handshakeConn.FinishPacket()
@@ -1347,10 +1398,17 @@ initiate_connection:
 				}
 
 				// Request the AD token given the server SPN and STS URL
-				fedAuth.FedAuthToken, err = c.adalTokenProvider(ctx, token.ServerSPN, token.STSURL)
+				var cacheResult tokenCacheResult
+				fedAuth.tokenCacheKey = adalTokenCacheKey(token.ServerSPN, token.STSURL)
+				fedAuth.FedAuthToken, cacheResult, err = c.tokenCache.get(ctx, fedAuth.tokenCacheKey,
+					func(ctx context.Context) (string, error) {
+						return c.adalTokenProvider(ctx, token.ServerSPN, token.STSURL)
+					}, tokenRefreshErrorLogger(ctx, p, logger))
 				if err != nil {
 					return nil, err
 				}
+				logTokenCacheResult(ctx, p, logger, cacheResult)
+				fedAuth.tokenFromCache = isTokenCacheHit(cacheResult)
 
 				// Now need to send the token as a FEDINFO packet
 				err = sendFedAuthInfo(outbuf, fedAuth)
@@ -1370,6 +1428,10 @@ initiate_connection:
 								sess.aeSettings.enclaveType = string(v.EnclaveType)
 							}
 						}
+					case dataClassificationAckStruct:
+						if v.Enabled {
+							sess.dataClassificationVersion = byte(v.Version)
+						}
 					}
 				}
 			case doneStruct:
@@ -1377,9 +1439,19 @@ initiate_connection:
 					tokenErr := token.getError()
 					tokenErr.Message = "login error: " + tokenErr.Message
 					conn.Close()
+					if evictLoginToken(c, fedAuth) && !retriedLogin {
+						// The cached token may have been revoked.
+						retriedLogin = true
+						goto initiate_connection
+					}
 					return nil, tokenErr
 				}
 			case error:
+				if evictLoginToken(c, fedAuth) && !retriedLogin {
+					conn.Close()
+					retriedLogin = true
+					goto initiate_connection
+				}
 				return nil, fmt.Errorf("login error: %s", token.Error())
 			}
 		}
@@ -0,0 +1,134 @@
+package mssql
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServerCertificate(t *testing.T, host string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// handshakeStrict runs a TDS 8.0 style TLS handshake against a local server.
+func handshakeStrict(t *testing.T, c *Connector, p msdsn.Config, cert tls.Certificate) error {
+	t.Helper()
+	_, err := handshakeStrictState(t, c, p, cert, nil)
+	return err
+}
+
+// handshakeStrictState runs a TDS 8.0 style TLS handshake against a local
+// server using serverConfig, and reads one byte from the server so that
+// session tickets sent after the handshake are processed.
+func handshakeStrictState(t *testing.T, c *Connector, p msdsn.Config, cert tls.Certificate, serverConfig *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	if serverConfig == nil {
+		serverConfig = &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"tds/8.0"}}
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		server, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+		s := tls.Server(server, serverConfig)
+		if s.Handshake() == nil {
+			_, _ = s.Write([]byte{1})
+		}
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	tlsConn, err := getTLSConn(newTimeoutConn(client, 0), c, p, "tds/8.0")
+	var state tls.ConnectionState
+	if err == nil {
+		_, err = tlsConn.Read(make([]byte, 1))
+		state = tlsConn.ConnectionState()
+	}
+	client.Close()
+	<-serverDone
+	return state, err
+}
+
+func TestVerifyServerCertificateCallback(t *testing.T) {
+	cert := newTestServerCertificate(t, "routed.example.com")
+	p, err := msdsn.Parse("sqlserver://origin.example.com?encrypt=strict&hostnameincertificate=routed.example.com")
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	p.TLSConfig.RootCAs = pool
+	// simulate the host change made when the server routes the connection
+	p.Host = "routed.example.com"
+
+	var gotHost string
+	var gotPeers []*x509.Certificate
+	var gotChains [][]*x509.Certificate
+	c := NewConnectorConfig(p)
+	c.VerifyServerCertificate = func(host string, peerCertificates []*x509.Certificate, verifiedChains [][]*x509.Certificate) error {
+		gotHost, gotPeers, gotChains = host, peerCertificates, verifiedChains
+		return nil
+	}
+	require.NoError(t, handshakeStrict(t, c, p, cert))
+	assert.Equal(t, "routed.example.com", gotHost)
+	require.Len(t, gotPeers, 1)
+	assert.Equal(t, cert.Leaf.Raw, gotPeers[0].Raw)
+	assert.NotEmpty(t, gotChains, "chain should be verified against RootCAs")
+	assert.Nil(t, p.TLSConfig.VerifyConnection, "connection settings must not leak into the shared config")
+	assert.Nil(t, p.TLSConfig.NextProtos, "connection settings must not leak into the shared config")
+
+	c.VerifyServerCertificate = func(host string, peerCertificates []*x509.Certificate, verifiedChains [][]*x509.Certificate) error {
+		return errors.New("rejected by application")
+	}
+	err = handshakeStrict(t, c, p, cert)
+	assert.ErrorContains(t, err, "rejected by application")
+}
+
+func TestServerPinsHandshake(t *testing.T) {
+	cert := newTestServerCertificate(t, "pinned.example.com")
+	hash := sha256.Sum256(cert.Leaf.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+
+	p, err := msdsn.Parse("sqlserver://pinned.example.com?encrypt=true&trustservercertificate=true&serverpins=" + url.QueryEscape(pin))
+	require.NoError(t, err)
+	assert.NoError(t, handshakeStrict(t, NewConnectorConfig(p), p, cert), "pinned certificate")
+
+	other := newTestServerCertificate(t, "pinned.example.com")
+	err = handshakeStrict(t, NewConnectorConfig(p), p, other)
+	assert.ErrorContains(t, err, "does not match any of the configured server pins")
+}
@@ -0,0 +1,74 @@
+package mssql
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// defaultTLSSessionCacheSize is the number of TLS sessions a Connector keeps
+// for resumption when TLSSessionCacheSize is not set.
+const defaultTLSSessionCacheSize = 64
+
+// tlsSessionCache returns the TLS session cache shared by the connections of
+// c, creating it on first use, or nil when session resumption is disabled.
+func (c *Connector) tlsSessionCache() tls.ClientSessionCache {
+	if c == nil || c.DisableTLSSessionResumption {
+		return nil
+	}
+	c.sessionCacheOnce.Do(func() {
+		size := c.TLSSessionCacheSize
+		if size <= 0 {
+			size = defaultTLSSessionCacheSize
+		}
+		c.sessionCache = tls.NewLRUClientSessionCache(size)
+	})
+	return c.sessionCache
+}
+
+// routedSessionCache scopes a shared session cache to the host and port a
+// connection is made to. crypto/tls keys sessions by server name, which stays
+// the same after a gateway redirects the connection when hostnameincertificate
+// is set; scoping by the routed address ensures a session is only offered to
+// the server that issued it.
+type routedSessionCache struct {
+	cache tls.ClientSessionCache
+	addr  string
+}
+
+func (r routedSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	return r.cache.Get(r.addr + "\x00" + sessionKey)
+}
+
+func (r routedSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	r.cache.Put(r.addr+"\x00"+sessionKey, cs)
+}
+
+// setupTLSSessionCache installs the connector's session cache on config
+// unless the application supplied its own cache.
+func setupTLSSessionCache(c *Connector, p msdsn.Config, config *tls.Config) {
+	if config.ClientSessionCache != nil {
+		return
+	}
+	cache := c.tlsSessionCache()
+	if cache == nil {
+		return
+	}
+	config.ClientSessionCache = routedSessionCache{
+		cache: cache,
+		addr:  fmt.Sprintf("%s:%d", p.Host, p.Port),
+	}
+}
+
+func logTLSHandshake(ctx context.Context, p msdsn.Config, logger ContextLogger, state tls.ConnectionState) {
+	if uint64(p.LogFlags)&logDebug == 0 {
+		return
+	}
+	if state.DidResume {
+		logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("TLS session resumed with %s", p.Host))
+	} else {
+		logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("TLS full handshake with %s", p.Host))
+	}
+}
@@ -0,0 +1,46 @@
+package mssql
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSSessionResumption(t *testing.T) {
+	cert := newTestServerCertificate(t, "db.example.com")
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"tds/8.0"}}
+	p, err := msdsn.Parse("sqlserver://db.example.com?encrypt=true&trustservercertificate=true")
+	require.NoError(t, err)
+	c := NewConnectorConfig(p)
+
+	state, err := handshakeStrictState(t, c, p, cert, serverConfig)
+	require.NoError(t, err)
+	assert.False(t, state.DidResume, "first connection performs a full handshake")
+	state, err = handshakeStrictState(t, c, p, cert, serverConfig)
+	require.NoError(t, err)
+	assert.True(t, state.DidResume, "second connection resumes the session")
+
+	routed := p
+	routed.Host = "node1.example.com"
+	routed.Port = 11000
+	state, err = handshakeStrictState(t, c, routed, cert, serverConfig)
+	require.NoError(t, err)
+	assert.False(t, state.DidResume, "sessions are not shared with a different routed host")
+
+	other := NewConnectorConfig(p)
+	state, err = handshakeStrictState(t, other, p, cert, serverConfig)
+	require.NoError(t, err)
+	assert.False(t, state.DidResume, "sessions are not shared between connectors")
+
+	disabled := NewConnectorConfig(p)
+	disabled.DisableTLSSessionResumption = true
+	for i := 0; i < 2; i++ {
+		state, err = handshakeStrictState(t, disabled, p, cert, serverConfig)
+		require.NoError(t, err)
+		assert.False(t, state.DidResume, "resumption disabled")
+	}
+	assert.Nil(t, p.TLSConfig.ClientSessionCache, "session cache must not leak into the shared config")
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/golang-sql/sqlexp"
 	"github.com/microsoft/go-mssqldb/aecmk"
+	"github.com/microsoft/go-mssqldb/internal/cp"
 	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/algorithms"
 	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/encryption"
 	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/keys"
@@ -24,22 +25,25 @@ type token byte
 
 // token ids
 const (
-	tokenReturnStatus  token = 121 // 0x79
-	tokenColMetadata   token = 129 // 0x81
-	tokenOrder         token = 169 // 0xA9
-	tokenError         token = 170 // 0xAA
-	tokenInfo          token = 171 // 0xAB
-	tokenReturnValue   token = 0xAC
-	tokenLoginAck      token = 173 // 0xad
-	tokenFeatureExtAck token = 174 // 0xae
-	tokenRow           token = 209 // 0xd1
-	tokenNbcRow        token = 210 // 0xd2
-	tokenEnvChange     token = 227 // 0xE3
-	tokenSSPI          token = 237 // 0xED
-	tokenFedAuthInfo   token = 238 // 0xEE
-	tokenDone          token = 253 // 0xFD
-	tokenDoneProc      token = 254
-	tokenDoneInProc    token = 255
+	tokenReturnStatus       token = 121 // 0x79
+	tokenColMetadata        token = 129 // 0x81
+	tokenDataClassification token = 163 // 0xA3
+	tokenTabName            token = 164 // 0xA4
+	tokenColInfo            token = 165 // 0xA5
+	tokenOrder              token = 169 // 0xA9
+	tokenError              token = 170 // 0xAA
+	tokenInfo               token = 171 // 0xAB
+	tokenReturnValue        token = 0xAC
+	tokenLoginAck           token = 173 // 0xad
+	tokenFeatureExtAck      token = 174 // 0xae
+	tokenRow                token = 209 // 0xd1
+	tokenNbcRow             token = 210 // 0xd2
+	tokenEnvChange          token = 227 // 0xE3
+	tokenSSPI               token = 237 // 0xED
+	tokenFedAuthInfo        token = 238 // 0xEE
+	tokenDone               token = 253 // 0xFD
+	tokenDoneProc           token = 254
+	tokenDoneInProc         token = 255
 )
 
 // done flags
@@ -98,14 +102,21 @@ const (
 )
 
 const (
-	cipherAlgCustom = 0x00
+	cipherAlgCustom                  = 0x00
+	cipherAlgAeadAes256CbcHmacSha256 = 0x02
 )
 
 // COLMETADATA flags
 // https://msdn.microsoft.com/en-us/library/dd357363.aspx
 const (
-	colFlagNullable  = 1
-	colFlagEncrypted = 0x0800
+	colFlagNullable   = 1
+	colFlagUpdateable = 0x000c
+	colFlagReadOnly   = 0x0000
+	colFlagReadWrite  = 0x0004
+	colFlagIdentity   = 0x0010
+	colFlagComputed   = 0x0020
+	colFlagEncrypted  = 0x0800
+	colFlagHidden     = 0x2000
 	// TODO implement more flags
 )
 
@@ -221,7 +232,6 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 				badStreamPanic(err)
 			}
 		case envSqlCollation:
-			// currently ignored
 			var collationSize uint8
 			err = binary.Read(r, binary.LittleEndian, &collationSize)
 			if err != nil {
@@ -246,6 +256,7 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 			if err != nil {
 				badStreamPanic(err)
 			}
+			sess.collation = cp.Collation{LcidAndFlags: info, SortId: sortID}
 
 			// old value, should be 0
 			if _, err = readBVarChar(r); err != nil {
@@ -581,6 +592,13 @@ func parseFeatureExtAck(r *tdsBuffer) featureExtAck {
 
 			}
 			ack[feature] = colAck
+		case featExtDATACLASSIFICATION:
+			if length >= 2 {
+				dcAck := dataClassificationAckStruct{Version: int(r.byte())}
+				dcAck.Enabled = r.byte() != 0
+				length -= 2
+				ack[feature] = dcAck
+			}
 		}
 
 		// Skip unprocessed bytes
@@ -977,10 +995,25 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 		badStreamPanic(fmt.Errorf("unexpected packet type in reply: got %v, expected %v", packet_type, packReply))
 	}
 	var columns []columnStruct
+	var tables []string
+	colsPending := false
 	errs := make([]Error, 0, 5)
 	for tokens := 0; ; tokens += 1 {
 		token := token(sess.buf.byte())
 		sess.LogF(ctx, msdsn.LogDebug, "got token %v", token)
+		if colsPending && token != tokenDataClassification && token != tokenTabName && token != tokenColInfo {
+			// The data classification and the browse information of
+			// FOR BROWSE queries follow the column metadata, and are
+			// added to it before it is passed on.
+			colsPending = false
+			ch <- columns
+			if outs.msgq != nil {
+				if len(columns) > 0 && columns[0].classification != nil {
+					_ = sqlexp.ReturnMessageEnqueue(ctx, outs.msgq, MsgDataClassification{Classification: columns[0].classification})
+				}
+				_ = sqlexp.ReturnMessageEnqueue(ctx, outs.msgq, sqlexp.MsgNext{})
+			}
+		}
 		switch token {
 		case tokenSSPI:
 			ch <- parseSSPIMsg(sess.buf)
@@ -1072,11 +1105,15 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			}
 		case tokenColMetadata:
 			columns = parseColMetadata72(sess.buf, sess)
-			ch <- columns
+			tables = nil
+			colsPending = true
 			colsReceived = true
-			if outs.msgq != nil {
-				_ = sqlexp.ReturnMessageEnqueue(ctx, outs.msgq, sqlexp.MsgNext{})
-			}
+		case tokenDataClassification:
+			applyDataClassification(columns, parseDataClassification(sess.buf, sess.dataClassificationVersion))
+		case tokenTabName:
+			tables = parseTabName(sess.buf)
+		case tokenColInfo:
+			applyColInfo(columns, tables, parseColInfo(sess.buf))
 
 		case tokenRow:
 			row := make([]interface{}, len(columns))
@@ -0,0 +1,248 @@
+package mssql
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+const (
+	// defaultTokenRefreshBefore is how long before expiry a cached token
+	// is refreshed in the background.
+	defaultTokenRefreshBefore = 5 * time.Minute
+	// tokenMinValidity is the minimum remaining lifetime a cached token must
+	// have to be sent to the server. Tokens closer to expiry are fetched
+	// synchronously so the login does not race the token's expiration.
+	tokenMinValidity = time.Minute
+	// tokenRefreshTimeout bounds background refreshes, which run detached
+	// from the context of the login that triggered them.
+	tokenRefreshTimeout = time.Minute
+)
+
+// TokenCacheOptions configures the cache of federated authentication tokens
+// kept by a Connector.
+//
+// Tokens returned by the security token or Active Directory token provider
+// are cached when they are JWTs with an "exp" claim. Tokens without a
+// parsable expiry are never cached and the provider is called on every login.
+// The token of a login the server rejects is removed from the cache, and a
+// login that used a cached token is retried once with a new token.
+type TokenCacheOptions struct {
+	// Disabled turns off caching so the token provider is called for
+	// every new physical connection.
+	Disabled bool
+	// RefreshBefore is how long before a cached token expires that a
+	// background refresh is started. Logins continue to use the cached
+	// token while the refresh is in flight. Defaults to 5 minutes.
+	RefreshBefore time.Duration
+}
+
+// SetTokenCacheOptions replaces the token cache settings of the connector
+// and discards any cached tokens.
+func (c *Connector) SetTokenCacheOptions(opts TokenCacheOptions) {
+	if c.tokenCache == nil {
+		c.tokenCache = newTokenCache()
+	}
+	c.tokenCache.configure(opts)
+}
+
+// tokenCacheResult describes how a token was obtained from the cache.
+type tokenCacheResult int
+
+const (
+	tokenCacheMiss tokenCacheResult = iota
+	tokenCacheHit
+	tokenCacheHitRefreshing
+	tokenCacheBypass
+)
+
+func isTokenCacheHit(result tokenCacheResult) bool {
+	return result == tokenCacheHit || result == tokenCacheHitRefreshing
+}
+
+type cachedToken struct {
+	token      string
+	expiresOn  time.Time
+	refreshing bool
+}
+
+// tokenCache holds federated authentication tokens keyed by the server SPN
+// and STS URL they were requested for. Security token logins use the empty key.
+type tokenCache struct {
+	mu     sync.Mutex
+	opts   TokenCacheOptions
+	tokens map[string]*cachedToken
+	now    func() time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens: make(map[string]*cachedToken),
+		now:    time.Now,
+	}
+}
+
+func (tc *tokenCache) configure(opts TokenCacheOptions) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.opts = opts
+	tc.tokens = make(map[string]*cachedToken)
+}
+
+func (tc *tokenCache) refreshBefore() time.Duration {
+	if tc.opts.RefreshBefore > 0 {
+		return tc.opts.RefreshBefore
+	}
+	return defaultTokenRefreshBefore
+}
+
+// get returns a token for key, calling fetch when there is no usable cached
+// token. When the cached token is close to expiry it is returned immediately
+// and fetch is called in the background to replace it; failures of the
+// background refresh are reported to onRefreshError and the cached token
+// stays in use until it is too close to expiry.
+func (tc *tokenCache) get(ctx context.Context, key string, fetch func(ctx context.Context) (string, error), onRefreshError func(error)) (string, tokenCacheResult, error) {
+	if tc == nil {
+		token, err := fetch(ctx)
+		return token, tokenCacheBypass, err
+	}
+	tc.mu.Lock()
+	if tc.opts.Disabled {
+		tc.mu.Unlock()
+		token, err := fetch(ctx)
+		return token, tokenCacheBypass, err
+	}
+	now := tc.now()
+	if ct, ok := tc.tokens[key]; ok && now.Add(tokenMinValidity).Before(ct.expiresOn) {
+		result := tokenCacheHit
+		if !now.Add(tc.refreshBefore()).Before(ct.expiresOn) {
+			result = tokenCacheHitRefreshing
+			if !ct.refreshing {
+				ct.refreshing = true
+				go tc.refresh(context.WithoutCancel(ctx), key, ct, fetch, onRefreshError)
+			}
+		}
+		token := ct.token
+		tc.mu.Unlock()
+		return token, result, nil
+	}
+	tc.mu.Unlock()
+
+	token, err := fetch(ctx)
+	if err != nil {
+		return "", tokenCacheMiss, err
+	}
+	tc.store(key, token)
+	return token, tokenCacheMiss, nil
+}
+
+func (tc *tokenCache) refresh(ctx context.Context, key string, old *cachedToken, fetch func(ctx context.Context) (string, error), onRefreshError func(error)) {
+	ctx, cancel := context.WithTimeout(ctx, tokenRefreshTimeout)
+	defer cancel()
+	token, err := fetch(ctx)
+	if err != nil {
+		tc.mu.Lock()
+		old.refreshing = false
+		tc.mu.Unlock()
+		if onRefreshError != nil {
+			onRefreshError(err)
+		}
+		return
+	}
+	tc.store(key, token)
+}
+
+// store caches token under key if its expiry can be determined.
+func (tc *tokenCache) store(key string, token string) {
+	expiresOn, ok := jwtExpiry(token)
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if !ok {
+		delete(tc.tokens, key)
+		return
+	}
+	tc.tokens[key] = &cachedToken{token: token, expiresOn: expiresOn}
+}
+
+// evict removes the token cached under key if it is still token, so that the
+// next login fetches a new one.
+func (tc *tokenCache) evict(key string, token string) {
+	if tc == nil {
+		return
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if ct, ok := tc.tokens[key]; ok && ct.token == token {
+		delete(tc.tokens, key)
+	}
+}
+
+// evictLoginToken removes the token of a failed login from the cache of c.
+// It reports whether the token came from the cache, in which case the login
+// is worth retrying once with a new token.
+func evictLoginToken(c *Connector, fe *featureExtFedAuth) bool {
+	if c == nil || fe.FedAuthToken == "" {
+		return false
+	}
+	c.tokenCache.evict(fe.tokenCacheKey, fe.FedAuthToken)
+	return fe.tokenFromCache
+}
+
+// adalTokenCacheKey returns the cache key for tokens obtained during an ADAL login.
+func adalTokenCacheKey(serverSPN, stsURL string) string {
+	return serverSPN + "\x00" + stsURL
+}
+
+// jwtExpiry returns the expiration time stored in the "exp" claim of a JWT.
+// The signature is not validated; the server remains responsible for that.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil || exp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+func logTokenCacheResult(ctx context.Context, p msdsn.Config, logger ContextLogger, result tokenCacheResult) {
+	if uint64(p.LogFlags)&logDebug == 0 {
+		return
+	}
+	switch result {
+	case tokenCacheHit:
+		logger.Log(ctx, msdsn.LogDebug, "Using cached federated authentication token")
+	case tokenCacheHitRefreshing:
+		logger.Log(ctx, msdsn.LogDebug, "Using cached federated authentication token, refreshing in the background")
+	case tokenCacheMiss:
+		logger.Log(ctx, msdsn.LogDebug, "Obtained new federated authentication token")
+	}
+}
+
+// tokenRefreshErrorLogger returns a callback that reports failed background
+// token refreshes through the connection's logger.
+func tokenRefreshErrorLogger(ctx context.Context, p msdsn.Config, logger ContextLogger) func(error) {
+	return func(err error) {
+		if uint64(p.LogFlags)&logErrors != 0 {
+			logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Background refresh of federated authentication token failed: %v", err))
+		}
+	}
+}
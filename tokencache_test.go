@@ -0,0 +1,302 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestJWT(exp time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"aud":"https://database.windows.net/","exp":%d}`, exp.Unix())))
+	return header + "." + payload + ".sig"
+}
+
+func TestJwtExpiry(t *testing.T) {
+	exp := time.Unix(1893456000, 0)
+	got, ok := jwtExpiry(makeTestJWT(exp))
+	assert.True(t, ok, "jwtExpiry ok")
+	assert.True(t, exp.Equal(got), "jwtExpiry = %v, want %v", got, exp)
+
+	for _, token := range []string{
+		"",
+		"opaque-token",
+		"a.b",
+		"a.!!!.c",
+		base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"x"}`)) + ".sig",
+	} {
+		_, ok := jwtExpiry(token)
+		assert.False(t, ok, "jwtExpiry(%q) should fail", token)
+	}
+}
+
+func TestTokenCacheReusesToken(t *testing.T) {
+	now := time.Now()
+	tc := newTokenCache()
+	tc.now = func() time.Time { return now }
+	calls := 0
+	fetch := func(ctx context.Context) (string, error) {
+		calls++
+		return makeTestJWT(now.Add(time.Hour)), nil
+	}
+
+	first, result, err := tc.get(context.Background(), "", fetch, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenCacheMiss, result)
+	second, result, err := tc.get(context.Background(), "", fetch, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenCacheHit, result)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, calls, "provider calls")
+
+	_, result, err = tc.get(context.Background(), adalTokenCacheKey("spn", "sts"), fetch, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenCacheMiss, result, "different key should not hit")
+	assert.Equal(t, 2, calls, "provider calls")
+}
+
+func TestTokenCacheDoesNotCacheOpaqueTokens(t *testing.T) {
+	tc := newTokenCache()
+	calls := 0
+	fetch := func(ctx context.Context) (string, error) {
+		calls++
+		return "opaque", nil
+	}
+	for i := 0; i < 3; i++ {
+		token, result, err := tc.get(context.Background(), "", fetch, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "opaque", token)
+		assert.Equal(t, tokenCacheMiss, result)
+	}
+	assert.Equal(t, 3, calls, "provider calls")
+}
+
+func TestTokenCacheExpiredTokenIsFetched(t *testing.T) {
+	now := time.Now()
+	tc := newTokenCache()
+	tc.now = func() time.Time { return now }
+	calls := 0
+	fetch := func(ctx context.Context) (string, error) {
+		calls++
+		return makeTestJWT(now.Add(30 * time.Second)), nil
+	}
+	_, _, err := tc.get(context.Background(), "", fetch, nil)
+	assert.NoError(t, err)
+	_, result, err := tc.get(context.Background(), "", fetch, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenCacheMiss, result, "token inside the minimum validity window must not be reused")
+	assert.Equal(t, 2, calls, "provider calls")
+}
+
+func TestTokenCacheRefreshesInBackground(t *testing.T) {
+	now := time.Now()
+	tc := newTokenCache()
+	tc.now = func() time.Time { return now }
+	old := makeTestJWT(now.Add(3 * time.Minute))
+	fresh := makeTestJWT(now.Add(time.Hour))
+	tc.store("", old)
+
+	var calls int32
+	done := make(chan struct{})
+	fetch := func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		defer close(done)
+		return fresh, nil
+	}
+	token, result, err := tc.get(context.Background(), "", fetch, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, old, token, "cached token should be returned while refreshing")
+	assert.Equal(t, tokenCacheHitRefreshing, result)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("background refresh was not started")
+	}
+	assert.Eventually(t, func() bool {
+		token, result, _ := tc.get(context.Background(), "", fetch, nil)
+		return token == fresh && result == tokenCacheHit
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "provider calls")
+}
+
+func TestTokenCacheBackgroundRefreshError(t *testing.T) {
+	now := time.Now()
+	tc := newTokenCache()
+	tc.now = func() time.Time { return now }
+	old := makeTestJWT(now.Add(3 * time.Minute))
+	tc.store("", old)
+
+	refreshErr := make(chan error, 1)
+	fetch := func(ctx context.Context) (string, error) {
+		return "", errors.New("sts unavailable")
+	}
+	token, _, err := tc.get(context.Background(), "", fetch, func(err error) { refreshErr <- err })
+	assert.NoError(t, err)
+	assert.Equal(t, old, token)
+	select {
+	case err := <-refreshErr:
+		assert.EqualError(t, err, "sts unavailable")
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh error was not reported")
+	}
+	token, _, err = tc.get(context.Background(), "", fetch, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, old, token, "cached token should stay in use after a failed refresh")
+}
+
+func TestTokenCacheDisabled(t *testing.T) {
+	c := NewConnectorConfig(msdsn.Config{})
+	c.SetTokenCacheOptions(TokenCacheOptions{Disabled: true})
+	calls := 0
+	fetch := func(ctx context.Context) (string, error) {
+		calls++
+		return makeTestJWT(time.Now().Add(time.Hour)), nil
+	}
+	for i := 0; i < 2; i++ {
+		_, result, err := c.tokenCache.get(context.Background(), "", fetch, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, tokenCacheBypass, result)
+	}
+	assert.Equal(t, 2, calls, "provider calls")
+}
+
+func TestTokenCacheNilBypasses(t *testing.T) {
+	var tc *tokenCache
+	token, result, err := tc.get(context.Background(), "", func(ctx context.Context) (string, error) { return "t", nil }, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "t", token)
+	assert.Equal(t, tokenCacheBypass, result)
+}
+
+func TestTokenCacheEvict(t *testing.T) {
+	tc := newTokenCache()
+	token := makeTestJWT(time.Now().Add(time.Hour))
+	tc.store("", token)
+	tc.evict("", "other")
+	assert.Contains(t, tc.tokens, "", "a token replaced since the login is kept")
+	tc.evict("", token)
+	assert.NotContains(t, tc.tokens, "")
+
+	var nilCache *tokenCache
+	nilCache.evict("", token)
+}
+
+// revokingDialer serves logins over pipes, failing those that send a
+// revoked token.
+type revokingDialer struct {
+	revoked atomic.Value
+	logins  int32
+}
+
+func (d *revokingDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	server, client := net.Pipe()
+	go d.serve(server)
+	return client, nil
+}
+
+func (d *revokingDialer) serve(conn net.Conn) {
+	defer conn.Close()
+	readMessage := func() ([]byte, error) {
+		var msg []byte
+		for {
+			header := make([]byte, 8)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return nil, err
+			}
+			body := make([]byte, int(binary.BigEndian.Uint16(header[2:]))-8)
+			if _, err := io.ReadFull(conn, body); err != nil {
+				return nil, err
+			}
+			msg = append(msg, body...)
+			if header[1]&1 != 0 {
+				return msg, nil
+			}
+		}
+	}
+	writeReply := func(body []byte) {
+		header := []byte{byte(packReply), 1, 0, 0, 0, 0, 1, 0}
+		binary.BigEndian.PutUint16(header[2:], uint16(len(body)+8))
+		_, _ = conn.Write(append(header, body...))
+	}
+	if _, err := readMessage(); err != nil {
+		return
+	}
+	writeReply([]byte{0, 0, 0x10, 0, 6, 1, 0, 0x16, 0, 1, 6, 0, 0x17, 0, 1, 0xff, 0x0c, 0, 0x07, 0xd0, 0, 0, 2, 1})
+	login, err := readMessage()
+	if err != nil {
+		return
+	}
+	atomic.AddInt32(&d.logins, 1)
+	if revoked, _ := d.revoked.Load().(string); revoked != "" && bytes.Contains(login, str2ucs2(revoked)) {
+		msg := str2ucs2("Login failed for user '<token-identified principal>'.")
+		var body bytes.Buffer
+		binary.Write(&body, binary.LittleEndian, int32(18456))
+		body.Write([]byte{1, 14})
+		binary.Write(&body, binary.LittleEndian, uint16(len(msg)/2))
+		body.Write(msg)
+		body.Write([]byte{0, 0})
+		binary.Write(&body, binary.LittleEndian, int32(1))
+		reply := []byte{byte(tokenError)}
+		reply = binary.LittleEndian.AppendUint16(reply, uint16(body.Len()))
+		reply = append(reply, body.Bytes()...)
+		reply = append(reply, byte(tokenDone), byte(doneError), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+		writeReply(reply)
+		return
+	}
+	ack, _ := hex.DecodeString("ad320001740000041" + "44d006900630072006f0073006f0066007400200053005100" +
+		"4c0020005300650072007600650072000c0007d0fd000000000000000000000000")
+	writeReply(ack)
+	_, _ = io.Copy(io.Discard, conn)
+}
+
+func TestTokenCacheRetriesRevokedToken(t *testing.T) {
+	config, err := msdsn.Parse("sqlserver://localhost:1433?protocol=tcp&notraceid=true")
+	assert.NoError(t, err)
+	now := time.Now()
+	tokens := []string{makeTestJWT(now.Add(time.Hour)), makeTestJWT(now.Add(2 * time.Hour))}
+	var calls int
+	c, err := NewSecurityTokenConnector(config, func(ctx context.Context) (string, error) {
+		calls++
+		return tokens[(calls-1)%len(tokens)], nil
+	})
+	assert.NoError(t, err)
+	dialer := &revokingDialer{}
+	c.Dialer = dialer
+	login := func() error {
+		sess, err := connect(context.Background(), c, driverInstanceNoProcess.logger, c.params)
+		if err == nil {
+			sess.buf.transport.Close()
+		}
+		return err
+	}
+
+	assert.NoError(t, login())
+	assert.NoError(t, login())
+	assert.Equal(t, 1, calls, "the second login uses the cached token")
+
+	dialer.revoked.Store(tokens[0])
+	assert.NoError(t, login(), "a rejected cached token is replaced")
+	assert.Equal(t, 2, calls, "provider calls")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&dialer.logins))
+	assert.Equal(t, tokens[1], c.tokenCache.tokens[""].token)
+
+	dialer.revoked.Store(tokens[1])
+	calls = 1
+	err = login()
+	assert.ErrorContains(t, err, "login error: Login failed")
+	assert.Equal(t, 2, calls, "the login is retried once")
+	assert.Equal(t, int32(6), atomic.LoadInt32(&dialer.logins))
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
 	"strings"
 	"time"
@@ -113,7 +114,7 @@ func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldInd
 			if elemKind == reflect.Ptr && valOf.IsNil() {
 				switch tvpVal.(type) {
 				case *bool, *time.Time, *int8, *int16, *int32, *int64, *float32, *float64, *int,
-					*uint8, *uint16, *uint32, *uint64, *uint:
+					*uint8, *uint16, *uint32, *uint64, *uint, *big.Rat, *big.Int:
 					binary.Write(buf, binary.LittleEndian, uint8(0))
 					continue
 				default:
@@ -130,7 +131,13 @@ func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldInd
 			if err != nil {
 				return nil, fmt.Errorf("failed to convert tvp parameter row col: %s", err)
 			}
-			param, err := stmt.makeParam(cval)
+			var param param
+			if columnStr[columnStrIdx].ti.TypeId == typeDecimalN {
+				// Values are rescaled to the scale of their column.
+				param, err = (&Bulk{cn: stmt.c}).makeParam(cval, columnStr[columnStrIdx])
+			} else {
+				param, err = stmt.makeParam(cval)
+			}
 			if err != nil {
 				return nil, fmt.Errorf("failed to make tvp parameter row col: %s", err)
 			}
@@ -212,6 +219,12 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 		switch param.ti.TypeId {
 		case typeNVarChar, typeBigVarBin:
 			column.ti.Size = 0
+		case typeDecimalN:
+			// Big number values carry their own precision and scale, so the
+			// column takes the largest scale found in the rows.
+			column.ti.Size = 17
+			column.ti.Prec = maxDecimalPrecision
+			column.ti.Scale = tvp.maxDecimalScale(stmt, tvpFieldIndexes[index])
 		}
 		columnConfiguration = append(columnConfiguration, column)
 	}
@@ -219,6 +232,22 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 	return columnConfiguration, tvpFieldIndexes, nil
 }
 
+// maxDecimalScale returns the largest scale of the decimal values in the
+// given field of the rows.
+func (tvp TVP) maxDecimalScale(stmt *Stmt, fieldIndex int) (scale uint8) {
+	val := reflect.ValueOf(tvp.Value)
+	for i := 0; i < val.Len(); i++ {
+		cval, err := convertInputParameter(val.Index(i).Field(fieldIndex).Interface())
+		if err != nil {
+			continue
+		}
+		if p, err := stmt.makeParam(cval); err == nil && p.ti.Scale > scale {
+			scale = p.ti.Scale
+		}
+	}
+	return scale
+}
+
 func IsSkipField(tvpTagValue string, isTvpValue bool, jsonTagValue string, isJsonTagValue bool) bool {
 	if !isTvpValue && !isJsonTagValue {
 		return false
@@ -0,0 +1,168 @@
+package mssql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TypeConverter converts the values of a SQL type to and from a Go type. It
+// is registered on a Connector with RegisterTypeConverter, for example to
+// read decimal columns as decimal.Decimal:
+//
+//	err := connector.RegisterTypeConverter(mssql.TypeConverter{
+//		SQLType: "decimal",
+//		GoType:  reflect.TypeOf(decimal.Decimal{}),
+//		FromDriver: func(src driver.Value) (interface{}, error) {
+//			return decimal.NewFromString(string(src.([]byte)))
+//		},
+//		ToDriver: func(v interface{}) (driver.Value, error) {
+//			return v.(decimal.Decimal).String(), nil
+//		},
+//		ParamType: "decimal(38, 10)",
+//	})
+//
+// Rows return the values of the driver and columns report the scan type of
+// the driver, whatever the converters. Values are converted by scanning
+// them into Scanner, with the converter of a column found by
+// LookupTypeConverter:
+//
+//	conv, _ := connector.LookupTypeConverter(columnType.DatabaseTypeName())
+//	var d decimal.Decimal
+//	err = rows.Scan(conv.Scanner(&d))
+type TypeConverter struct {
+	// SQLType is the name of the SQL type as reported by
+	// ColumnTypeDatabaseTypeName, such as "decimal", "datetime2" or
+	// "uniqueidentifier". Case is ignored.
+	SQLType string
+	// GoType is the type FromDriver converts values to, and the type of the
+	// parameters converted by ToDriver.
+	GoType reflect.Type
+	// FromDriver converts a value read from a column of SQLType, of the
+	// type the driver returns, to a GoType value when it is scanned into
+	// Scanner. It is not called for NULL values. When nil, values are
+	// scanned unchanged.
+	FromDriver func(src driver.Value) (interface{}, error)
+	// ToDriver converts a parameter of GoType to a value the driver can
+	// send. When nil, parameters of GoType are sent as usual.
+	ToDriver func(v interface{}) (driver.Value, error)
+	// ParamType optionally declares the SQL type converted parameters are
+	// sent as, such as "decimal(38, 10)", as with TypedParam. When empty the
+	// type is inferred from the value returned by ToDriver.
+	ParamType string
+}
+
+// RegisterTypeConverter registers conv for the connections of the
+// connector, replacing the converters previously registered for the same
+// SQL type or Go type. It should be called before the connector is used.
+func (c *Connector) RegisterTypeConverter(conv TypeConverter) error {
+	if conv.SQLType == "" || conv.GoType == nil {
+		return errors.New("mssql: a type converter needs a SQLType and a GoType")
+	}
+	if conv.ParamType != "" {
+		if _, err := parseTypeDecl(conv.ParamType); err != nil {
+			return err
+		}
+	}
+	c.typeConverters.add(&conv)
+	return nil
+}
+
+// LookupTypeConverter returns the converter registered for sqlType, a type
+// name as reported by ColumnTypeDatabaseTypeName.
+func (c *Connector) LookupTypeConverter(sqlType string) (TypeConverter, bool) {
+	conv := c.typeConverters.forSQLType(sqlType)
+	if conv == nil {
+		return TypeConverter{}, false
+	}
+	return *conv, true
+}
+
+// typeConverters holds the converters registered on a Connector, by SQL
+// type and by Go type.
+type typeConverters struct {
+	mu     sync.RWMutex
+	bySQL  map[string]*TypeConverter
+	byType map[reflect.Type]*TypeConverter
+}
+
+func (r *typeConverters) add(conv *TypeConverter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.bySQL == nil {
+		r.bySQL = make(map[string]*TypeConverter)
+		r.byType = make(map[reflect.Type]*TypeConverter)
+	}
+	r.bySQL[strings.ToUpper(conv.SQLType)] = conv
+	if conv.ToDriver != nil {
+		r.byType[conv.GoType] = conv
+	}
+}
+
+func (r *typeConverters) forSQLType(sqlType string) *TypeConverter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bySQL[strings.ToUpper(sqlType)]
+}
+
+func (r *typeConverters) forValue(v driver.Value) *TypeConverter {
+	if v == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byType[reflect.TypeOf(v)]
+}
+
+// Scanner returns a sql.Scanner storing the values it scans in dest, after
+// converting them with FromDriver. dest is a pointer to a GoType value, or
+// to any type the converted values can be scanned into.
+func (conv TypeConverter) Scanner(dest interface{}) sql.Scanner {
+	return &converterScanner{conv: conv, dest: dest}
+}
+
+type converterScanner struct {
+	conv TypeConverter
+	dest interface{}
+}
+
+func (s *converterScanner) Scan(src interface{}) error {
+	if src == nil || s.conv.FromDriver == nil {
+		return convertAssign(s.dest, src)
+	}
+	v, err := s.conv.FromDriver(src)
+	if err != nil {
+		return fmt.Errorf("mssql: cannot convert %T to %v: %v", src, s.conv.GoType, err)
+	}
+	// The converted value is stored as is rather than passed to the Scan
+	// method of dest, which expects driver values.
+	dv := reflect.ValueOf(s.dest)
+	if v != nil && dv.Kind() == reflect.Ptr && !dv.IsNil() && reflect.TypeOf(v).AssignableTo(dv.Elem().Type()) {
+		dv.Elem().Set(reflect.ValueOf(v))
+		return nil
+	}
+	return convertAssign(s.dest, v)
+}
+
+// convertParam converts a parameter with a registered converter.
+func (c *Conn) convertParam(v driver.Value) (driver.Value, error) {
+	if c.connector == nil {
+		return v, nil
+	}
+	conv := c.connector.typeConverters.forValue(v)
+	if conv == nil {
+		return v, nil
+	}
+	res, err := conv.ToDriver(v)
+	if err != nil {
+		return nil, fmt.Errorf("mssql: cannot convert %T parameter: %v", v, err)
+	}
+	if conv.ParamType != "" {
+		return TypedParam{Value: res, Type: conv.ParamType}, nil
+	}
+	return res, nil
+}
@@ -0,0 +1,133 @@
+package mssql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var decimalConverter = TypeConverter{
+	SQLType: "decimal",
+	GoType:  reflect.TypeOf(decimal.Decimal{}),
+	FromDriver: func(src driver.Value) (interface{}, error) {
+		b, ok := src.([]byte)
+		if !ok {
+			return nil, errors.New("not a decimal")
+		}
+		return decimal.NewFromString(string(b))
+	},
+	ToDriver: func(v interface{}) (driver.Value, error) {
+		return v.(decimal.Decimal).String(), nil
+	},
+	ParamType: "decimal(20, 4)",
+}
+
+func TestRegisterTypeConverter(t *testing.T) {
+	c := &Connector{}
+	assert.Error(t, c.RegisterTypeConverter(TypeConverter{SQLType: "decimal"}))
+	assert.Error(t, c.RegisterTypeConverter(TypeConverter{SQLType: "decimal", GoType: reflect.TypeOf(""), ParamType: "decimal(50)"}))
+	require.NoError(t, c.RegisterTypeConverter(decimalConverter))
+
+	conv, ok := c.LookupTypeConverter("DECIMAL")
+	require.True(t, ok)
+	assert.Equal(t, "decimal", conv.SQLType)
+	_, ok = c.LookupTypeConverter("INT")
+	assert.False(t, ok)
+}
+
+func TestTypeConverterScanType(t *testing.T) {
+	c := &Connector{}
+	require.NoError(t, c.RegisterTypeConverter(decimalConverter))
+	rows := &Rows{cols: []columnStruct{
+		{ti: typeInfo{TypeId: typeIntN, Size: 4}},
+		{ti: typeInfo{TypeId: typeNumericN, Prec: 10, Scale: 2, Size: 9}},
+	}}
+	values := []driver.Value{int64(1), []byte("12.50")}
+
+	// Generic code scanning into values of the scan types gets the values
+	// of the driver.
+	for i, v := range values {
+		dest := reflect.New(rows.ColumnTypeScanType(i))
+		require.NoError(t, convertAssign(dest.Interface(), v))
+		assert.Equal(t, v, dest.Elem().Interface())
+	}
+
+	conv, ok := c.LookupTypeConverter(rows.ColumnTypeDatabaseTypeName(1))
+	require.True(t, ok)
+	var d decimal.Decimal
+	require.NoError(t, conv.Scanner(&d).Scan(values[1]))
+	assert.True(t, decimal.RequireFromString("12.5").Equal(d))
+}
+
+func TestTypeConverterScanner(t *testing.T) {
+	var d decimal.Decimal
+	require.NoError(t, decimalConverter.Scanner(&d).Scan([]byte("12.50")))
+	assert.True(t, decimal.RequireFromString("12.5").Equal(d))
+
+	var v interface{}
+	require.NoError(t, decimalConverter.Scanner(&v).Scan([]byte("1.5")))
+	assert.IsType(t, decimal.Decimal{}, v)
+
+	var p *decimal.Decimal
+	require.NoError(t, decimalConverter.Scanner(&p).Scan(nil))
+	assert.Nil(t, p)
+
+	var s string
+	require.NoError(t, (TypeConverter{}).Scanner(&s).Scan([]byte("x")), "values are scanned unchanged without FromDriver")
+	assert.Equal(t, "x", s)
+
+	assert.EqualError(t, decimalConverter.Scanner(&d).Scan("x"), "mssql: cannot convert string to decimal.Decimal: not a decimal")
+}
+
+func TestTypeConverterParam(t *testing.T) {
+	c := &Connector{}
+	require.NoError(t, c.RegisterTypeConverter(decimalConverter))
+	conn := &Conn{connector: c}
+
+	nv := driver.NamedValue{Value: decimal.RequireFromString("1.5")}
+	require.NoError(t, conn.CheckNamedValue(&nv))
+	assert.Equal(t, TypedParam{Value: "1.5", Type: "decimal(20, 4)"}, nv.Value)
+
+	nv = driver.NamedValue{Value: int64(3)}
+	require.NoError(t, conn.CheckNamedValue(&nv))
+	assert.Equal(t, int64(3), nv.Value)
+
+	// Without a connector values are converted as usual.
+	nv = driver.NamedValue{Value: decimal.RequireFromString("1.5")}
+	require.NoError(t, (&Conn{}).CheckNamedValue(&nv))
+	assert.IsType(t, decimal.Decimal{}, nv.Value)
+}
+
+func TestTypeConverterQuery(t *testing.T) {
+	checkConnStr(t)
+	connector, err := NewConnector(makeConnStr(t).String())
+	require.NoError(t, err)
+	require.NoError(t, connector.RegisterTypeConverter(decimalConverter))
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	rows, err := db.QueryContext(testContext(t), "select cast(@p1 * 2 as decimal(10, 2)), SQL_VARIANT_PROPERTY(@p1, 'Scale')",
+		decimal.RequireFromString("1.25"))
+	require.NoError(t, err)
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	conv, ok := connector.LookupTypeConverter(types[0].DatabaseTypeName())
+	require.True(t, ok)
+
+	require.True(t, rows.Next())
+	raw := reflect.New(types[0].ScanType())
+	var got decimal.Decimal
+	var scale int
+	require.NoError(t, rows.Scan(raw.Interface(), &scale))
+	assert.Equal(t, []byte("2.50"), raw.Elem().Interface(), "rows return driver values")
+	assert.Equal(t, 4, scale, "parameters are sent with the converter's type")
+	require.NoError(t, conv.Scanner(&got).Scan(raw.Elem().Interface()))
+	assert.Equal(t, "2.5", got.String())
+}
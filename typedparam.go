@@ -0,0 +1,307 @@
+package mssql
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-sql/civil"
+)
+
+// TypedParam is a query parameter declared with an explicit SQL type
+// instead of the one inferred from its Go type. Use it to match the type of
+// a column, for example to compare against a varchar column without an
+// implicit conversion:
+//
+//	db.QueryContext(ctx, "select id from users where name = @p1",
+//		mssql.TypedParam{Value: name, Type: "varchar(50)"})
+//
+// Type accepts the usual declarations, such as "int", "varchar(50)",
+// "nvarchar(max)", "decimal(10, 2)" or "datetime2(3)". A nil Value is a NULL
+// of that type. Values longer than the declared length are rejected rather
+// than truncated, as are integers out of the range of the type and floats
+// with a fractional part converted to an integer type.
+//
+// A TypedParam can also be an output parameter by passing a pointer to it in
+// sql.Out. When its Value is a pointer the output value is stored where it
+// points, otherwise it replaces Value.
+type TypedParam struct {
+	Value interface{}
+	Type  string
+}
+
+// Scan implements the sql.Scanner interface and receives the value of an
+// output parameter.
+func (p *TypedParam) Scan(v interface{}) error {
+	if p.Value != nil && reflect.TypeOf(p.Value).Kind() == reflect.Ptr {
+		return convertAssign(p.Value, v)
+	}
+	p.Value = v
+	return nil
+}
+
+// makeTypedParam returns the parameter for p, converting its value to the
+// declared type.
+func makeTypedParam(c *Conn, p TypedParam) (res param, err error) {
+	ti, err := parseTypeDecl(p.Type)
+	if err != nil {
+		return res, err
+	}
+	val, err := typedParamValue(c, p.Value)
+	if err != nil {
+		return res, err
+	}
+	if val != nil {
+		if err = checkTypedInteger(ti, val); err == nil {
+			res, err = (&Bulk{cn: c}).makeParam(val, columnStruct{ti: ti})
+		}
+		if err != nil {
+			return res, fmt.Errorf("mssql: cannot convert %T to %s: %v", p.Value, makeDecl(ti), err)
+		}
+		if err = checkTypedLength(ti, res.buffer); err != nil {
+			return res, err
+		}
+	}
+	res.ti = ti
+	if c != nil && c.sess != nil {
+		res.ti.Collation = c.sess.collation
+	}
+	return res, nil
+}
+
+// typedParamValue converts v to one of the types bulk copy converts from.
+func typedParamValue(c *Conn, v interface{}) (interface{}, error) {
+	v, err := convertInputParameter(v)
+	if err != nil {
+		return nil, err
+	}
+	loc := getTimezone(c)
+	switch v := v.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case byte:
+		return int64(v), nil
+	case VarChar:
+		return string(v), nil
+	case VarCharMax:
+		return string(v), nil
+	case NVarCharMax:
+		return string(v), nil
+	case NChar:
+		return string(v), nil
+	case DateTime1:
+		return time.Time(v), nil
+	case DateTimeOffset:
+		return time.Time(v), nil
+	case civil.Date:
+		return v.In(loc), nil
+	case civil.DateTime:
+		return v.In(loc), nil
+	case civil.Time:
+		return time.Date(1, 1, 1, v.Hour, v.Minute, v.Second, v.Nanosecond, loc), nil
+	case TypedParam, Variant, TVP:
+		return nil, fmt.Errorf("mssql: a TypedParam cannot hold a %T", v)
+	}
+	return v, nil
+}
+
+// checkTypedLength checks that a character or binary value fits the
+// declared length of its type.
+func checkTypedLength(ti typeInfo, data []byte) error {
+	switch ti.TypeId {
+	case typeBigChar, typeBigVarChar, typeNChar, typeNVarChar, typeBigBinary, typeBigVarBin:
+		if ti.Size > 0 && len(data) > ti.Size {
+			return fmt.Errorf("mssql: value of %d bytes does not fit %s", len(data), makeDecl(ti))
+		}
+	}
+	return nil
+}
+
+// checkTypedInteger checks that a value of an integer type is a whole
+// number in the range of the type. Bulk copy truncates and wraps such
+// values instead.
+func checkTypedInteger(ti typeInfo, val interface{}) error {
+	switch ti.TypeId {
+	case typeInt1, typeInt2, typeInt4, typeInt8, typeIntN:
+	default:
+		return nil
+	}
+	var v int64
+	switch val := val.(type) {
+	case int:
+		v = int64(val)
+	case int8:
+		v = int64(val)
+	case int16:
+		v = int64(val)
+	case uint8:
+		v = int64(val)
+	case int32:
+		v = int64(val)
+	case int64:
+		v = val
+	case float32, float64:
+		f := reflect.ValueOf(val).Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return fmt.Errorf("value %v is not an integer in range", f)
+		}
+		v = int64(f)
+	default:
+		// Bulk copy reports the invalid type.
+		return nil
+	}
+	return putBulkInt(make([]byte, 8), columnStruct{ti: ti}, v)
+}
+
+// decimalLength returns the size in bytes, including the sign, of a decimal
+// with the given precision.
+func decimalLength(prec uint8) int {
+	switch {
+	case prec <= 9:
+		return 5
+	case prec <= 19:
+		return 9
+	case prec <= 28:
+		return 13
+	default:
+		return 17
+	}
+}
+
+// parseTypeDecl parses a SQL type declaration, such as "int",
+// "nvarchar(20)" or "varbinary(max)", into the nullable TDS type used to
+// send values of that type. A length of max is returned as a Size of zero.
+func parseTypeDecl(s string) (ti typeInfo, err error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	var args []string
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		if !strings.HasSuffix(name, ")") {
+			return ti, fmt.Errorf("mssql: invalid type %q", s)
+		}
+		for _, arg := range strings.Split(name[i+1:len(name)-1], ",") {
+			args = append(args, strings.TrimSpace(arg))
+		}
+		name = strings.TrimSpace(name[:i])
+	}
+	isMax := len(args) == 1 && args[0] == "max"
+	arg := func(i, def int) (int, error) {
+		if i >= len(args) {
+			return def, nil
+		}
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("mssql: invalid type %q", s)
+		}
+		return n, nil
+	}
+	maxArgs := 0
+	switch name {
+	case "tinyint":
+		ti = typeInfo{TypeId: typeIntN, Size: 1}
+	case "smallint":
+		ti = typeInfo{TypeId: typeIntN, Size: 2}
+	case "int":
+		ti = typeInfo{TypeId: typeIntN, Size: 4}
+	case "bigint":
+		ti = typeInfo{TypeId: typeIntN, Size: 8}
+	case "bit":
+		ti = typeInfo{TypeId: typeBitN, Size: 1}
+	case "real":
+		ti = typeInfo{TypeId: typeFltN, Size: 4}
+	case "float":
+		maxArgs = 1
+		n, err := arg(0, 53)
+		if err != nil {
+			return ti, err
+		}
+		if n < 1 || n > 53 {
+			return ti, fmt.Errorf("mssql: invalid precision in type %q", s)
+		}
+		ti = typeInfo{TypeId: typeFltN, Size: 8}
+		if n <= 24 {
+			ti.Size = 4
+		}
+	case "smallmoney":
+		ti = typeInfo{TypeId: typeMoneyN, Size: 4}
+	case "money":
+		ti = typeInfo{TypeId: typeMoneyN, Size: 8}
+	case "smalldatetime":
+		ti = typeInfo{TypeId: typeDateTimeN, Size: 4}
+	case "datetime":
+		ti = typeInfo{TypeId: typeDateTimeN, Size: 8}
+	case "date":
+		ti = typeInfo{TypeId: typeDateN, Size: 3}
+	case "uniqueidentifier":
+		ti = typeInfo{TypeId: typeGuid, Size: 16}
+	case "time", "datetime2", "datetimeoffset":
+		maxArgs = 1
+		scale, err := arg(0, 7)
+		if err != nil {
+			return ti, err
+		}
+		if scale > 7 {
+			return ti, fmt.Errorf("mssql: invalid scale in type %q", s)
+		}
+		ti.Scale = uint8(scale)
+		ti.TypeId = map[string]uint8{"time": typeTimeN, "datetime2": typeDateTime2N, "datetimeoffset": typeDateTimeOffsetN}[name]
+	case "decimal", "numeric":
+		maxArgs = 2
+		prec, err := arg(0, 18)
+		if err != nil {
+			return ti, err
+		}
+		scale, err := arg(1, 0)
+		if err != nil {
+			return ti, err
+		}
+		if prec < 1 || prec > maxDecimalPrecision || scale > prec {
+			return ti, fmt.Errorf("mssql: invalid precision or scale in type %q", s)
+		}
+		ti.Prec, ti.Scale = uint8(prec), uint8(scale)
+		ti.Size = decimalLength(ti.Prec)
+		ti.TypeId = typeDecimalN
+		if name == "numeric" {
+			ti.TypeId = typeNumericN
+		}
+	case "binary", "varbinary", "char", "varchar", "nchar", "nvarchar":
+		maxArgs = 1
+		ti.TypeId = map[string]uint8{
+			"binary": typeBigBinary, "varbinary": typeBigVarBin,
+			"char": typeBigChar, "varchar": typeBigVarChar,
+			"nchar": typeNChar, "nvarchar": typeNVarChar,
+		}[name]
+		unicode := name == "nchar" || name == "nvarchar"
+		if isMax {
+			if !strings.HasPrefix(name, "var") && name != "nvarchar" {
+				return ti, fmt.Errorf("mssql: invalid length in type %q", s)
+			}
+			break
+		}
+		n, err := arg(0, 1)
+		if err != nil {
+			return ti, err
+		}
+		limit := 8000
+		if unicode {
+			limit = 4000
+		}
+		if n < 1 || n > limit {
+			return ti, fmt.Errorf("mssql: invalid length in type %q", s)
+		}
+		ti.Size = n
+		if unicode {
+			ti.Size *= 2
+		}
+	default:
+		return ti, fmt.Errorf("mssql: unsupported type %q", s)
+	}
+	if len(args) > maxArgs {
+		return ti, fmt.Errorf("mssql: invalid type %q", s)
+	}
+	return ti, nil
+}
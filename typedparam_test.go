@@ -0,0 +1,156 @@
+package mssql
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golang-sql/civil"
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTypeDecl(t *testing.T) {
+	tests := []struct {
+		s    string
+		want typeInfo
+	}{
+		{"int", typeInfo{TypeId: typeIntN, Size: 4}},
+		{" BigInt ", typeInfo{TypeId: typeIntN, Size: 8}},
+		{"bit", typeInfo{TypeId: typeBitN, Size: 1}},
+		{"float", typeInfo{TypeId: typeFltN, Size: 8}},
+		{"float(24)", typeInfo{TypeId: typeFltN, Size: 4}},
+		{"money", typeInfo{TypeId: typeMoneyN, Size: 8}},
+		{"smalldatetime", typeInfo{TypeId: typeDateTimeN, Size: 4}},
+		{"datetime2", typeInfo{TypeId: typeDateTime2N, Scale: 7}},
+		{"datetime2(3)", typeInfo{TypeId: typeDateTime2N, Scale: 3}},
+		{"time(0)", typeInfo{TypeId: typeTimeN}},
+		{"decimal", typeInfo{TypeId: typeDecimalN, Prec: 18, Size: 9}},
+		{"numeric(20, 4)", typeInfo{TypeId: typeNumericN, Prec: 20, Scale: 4, Size: 13}},
+		{"varchar", typeInfo{TypeId: typeBigVarChar, Size: 1}},
+		{"varchar(50)", typeInfo{TypeId: typeBigVarChar, Size: 50}},
+		{"varchar(max)", typeInfo{TypeId: typeBigVarChar}},
+		{"nvarchar(10)", typeInfo{TypeId: typeNVarChar, Size: 20}},
+		{"nvarchar( MAX )", typeInfo{TypeId: typeNVarChar}},
+		{"binary(16)", typeInfo{TypeId: typeBigBinary, Size: 16}},
+		{"uniqueidentifier", typeInfo{TypeId: typeGuid, Size: 16}},
+	}
+	for _, tt := range tests {
+		got, err := parseTypeDecl(tt.s)
+		if assert.NoError(t, err, tt.s) {
+			assert.Equal(t, tt.want, got, tt.s)
+		}
+	}
+
+	for _, s := range []string{
+		"", "text", "xml", "char(max)", "varchar(8001)", "nvarchar(4001)", "int(4)", "float(54)",
+		"decimal(39)", "decimal(5,6)", "time(8)", "char(0)", "varchar(", "varchar(-1)", "varchar(x)",
+	} {
+		_, err := parseTypeDecl(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMakeTypedParam(t *testing.T) {
+	c := &Conn{sess: &tdsSession{}}
+	tests := []struct {
+		name string
+		p    TypedParam
+		decl string
+		buf  []byte
+	}{
+		{"varchar", TypedParam{Value: "abc", Type: "varchar(50)"}, "varchar(50)", []byte("abc")},
+		{"varchar from VarChar", TypedParam{Value: VarChar("abc"), Type: "varchar(max)"}, "varchar(max)", []byte("abc")},
+		{"nchar", TypedParam{Value: "ab", Type: "nchar(4)"}, "nchar(4)", []byte{'a', 0, 'b', 0}},
+		{"smallint", TypedParam{Value: int8(-2), Type: "smallint"}, "smallint", []byte{0xfe, 0xff}},
+		{"int from uint", TypedParam{Value: uint16(7), Type: "int"}, "int", []byte{7, 0, 0, 0}},
+		{"int from whole float", TypedParam{Value: 3.0, Type: "int"}, "int", []byte{3, 0, 0, 0}},
+		{"tinyint max", TypedParam{Value: 255, Type: "tinyint"}, "tinyint", []byte{255}},
+		{"real", TypedParam{Value: 1.5, Type: "real"}, "real", []byte{0, 0, 0xc0, 0x3f}},
+		{"decimal", TypedParam{Value: "12.5", Type: "decimal(10, 2)"}, "decimal(10, 2)", []byte{1, 0xe2, 0x04, 0, 0, 0, 0, 0, 0}},
+		{"datetime2", TypedParam{Value: time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC), Type: "datetime2(3)"}, "datetime2(3)",
+			[]byte{0x03, 0x89, 0xa8, 0x00, 0x91, 0x40, 0x0b}},
+		{"date from civil", TypedParam{Value: civil.Date{Year: 2020, Month: 1, Day: 2}, Type: "date"}, "date", []byte{0x91, 0x40, 0x0b}},
+		{"null", TypedParam{Type: "varchar(10)"}, "varchar(10)", nil},
+		{"null pointer", TypedParam{Value: (*int64)(nil), Type: "bigint"}, "bigint", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := makeTypedParam(c, tt.p)
+			require.NoError(t, err)
+			assert.Equal(t, tt.decl, makeDecl(p.ti))
+			assert.Equal(t, tt.buf, p.buffer)
+		})
+	}
+
+	for _, p := range []TypedParam{
+		{Value: "abc", Type: "varchar(2)"},
+		{Value: "abc", Type: "int"},
+		{Value: "abc", Type: "geometry"},
+		{Value: Variant{Value: 1}, Type: "int"},
+		{Value: int64(5e9), Type: "int"},
+		{Value: 2.7, Type: "int"},
+		{Value: 300, Type: "tinyint"},
+		{Value: -1, Type: "tinyint"},
+		{Value: int32(40000), Type: "smallint"},
+		{Value: 1e19, Type: "bigint"},
+	} {
+		_, err := makeTypedParam(c, p)
+		assert.Error(t, err, "%v", p)
+	}
+}
+
+func TestTypedParamRPC(t *testing.T) {
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}}
+	p, err := s.makeParam(TypedParam{Value: "abc", Type: "varchar(50)"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeTypeInfo(&buf, &p.ti, false, msdsn.EncodeParameters{}))
+	require.NoError(t, p.ti.Writer(&buf, p.ti, p.buffer, msdsn.EncodeParameters{}))
+	want := []byte{typeBigVarChar, 50, 0, 0, 0, 0, 0, 0, 3, 0, 'a', 'b', 'c'}
+	assert.Equal(t, want, buf.Bytes(), "the value length differs from the declared length")
+}
+
+func TestTypedParamScan(t *testing.T) {
+	var n int32
+	p := TypedParam{Value: &n, Type: "int"}
+	require.NoError(t, p.Scan(int64(5)))
+	assert.Equal(t, int32(5), n)
+
+	p = TypedParam{Type: "int"}
+	require.NoError(t, p.Scan(int64(6)))
+	assert.Equal(t, int64(6), p.Value)
+}
+
+func TestTypedParamQuery(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	var baseType string
+	var maxLength int
+	err := conn.QueryRow("select cast(SQL_VARIANT_PROPERTY(@p1, 'BaseType') as varchar(20)), cast(SQL_VARIANT_PROPERTY(@p1, 'MaxLength') as int)",
+		TypedParam{Value: "abc", Type: "varchar(50)"}).Scan(&baseType, &maxLength)
+	require.NoError(t, err)
+	assert.Equal(t, "varchar", baseType)
+	assert.Equal(t, 50, maxLength)
+
+	var scale int
+	err = conn.QueryRow("select cast(SQL_VARIANT_PROPERTY(@p1, 'Scale') as int)",
+		TypedParam{Value: time.Now(), Type: "datetime2(3)"}).Scan(&scale)
+	require.NoError(t, err)
+	assert.Equal(t, 3, scale)
+
+	out := int64(21)
+	_, err = conn.Exec("set @p1 = @p1 * 2", sql.Named("p1", sql.Out{Dest: &TypedParam{Value: &out, Type: "bigint"}}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), out)
+
+	res := TypedParam{Value: "ab", Type: "varchar(10)"}
+	_, err = conn.Exec("set @p1 = @p1 + 'cd'", sql.Named("p1", sql.Out{Dest: &res}))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abcd"), res.Value)
+}
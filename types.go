@@ -221,7 +221,7 @@ func writeVarLen(w io.Writer, ti *typeInfo, out bool, encoding msdsn.EncodeParam
 		}
 		ti.Writer = writeGuidType
 	case typeBigVarBin, typeBigVarChar, typeBigBinary, typeBigChar,
-		typeNVarChar, typeNChar, typeXml, typeUdt:
+		typeNVarChar, typeNChar, typeUdt:
 
 		// short len types
 		if ti.Size > 8000 || ti.Size == 0 || out {
@@ -240,20 +240,29 @@ func writeVarLen(w io.Writer, ti *typeInfo, out bool, encoding msdsn.EncodeParam
 			if err = writeCollation(w, ti.Collation); err != nil {
 				return
 			}
-		case typeXml:
-			if err = binary.Write(w, binary.LittleEndian, ti.XmlInfo.SchemaPresent); err != nil {
-				return
-			}
 		}
-	case typeText, typeImage, typeNText, typeVariant:
+	case typeXml:
+		// XML has no length, its values are always PLP
+		if err = binary.Write(w, binary.LittleEndian, ti.XmlInfo.SchemaPresent); err != nil {
+			return
+		}
+		ti.Writer = writePLPType
+	case typeText, typeImage, typeNText:
 		// LONGLEN_TYPE
 		if err = binary.Write(w, binary.LittleEndian, uint32(ti.Size)); err != nil {
 			return
 		}
-		if err = writeCollation(w, ti.Collation); err != nil {
-			return
+		if ti.TypeId != typeImage {
+			if err = writeCollation(w, ti.Collation); err != nil {
+				return
+			}
 		}
 		ti.Writer = writeLongLenType
+	case typeVariant:
+		if err = binary.Write(w, binary.LittleEndian, uint32(ti.Size)); err != nil {
+			return
+		}
+		ti.Writer = writeVariantType
 	default:
 		panic("Invalid type")
 	}
@@ -533,10 +542,12 @@ func writeShortLenType(w io.Writer, ti typeInfo, buf []byte, encoding msdsn.Enco
 		err = binary.Write(w, binary.LittleEndian, uint16(0xffff))
 		return
 	}
-	if ti.Size > 0xfffe {
+	// The length is that of the value, which may be shorter than the
+	// maximum length sent in the type info.
+	if len(buf) > 0xfffe {
 		panic("Invalid size for USHORTLEN_TYPE")
 	}
-	err = binary.Write(w, binary.LittleEndian, uint16(ti.Size))
+	err = binary.Write(w, binary.LittleEndian, uint16(len(buf)))
 	if err != nil {
 		return
 	}
@@ -576,6 +587,10 @@ func readLongLenType(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata, encoding msd
 	panic("shoulnd't get here")
 }
 func writeLongLenType(w io.Writer, ti typeInfo, buf []byte, encoding msdsn.EncodeParameters) (err error) {
+	if buf == nil {
+		// a textptr of length 0 is NULL
+		return binary.Write(w, binary.LittleEndian, byte(0))
+	}
 	//textptr
 	err = binary.Write(w, binary.LittleEndian, byte(0x10))
 	if err != nil {
@@ -1299,10 +1314,16 @@ func makeDecl(ti typeInfo) string {
 		return "text"
 	case typeNText:
 		return "ntext"
+	case typeImage:
+		return "image"
+	case typeXml:
+		return "xml"
 	case typeUdt:
 		return ti.UdtInfo.TypeName
 	case typeGuid:
 		return "uniqueidentifier"
+	case typeVariant:
+		return "sql_variant"
 	case typeTvp:
 		if ti.UdtInfo.SchemaName != "" {
 			return fmt.Sprintf("%s.%s READONLY", ti.UdtInfo.SchemaName, ti.UdtInfo.TypeName)
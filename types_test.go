@@ -262,6 +262,8 @@ func TestMakeDecl(t *testing.T) {
 		{"typeDateTimeOffsetN", typeInfo{TypeId: typeDateTimeOffsetN, Scale: 3}, "datetimeoffset(3)"},
 		{"typeText", typeInfo{TypeId: typeText}, "text"},
 		{"typeNText", typeInfo{TypeId: typeNText}, "ntext"},
+		{"typeImage", typeInfo{TypeId: typeImage}, "image"},
+		{"typeXml", typeInfo{TypeId: typeXml}, "xml"},
 		{"typeBigVarChar 100", typeInfo{TypeId: typeBigVarChar, Size: 100}, "varchar(100)"},
 		{"typeBigVarChar max", typeInfo{TypeId: typeBigVarChar, Size: 0xffff}, "varchar(max)"},
 		{"typeBigChar 50", typeInfo{TypeId: typeBigChar, Size: 50}, "char(50)"},
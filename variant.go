@@ -0,0 +1,218 @@
+package mssql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/shopspring/decimal"
+)
+
+// maxVariantDataLength is the largest value a sql_variant can hold.
+const maxVariantDataLength = 8000
+
+// variantMaxSize is the TYPE_INFO maximum length sent for sql_variant values.
+const variantMaxSize = 8009
+
+// Variant is a sql_variant value. It can be used as a query parameter, as a
+// TVP column and as a bulk copy value for sql_variant columns.
+//
+// The base type of the stored value is inferred from Value the same way it is
+// for ordinary parameters, so an int32 is stored as int and a time.Time as
+// datetimeoffset. Set Type to store the value as a different base type, for
+// example "varchar(20)", "decimal(10, 2)" or "datetime2(3)". Values that do
+// not fit Type, such as 70000 as a smallint, are rejected. A nil Value is a
+// NULL sql_variant.
+//
+// Plain values written to a sql_variant column by bulk copy are treated as a
+// Variant with an empty Type.
+type Variant struct {
+	Value interface{}
+	Type  string
+}
+
+// makeVariant returns the sql_variant encoding of v: the base type, its
+// properties and the value. It returns nil for NULL.
+func makeVariant(c *Conn, v Variant) ([]byte, error) {
+	if v.Value == nil {
+		return nil, nil
+	}
+	var p param
+	var err error
+	if v.Type == "" {
+		p, err = inferVariantParam(c, v.Value)
+	} else {
+		var ti typeInfo
+		if ti, err = parseVariantType(v.Type); err != nil {
+			return nil, err
+		}
+		// Bulk copy already converts values to an arbitrary column type.
+		if err = checkTypedInteger(ti, v.Value); err == nil {
+			p, err = (&Bulk{cn: c}).makeParam(v.Value, columnStruct{ti: ti})
+		}
+		p.ti = ti
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mssql: invalid sql_variant value: %v", err)
+	}
+	if p.buffer == nil {
+		return nil, nil
+	}
+	if v.Type != "" {
+		if p.buffer, err = fitVariantLength(p.ti, p.buffer); err != nil {
+			return nil, err
+		}
+	}
+	if c != nil && c.sess != nil && p.ti.Collation.LcidAndFlags == 0 {
+		p.ti.Collation = c.sess.collation
+	}
+	return encodeVariant(p.ti, p.buffer)
+}
+
+func inferVariantParam(c *Conn, val interface{}) (param, error) {
+	switch val := val.(type) {
+	case Variant:
+		return param{}, errors.New("sql_variant values cannot be nested")
+	case decimal.Decimal:
+		// Decimals are otherwise sent as strings.
+		scale := -val.Exponent()
+		if scale < 0 {
+			scale = 0
+		}
+		if scale > 38 {
+			scale = 38
+		}
+		ti := typeInfo{TypeId: typeDecimalN, Prec: 38, Scale: uint8(scale), Size: 17}
+		p, err := (&Bulk{cn: c}).makeParam(val.String(), columnStruct{ti: ti})
+		p.ti = ti
+		return p, err
+	case Money[decimal.Decimal]:
+		ti := typeInfo{TypeId: typeMoney, Size: 8}
+		p := makeMoneyParam(val.Decimal)
+		p.ti = ti
+		return p, nil
+	}
+	cval, err := convertInputParameter(val)
+	if err != nil {
+		return param{}, err
+	}
+	return (&Stmt{c: c}).makeParam(cval)
+}
+
+// encodeVariant writes the base type, properties and value of a sql_variant.
+// Nullable TDS types are mapped to the fixed length base types sql_variant
+// uses.
+func encodeVariant(ti typeInfo, data []byte) ([]byte, error) {
+	typeID := ti.TypeId
+	switch typeID {
+	case typeIntN:
+		typeID = map[int]uint8{1: typeInt1, 2: typeInt2, 4: typeInt4, 8: typeInt8}[len(data)]
+	case typeFltN:
+		typeID = map[int]uint8{4: typeFlt4, 8: typeFlt8}[len(data)]
+	case typeBitN:
+		typeID = typeBit
+	case typeMoneyN:
+		typeID = map[int]uint8{4: typeMoney4, 8: typeMoney}[len(data)]
+	case typeDateTimeN:
+		typeID = map[int]uint8{4: typeDateTim4, 8: typeDateTime}[len(data)]
+	case typeDecimal:
+		typeID = typeDecimalN
+	case typeNumeric:
+		typeID = typeNumericN
+	}
+	if len(data) > maxVariantDataLength {
+		return nil, fmt.Errorf("mssql: sql_variant values are limited to %d bytes, got %d", maxVariantDataLength, len(data))
+	}
+	maxLength := func() []byte {
+		size := ti.Size
+		if size <= 0 || size > maxVariantDataLength {
+			size = len(data)
+		}
+		return binary.LittleEndian.AppendUint16(nil, uint16(size))
+	}
+
+	var props []byte
+	switch typeID {
+	case typeInt1, typeInt2, typeInt4, typeInt8, typeBit, typeFlt4, typeFlt8,
+		typeMoney, typeMoney4, typeDateTime, typeDateTim4, typeGuid, typeDateN:
+	case typeTimeN, typeDateTime2N, typeDateTimeOffsetN:
+		props = []byte{ti.Scale}
+	case typeDecimalN, typeNumericN:
+		props = []byte{ti.Prec, ti.Scale}
+	case typeBigVarBin, typeBigBinary:
+		props = maxLength()
+	case typeBigVarChar, typeBigChar, typeNVarChar, typeNChar:
+		props = binary.LittleEndian.AppendUint32(nil, ti.Collation.LcidAndFlags)
+		props = append(props, ti.Collation.SortId)
+		props = append(props, maxLength()...)
+	case 0:
+		return nil, fmt.Errorf("mssql: invalid size %d for sql_variant value of type %#x", len(data), ti.TypeId)
+	default:
+		return nil, fmt.Errorf("mssql: type %s cannot be stored in sql_variant", makeDecl(ti))
+	}
+	buf := make([]byte, 0, 2+len(props)+len(data))
+	buf = append(buf, typeID, byte(len(props)))
+	buf = append(buf, props...)
+	return append(buf, data...), nil
+}
+
+// fitVariantLength checks that a value fits the declared length of its
+// character or binary type and pads values of fixed length types.
+func fitVariantLength(ti typeInfo, data []byte) ([]byte, error) {
+	var pad []byte
+	switch ti.TypeId {
+	case typeBigChar:
+		pad = []byte{' '}
+	case typeNChar:
+		pad = []byte{' ', 0}
+	case typeBigBinary:
+		pad = []byte{0}
+	case typeBigVarChar, typeNVarChar, typeBigVarBin:
+	default:
+		return data, nil
+	}
+	if len(data) > ti.Size {
+		return nil, fmt.Errorf("mssql: sql_variant value of %d bytes does not fit %s", len(data), makeDecl(ti))
+	}
+	if pad != nil {
+		data = append(data, bytes.Repeat(pad, (ti.Size-len(data))/len(pad))...)
+	}
+	return data, nil
+}
+
+// makeVariantParam returns an RPC parameter of type sql_variant.
+func makeVariantParam(c *Conn, v Variant) (res param, err error) {
+	res.ti.TypeId = typeVariant
+	res.ti.Size = variantMaxSize
+	res.buffer, err = makeVariant(c, v)
+	return
+}
+
+// parseVariantType parses the base type of a Variant, such as "int" or
+// "nvarchar(20)".
+func parseVariantType(s string) (typeInfo, error) {
+	ti, err := parseTypeDecl(s)
+	if err != nil {
+		return ti, err
+	}
+	switch ti.TypeId {
+	case typeBigVarBin, typeBigVarChar, typeNVarChar:
+		if ti.Size == 0 {
+			return ti, fmt.Errorf("mssql: type %q cannot be stored in sql_variant", s)
+		}
+	}
+	return ti, nil
+}
+
+// writeVariantType writes a sql_variant value, which is prefixed with its
+// length and has a length of zero when NULL.
+func writeVariantType(w io.Writer, ti typeInfo, buf []byte, encoding msdsn.EncodeParameters) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, uint32(len(buf))); err != nil {
+		return
+	}
+	_, err = w.Write(buf)
+	return
+}
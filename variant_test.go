@@ -0,0 +1,203 @@
+package mssql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeVariant(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Variant
+		want []byte
+	}{
+		{"null", Variant{}, nil},
+		{"int", Variant{Value: int32(5)}, []byte{typeInt4, 0, 5, 0, 0, 0}},
+		{"bigint", Variant{Value: int64(5)}, []byte{typeInt8, 0, 5, 0, 0, 0, 0, 0, 0, 0}},
+		{"bit", Variant{Value: true}, []byte{typeBit, 0, 1}},
+		{"float", Variant{Value: 1.5}, []byte{typeFlt8, 0, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+		{"nvarchar", Variant{Value: "ab"}, []byte{typeNVarChar, 7, 0, 0, 0, 0, 0, 4, 0, 'a', 0, 'b', 0}},
+		{"varbinary", Variant{Value: []byte{1, 2}}, []byte{typeBigVarBin, 2, 2, 0, 1, 2}},
+		{"shopspring decimal", Variant{Value: decimal.RequireFromString("12.50")},
+			append([]byte{typeDecimalN, 2, 38, 2, 1, 0xe2, 0x04}, make([]byte, 14)...)},
+		{"explicit decimal", Variant{Value: "12.50", Type: "decimal(10, 2)"},
+			[]byte{typeDecimalN, 2, 10, 2, 1, 0xe2, 0x04, 0, 0, 0, 0, 0, 0}},
+		{"explicit char", Variant{Value: "ab", Type: "char(4)"},
+			[]byte{typeBigChar, 7, 0, 0, 0, 0, 0, 4, 0, 'a', 'b', ' ', ' '}},
+		{"explicit tinyint", Variant{Value: int64(7), Type: "TINYINT"}, []byte{typeInt1, 0, 7}},
+		{"explicit datetime2", Variant{Value: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Type: "datetime2(0)"},
+			[]byte{typeDateTime2N, 1, 0, 0x25, 0x2b, 0, 0x91, 0x40, 0x0b}},
+		{"explicit date", Variant{Value: "2020-01-02", Type: "date"}, []byte{typeDateN, 0, 0x91, 0x40, 0x0b}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeVariant(nil, tt.v)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMakeVariantSessionCollation(t *testing.T) {
+	c := &Conn{sess: &tdsSession{}}
+	c.sess.collation.LcidAndFlags = 0x00d00409
+	c.sess.collation.SortId = 52
+	got, err := makeVariant(c, Variant{Value: "a", Type: "varchar(1)"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{typeBigVarChar, 7, 0x09, 0x04, 0xd0, 0x00, 52, 1, 0, 'a'}, got)
+}
+
+func TestMakeVariantErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Variant
+	}{
+		{"nested", Variant{Value: Variant{Value: 1}}},
+		{"too long for type", Variant{Value: "abc", Type: "varchar(2)"}},
+		{"too long", Variant{Value: make([]byte, maxVariantDataLength+1)}},
+		{"unsupported base type", Variant{Value: "x", Type: "xml"}},
+		{"invalid value", Variant{Value: "x", Type: "int"}},
+		{"out of range for type", Variant{Value: int64(70000), Type: "smallint"}},
+		{"negative tinyint", Variant{Value: -1, Type: "tinyint"}},
+		{"fractional int", Variant{Value: 2.5, Type: "int"}},
+		{"int16 out of range for tinyint", Variant{Value: int16(300), Type: "tinyint"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := makeVariant(nil, tt.v)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseVariantType(t *testing.T) {
+	ti, err := parseVariantType("nvarchar(10)")
+	require.NoError(t, err)
+	assert.Equal(t, typeInfo{TypeId: typeNVarChar, Size: 20}, ti)
+
+	for _, s := range []string{"nvarchar(max)", "varbinary(max)", "xml", "int(4)"} {
+		_, err := parseVariantType(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestVariantTypeInfo(t *testing.T) {
+	p, err := makeVariantParam(nil, Variant{Value: int32(1)})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeTypeInfo(&buf, &p.ti, false, msdsn.EncodeParameters{}))
+	assert.Equal(t, []byte{typeVariant, 0x49, 0x1f, 0, 0}, buf.Bytes())
+	assert.Equal(t, "sql_variant", makeDecl(p.ti))
+
+	buf.Reset()
+	require.NoError(t, p.ti.Writer(&buf, p.ti, p.buffer, msdsn.EncodeParameters{}))
+	b := buf.Bytes()
+	r := &tdsBuffer{packetSize: len(b), rbuf: b, rsize: len(b)}
+	assert.Equal(t, int64(1), readVariantTypeWithEncoding(&p.ti, r, nil, msdsn.EncodeParameters{}))
+
+	buf.Reset()
+	require.NoError(t, writeVariantType(&buf, p.ti, nil, msdsn.EncodeParameters{}))
+	assert.Equal(t, binary.LittleEndian.AppendUint32(nil, 0), buf.Bytes())
+}
+
+func TestVariantQuery(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	tests := []struct {
+		v        Variant
+		baseType string
+		want     interface{}
+	}{
+		{Variant{Value: int32(5)}, "int", int64(5)},
+		{Variant{Value: "abc"}, "nvarchar", "abc"},
+		{Variant{Value: "abc", Type: "varchar(10)"}, "varchar", "abc"},
+		{Variant{Value: "1.25", Type: "decimal(10, 2)"}, "decimal", []byte("1.25")},
+		{Variant{Value: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Type: "datetime2(0)"}, "datetime2",
+			time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		var baseType string
+		var got interface{}
+		err := conn.QueryRow("select cast(SQL_VARIANT_PROPERTY(@p1, 'BaseType') as nvarchar(128)), @p1", tt.v).Scan(&baseType, &got)
+		if assert.NoError(t, err, tt.v.Type) {
+			assert.Equal(t, tt.baseType, baseType)
+			assert.Equal(t, tt.want, got)
+		}
+	}
+
+	var isNull bool
+	err := conn.QueryRow("select case when @p1 is null then 1 else 0 end", Variant{}).Scan(&isNull)
+	require.NoError(t, err)
+	assert.True(t, isNull)
+}
+
+func TestVariantBulkCopy(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := testContext(t)
+	_, err := conn.ExecContext(ctx, "create table #variant_bulk (v sql_variant)")
+	require.NoError(t, err)
+
+	txn, err := conn.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	stmt, err := txn.PrepareContext(ctx, CopyIn("#variant_bulk", BulkOptions{}, "v"))
+	require.NoError(t, err)
+	for _, v := range []interface{}{int64(1), "two", Variant{Value: "3", Type: "char(2)"}, nil} {
+		_, err = stmt.ExecContext(ctx, v)
+		require.NoError(t, err)
+	}
+	_, err = stmt.ExecContext(ctx)
+	require.NoError(t, err)
+
+	rows, err := txn.QueryContext(ctx, "select cast(SQL_VARIANT_PROPERTY(v, 'BaseType') as nvarchar(128)) from #variant_bulk")
+	require.NoError(t, err)
+	defer rows.Close()
+	var types []interface{}
+	for rows.Next() {
+		var baseType interface{}
+		require.NoError(t, rows.Scan(&baseType))
+		types = append(types, baseType)
+	}
+	require.NoError(t, rows.Err())
+	assert.ElementsMatch(t, []interface{}{"bigint", "nvarchar", "char", nil}, types)
+}
+
+func TestVariantParam(t *testing.T) {
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}}
+	p, err := s.makeParam(Variant{Value: int64(7), Type: "smallint"})
+	require.NoError(t, err)
+	assert.Equal(t, byte(typeVariant), p.ti.TypeId)
+	assert.Equal(t, []byte{typeInt2, 0, 7, 0}, p.buffer)
+
+	_, err = s.makeParam(Variant{Value: int64(70000), Type: "smallint"})
+	assert.ErrorContains(t, err, "mssql: invalid sql_variant value")
+}
+
+func TestVariantTVPColumn(t *testing.T) {
+	type row struct {
+		V Variant
+	}
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}}
+	p, err := s.makeParam(TVP{TypeName: "dbo.variants", Value: []row{{Variant{Value: int32(5)}}, {Variant{}}}})
+	require.NoError(t, err)
+	assert.Equal(t, byte(typeTvp), p.ti.TypeId)
+	value := binary.LittleEndian.AppendUint32(nil, 6)
+	value = append(value, typeInt4, 0, 5, 0, 0, 0)
+	assert.True(t, bytes.Contains(p.buffer, value), "the variant value is encoded in the TVP row")
+
+	_, err = s.makeParam(TVP{TypeName: "dbo.variants", Value: []row{{Variant{Value: int64(70000), Type: "smallint"}}}})
+	assert.ErrorContains(t, err, "mssql: invalid sql_variant value")
+}